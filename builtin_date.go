@@ -125,13 +125,7 @@ func (r *Runtime) dateproto_toISOString(call FunctionCall) Value {
 	obj := r.toObject(call.This)
 	if d, ok := obj.self.(*dateObject); ok {
 		if d.isSet() {
-			utc := d.timeUTC()
-			year := utc.Year()
-			if year >= -9999 && year <= 9999 {
-				return asciiString(utc.Format(isoDateTimeLayout))
-			}
-			// extended year
-			return asciiString(fmt.Sprintf("%+06d-", year) + utc.Format(isoDateTimeLayout[5:]))
+			return asciiString(isoDateString(d.timeUTC()))
 		} else {
 			panic(r.newError(r.global.RangeError, "Invalid time value"))
 		}
@@ -139,6 +133,16 @@ func (r *Runtime) dateproto_toISOString(call FunctionCall) Value {
 	panic(r.NewTypeError("Method Date.prototype.toISOString is called on incompatible receiver"))
 }
 
+// isoDateString formats utc the way Date.prototype.toISOString does.
+func isoDateString(utc time.Time) string {
+	year := utc.Year()
+	if year >= -9999 && year <= 9999 {
+		return utc.Format(isoDateTimeLayout)
+	}
+	// extended year
+	return fmt.Sprintf("%+06d-", year) + utc.Format(isoDateTimeLayout[5:])
+}
+
 func (r *Runtime) dateproto_toJSON(call FunctionCall) Value {
 	obj := call.This.ToObject(r)
 	tv := obj.toPrimitiveNumber()
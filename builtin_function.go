@@ -193,6 +193,10 @@ lenNotInt:
 	bf := &boundFuncObject{
 		nativeFuncObject: *ff,
 		wrapped:          obj,
+		boundThis:        call.Argument(0),
+	}
+	if len(call.Arguments) > 1 {
+		bf.boundArgs = append([]Value(nil), call.Arguments[1:]...)
 	}
 	bf.prototype = obj.self.proto()
 	v.self = bf
@@ -30,6 +30,7 @@ type PromiseRejectionTracker func(p *Promise, operation PromiseRejectionOperatio
 
 type jobCallback struct {
 	callback func(FunctionCall) Value
+	fn       Value // the function callback calls, shown by the debugger
 }
 
 type promiseCapability struct {
@@ -100,8 +101,9 @@ func (p *Promise) createResolvingFunctions() (resolve, reject *Object) {
 					return p.reject(ex.val)
 				}
 				if call, ok := assertCallable(thenAction); ok {
-					job := r.newPromiseResolveThenableJob(p, resolution, &jobCallback{callback: call})
-					r.enqueuePromiseJob(job)
+					then := &jobCallback{callback: call, fn: thenAction}
+					job := r.newPromiseResolveThenableJob(p, resolution, then)
+					r.enqueuePromiseJob(job, PromiseResolveThenableJob, then, p.val)
 					return _undefined
 				}
 			}
@@ -161,13 +163,25 @@ func (r *Runtime) newPromiseResolveThenableJob(p *Promise, thenable Value, then
 	}
 }
 
-func (r *Runtime) enqueuePromiseJob(job func()) {
+// enqueuePromiseJob schedules job, which calls handler (if it isn't nil) and settles promise (if it isn't nil).
+func (r *Runtime) enqueuePromiseJob(job func(), kind JobKind, handler *jobCallback, promise *Object) {
+	if dbg := r.vm.debugger; dbg != nil {
+		job = dbg.queueJob(dbg.asyncJob(job), kind, handler, promise)
+	}
 	r.jobQueue = append(r.jobQueue, job)
 }
 
+func (r *Runtime) enqueuePromiseReactionJob(reaction *promiseReaction, argument Value) {
+	var promise *Object
+	if reaction.capability != nil {
+		promise = reaction.capability.promise
+	}
+	r.enqueuePromiseJob(r.newPromiseReactionJob(reaction, argument), PromiseReactionJob, reaction.handler, promise)
+}
+
 func (r *Runtime) triggerPromiseReactions(reactions []*promiseReaction, argument Value) {
 	for _, reaction := range reactions {
-		r.enqueuePromiseJob(r.newPromiseReactionJob(reaction, argument))
+		r.enqueuePromiseReactionJob(reaction, argument)
 	}
 }
 
@@ -282,10 +296,10 @@ func (r *Runtime) newPromiseCapability(c *Object) *promiseCapability {
 func (r *Runtime) performPromiseThen(p *Promise, onFulfilled, onRejected Value, resultCapability *promiseCapability) Value {
 	var onFulfilledJobCallback, onRejectedJobCallback *jobCallback
 	if f, ok := assertCallable(onFulfilled); ok {
-		onFulfilledJobCallback = &jobCallback{callback: f}
+		onFulfilledJobCallback = &jobCallback{callback: f, fn: onFulfilled}
 	}
 	if f, ok := assertCallable(onRejected); ok {
-		onRejectedJobCallback = &jobCallback{callback: f}
+		onRejectedJobCallback = &jobCallback{callback: f, fn: onRejected}
 	}
 	fulfillReaction := &promiseReaction{
 		capability: resultCapability,
@@ -302,13 +316,13 @@ func (r *Runtime) performPromiseThen(p *Promise, onFulfilled, onRejected Value,
 		p.fulfillReactions = append(p.fulfillReactions, fulfillReaction)
 		p.rejectReactions = append(p.rejectReactions, rejectReaction)
 	case PromiseStateFulfilled:
-		r.enqueuePromiseJob(r.newPromiseReactionJob(fulfillReaction, p.result))
+		r.enqueuePromiseReactionJob(fulfillReaction, p.result)
 	default:
 		reason := p.result
 		if !p.handled {
 			r.trackPromiseRejection(p, PromiseRejectionHandle)
 		}
-		r.enqueuePromiseJob(r.newPromiseReactionJob(rejectReaction, reason))
+		r.enqueuePromiseReactionJob(rejectReaction, reason)
 	}
 	p.handled = true
 	if resultCapability == nil {
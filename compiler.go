@@ -71,6 +71,12 @@ type Program struct {
 	funcName unistring.String
 	src      *file.File
 	srcMap   []srcMapItem
+
+	strict    bool  // only used by the debugger
+	stmts     []int // sorted pcs at which statements start, only recorded in debug mode
+	loopTests []int // sorted pcs at which the conditions of loops start, only recorded in debug mode
+
+	funcStart, funcEnd int // source offsets of a function's literal, only recorded in debug mode
 }
 
 type compiler struct {
@@ -461,6 +467,26 @@ func (p *Program) sourceOffset(pc int) int {
 	return 0
 }
 
+func (p *Program) addStmt() {
+	p.stmts = insertPc(p.stmts, len(p.code))
+}
+
+func (p *Program) addLoopTest() {
+	p.loopTests = insertPc(p.loopTests, len(p.code))
+}
+
+// insertPc adds pc to the sorted pcs unless it's already there.
+func insertPc(pcs []int, pc int) []int {
+	i := sort.SearchInts(pcs, pc)
+	if i < len(pcs) && pcs[i] == pc {
+		return pcs
+	}
+	pcs = append(pcs, 0)
+	copy(pcs[i+1:], pcs[i:])
+	pcs[i] = pc
+	return pcs
+}
+
 func (p *Program) addSrcMap(srcPos int) {
 	if len(p.srcMap) > 0 && p.srcMap[len(p.srcMap)-1].srcPos == srcPos {
 		return
@@ -908,6 +934,7 @@ func (c *compiler) compile(in *ast.Program, strict, inGlobal bool, evalVm *vm) {
 		strict = c.isStrict(in.Body) != nil
 	}
 	scope.strict = strict
+	c.p.strict = strict
 	ownVarScope := eval && strict
 	ownLexScope := !inGlobal || eval
 	if ownVarScope {
@@ -1349,6 +1349,9 @@ func (e *compiledFunctionLiteral) compile() (prg *Program, name unistring.String
 		src:  e.c.p.src,
 		code: e.c.newCode(preambleLen, 16),
 	}
+	if e.c.debug {
+		e.c.p.funcStart, e.c.p.funcEnd = e.offset, e.offset+len(e.source)
+	}
 	e.c.newScope()
 	s := e.c.scope
 	s.funcType = e.typ
@@ -1706,6 +1709,7 @@ func (e *compiledFunctionLiteral) compile() (prg *Program, name unistring.String
 
 	strict = s.strict
 	prg = e.c.p
+	prg.strict = strict
 	// e.c.p.dumpCode()
 	if enterFunc2Mark != -1 {
 		e.c.popScope()
@@ -2986,6 +2990,7 @@ func (c *compiler) emitCallee(callee compiledExpr) (calleeName unistring.String)
 	switch callee := callee.(type) {
 	case *compiledDotExpr:
 		callee.left.emitGetter(true)
+		callee.addSrcMap()
 		c.emit(getPropCallee(callee.name))
 	case *compiledPrivateDotExpr:
 		callee.left.emitGetter(true)
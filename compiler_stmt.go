@@ -8,6 +8,9 @@ import (
 )
 
 func (c *compiler) compileStatement(v ast.Statement, needResult bool) {
+	if c.debug {
+		c.p.addStmt()
+	}
 
 	switch v := v.(type) {
 	case *ast.BlockStatement:
@@ -229,6 +232,9 @@ func (c *compiler) compileLabeledDoWhileStatement(v *ast.DoWhileStatement, needR
 	start := len(c.p.code)
 	c.compileStatement(v.Body, needResult)
 	c.block.cont = len(c.p.code)
+	if c.debug {
+		c.p.addLoopTest()
+	}
 	c.emitExpr(c.compileExpression(v.Test), true)
 	c.emit(jeq(start - len(c.p.code)))
 	c.leaveBlock()
@@ -312,6 +318,9 @@ func (c *compiler) compileLabeledForStatement(v *ast.ForStatement, needResult bo
 				goto end
 			}
 		} else {
+			if c.debug {
+				c.p.addLoopTest()
+			}
 			expr.emitGetter(true)
 			j = len(c.p.code)
 			c.emit(nil)
@@ -529,6 +538,9 @@ func (c *compiler) compileLabeledWhileStatement(v *ast.WhileStatement, needResul
 			goto end
 		}
 	} else {
+		if c.debug {
+			c.p.addLoopTest()
+		}
 		expr.emitGetter(true)
 		j = len(c.p.code)
 		c.emit(nil)
@@ -985,6 +997,19 @@ func (c *compiler) compileBlockStatement(v *ast.BlockStatement, needResult bool)
 }
 
 func (c *compiler) compileExpressionStatement(v *ast.ExpressionStatement, needResult bool) {
+	if c.debug {
+		// the value is kept for the debugger even if it's not needed, and the statement is mapped to its line even if
+		// it's folded into a constant
+		c.addSrcMap(v)
+		c.emitExpr(c.compileExpression(v.Expression), true)
+		c.emit(saveExprValue)
+		if needResult {
+			c.emit(saveResult)
+		} else {
+			c.emit(pop)
+		}
+		return
+	}
 	c.emitExpr(c.compileExpression(v.Expression), needResult)
 	if needResult {
 		c.emit(saveResult)
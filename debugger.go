@@ -2,189 +2,4061 @@ package goja
 
 import (
 	"bufio"
+	"container/list"
+	gocontext "context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"math"
+	"reflect"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/dop251/goja/ast"
+	"github.com/dop251/goja/file"
 	"github.com/dop251/goja/parser"
+	"github.com/dop251/goja/token"
 	"github.com/dop251/goja/unistring"
 )
 
+// Debugger controls the runtime it's attached to, and the ones added with AddVM. Its commands act on the selected
+// one, see SelectVM.
 type Debugger struct {
+	*debugSession // of the selected VM
+
+	vms      []*debugSession // by ID
+	selected int
+}
+
+// debugSession is the state of debugging a VM. The VM has a Debugger of its own pointing to it, so that selecting
+// another VM doesn't change which session the running program reports to.
+type debugSession struct {
 	vm *vm
 
-	currentLine    int
-	lastLine       int
-	breakpoints    map[string][]int
-	activationCh   chan chan ActivationReason
-	currentCh      chan ActivationReason
-	active         bool
-	lastBreakpoint struct {
+	currentLine int
+
+	// bpMu guards breakpoints, lastID, unresolved, loaded, programLines, pathMatching and muted, as breakpoints may be
+	// changed while the program runs
+	bpMu         sync.Mutex
+	breakpoints  map[string][]Breakpoint // sorted by line
+	lastID       int                     // of breakpoints
+	unresolved   []Breakpoint
+	loaded       map[string][]int              // executable lines of the files which have been run, by filename
+	programLines map[*Program]map[string][]int // executable lines of the files of the program run a program is part of
+	pathMatching PathMatchMode
+	lineOffset   int // added to the lines breakpoints are set on, see SetLineBase
+	muted        bool
+
+	hitBreakpoint    *Breakpoint                 // copy of the breakpoint found by breakpoint
+	activeBreakpoint *Breakpoint                 // copy of the breakpoint the debugger is paused at
+	skipBreakpoint   *Breakpoint                 // location of a breakpoint which shouldn't pause the next time it's reached
+	asts             map[*Program]*ast.Program   // of functions, see CurrentFunctionAST
+	fileASTs         map[*file.File]*ast.Program // see parseSource
+	activationCh     chan chan ActivationReason
+	currentCh        chan ActivationReason
+	active           bool
+	reason           ActivationReason // what the debugger is paused by
+	lastBreakpoint   struct {
 		filename   string
 		line       int
 		stackDepth int
 	}
+
+	// step is checked by the vm before each instruction while a step is in progress, it returns true once the
+	// step is complete
+	step              func() bool
+	stepLimit         int  // maximum number of instructions a step may run, 0 means unlimited
+	condLimit         int  // maximum number of instructions a breakpoint condition may run, 0 means unlimited
+	condBudget        int  // number of instructions the running condition may still run
+	condBudgeted      bool // set while a condition runs with a limit
+	condErr           error
+	stepIntoAccessors bool // whether Next enters getters and setters
+	justMyCode        bool
+	myCodePaths       []string // prefixes of the names of the files with user code
+
+	runDepth int // number of nested vm.debug() runs
+	runs     []debugRun
+
+	frameEntries []frameEntry // state of the stacks shared by the frames when they were entered, by depth
+	calls        uint64       // number of frames entered so far, see frameEntry.call
+	pauseStack   []pausedFrame
+	prevStack    []pausedFrame // pauseStack of the previous pause
+
+	mu       sync.Mutex
+	done     chan struct{} // closed when the program finishes
+	finished bool
+	err      error
+	pending  OpKind // the operation Continue is running for
+	onFinish func(result Value, err error)
+
+	events    chan Event
+	console   *capturedConsole
+	formatter func(Value) string
+
+	breakOnStart bool
+	starting     bool // set when a program starts with breakOnStart, until its first instruction
+	breakOnExit  bool
+
+	breakOnThrow   bool
+	logExceptions  bool
+	exceptionTypes map[string]bool // names of the errors to pause on, all of them if nil
+	thrown         *Exception      // the exception being thrown while paused with ExceptionActivation
+	lastThrown     *Exception      // the last exception seen by execInstruction, so it's only reported once
+
+	swallowException bool // set by ResumeSwallowingException for execInstruction
+
+	variableWatches     []*variableWatch
+	propertyBreakpoints []propertyBreakpoint // as set by SetPropertyBreakpoint, they can't be removed
+
+	globalWatches []*globalWatch
+	lastPrg       *Program          // the code of the instruction run before the current one, while globals are watched
+	lastPc        int               // the pc of that instruction
+	assignment    *GlobalAssignment // the change paused at with GlobalAssignmentActivation
+
+	lengthWatches []*lengthWatch
+	lengthPrg     *Program // the code and line the watched lengths were last checked at
+	lengthLine    int
+	lengthChange  *ArrayLengthChange // the change paused at with ArrayLengthActivation
+
+	lastResult Value // of Exec or Print
+	evalCache  evalCache
+
+	exprValue    Value // of the last expression statement run since the program was resumed
+	hasExprValue bool
+
+	onFrameEnter func(StackFrame)
+	onFrameExit  func(StackFrame, Value)
+	frameDepth   int // len(vm.callStack) as of the last traceFrames()
+
+	ctx       gocontext.Context // the session is bound to, if any
+	ctxDone   <-chan struct{}
+	stopWatch chan struct{}
+
+	asyncStacks bool
+	asyncStack  [][]StackFrame // where the running promise job was scheduled, see AsyncCallStack
+	jobs        []*queuedJob   // the promise jobs which haven't run yet, in the order they were scheduled
+
+	functionBreakpoints map[string]int // number of calls to ignore, by function name
+	callCounts          map[string]int
+	enteredFunction     *Program // function which has just been entered and has to pause
+}
+
+// EventKind is the kind of an Event.
+type EventKind string
+
+const (
+	ConsoleEvent EventKind = "console"
+	// BreakpointResolvedEvent is reported when a breakpoint is bound to the code of its file, either because the
+	// file is run for the first time (e.g. a module loaded on demand) or because the breakpoint is set once the file
+	// has been run. Its position is the one the breakpoint was resolved to.
+	BreakpointResolvedEvent EventKind = "breakpoint-resolved"
+	// ExceptionEvent is reported for every exception thrown while LogExceptions is on, whether it's caught or not.
+	// Its message is the one of the error (or the thrown value) and its position the one of the throw.
+	ExceptionEvent EventKind = "exception"
+)
+
+// Event is something the debugger reports asynchronously through Events, along with the position of the code which
+// caused it.
+type Event struct {
+	Kind       EventKind
+	Filename   string
+	Line       int
+	Message    string
+	Breakpoint int // ID of the breakpoint of a BreakpointResolvedEvent
 }
 
+const eventsBufferSize = 64
+
 func newDebugger(vm *vm) *Debugger {
-	dbg := &Debugger{
+	s := newDebugSession(vm)
+	return &Debugger{debugSession: s, vms: []*debugSession{s}}
+}
+
+func newDebugSession(vm *vm) *debugSession {
+	return &debugSession{
 		vm:           vm,
 		activationCh: make(chan chan ActivationReason),
 		active:       false,
-		breakpoints:  make(map[string][]int),
-		lastLine:     0,
+		breakpoints:  make(map[string][]Breakpoint),
+		done:         make(chan struct{}),
+		events:       make(chan Event, eventsBufferSize),
+		stepLimit:    defaultStepLimit,
+		condLimit:    defaultConditionLimit,
+		pending:      OpNone,
+	}
+}
+
+// attachSession makes vm report to s.
+func attachSession(vm *vm, s *debugSession) {
+	vm.debugMode = true // maybe don't do this?
+	vm.debugger = &Debugger{debugSession: s}
+}
+
+// Events returns the channel on which the debugger reports events. It's buffered and the events which don't fit
+// because nobody is receiving are dropped, so that the program is never blocked by it.
+func (dbg *Debugger) Events() <-chan Event {
+	return dbg.events
+}
+
+func (dbg *Debugger) emit(kind EventKind, message string) {
+	filename, line := dbg.callerPosition()
+	dbg.emitEvent(Event{Kind: kind, Filename: filename, Line: line, Message: message})
+}
+
+func (dbg *Debugger) emitEvent(ev Event) {
+	select {
+	case dbg.events <- ev:
+	default:
+	}
+}
+
+// callerPosition returns the position of the innermost frame running JS code, which is the caller when called from
+// a Go function.
+func (dbg *Debugger) callerPosition() (string, int) {
+	prg, pc := dbg.vm.prg, dbg.vm.pc
+	for i := len(dbg.vm.callStack) - 1; prg == nil && i >= 0; i-- {
+		prg, pc = dbg.vm.callStack[i].prg, dbg.vm.callStack[i].pc
+	}
+	if prg == nil || prg.src == nil {
+		return "", 0
+	}
+	pos := debugPosition(prg, pc)
+	return pos.Filename, pos.Line
+}
+
+var consoleMethods = []string{"log", "info", "warn", "error", "debug"}
+
+type capturedConsole struct {
+	obj      *Object
+	created  bool
+	original map[string]Value
+}
+
+// CaptureConsole makes the console methods (log, info, warn, error and debug) of the global console object emit
+// their output as ConsoleEvent events, with the line that produced it. The original methods are still called, if
+// there's no console one that only emits events is installed. Calling it with false restores the console.
+// It must not be called while the program is running.
+func (dbg *Debugger) CaptureConsole(enable bool) (err error) {
+	defer func() {
+		if x := recover(); x != nil {
+			err = fmt.Errorf("cannot capture the console: %v", x)
+		}
+	}()
+	r := dbg.vm.r
+	if !enable {
+		if c := dbg.console; c != nil {
+			if c.created {
+				r.globalObject.Delete("console")
+			} else {
+				for _, name := range consoleMethods {
+					c.obj.Set(name, c.original[name])
+				}
+			}
+			dbg.console = nil
+		}
+		return nil
+	}
+	if dbg.console != nil {
+		return nil
+	}
+	c := &capturedConsole{original: make(map[string]Value)}
+	if obj, ok := r.globalObject.Get("console").(*Object); ok {
+		c.obj = obj
+	} else {
+		c.obj = r.NewObject()
+		c.created = true
+	}
+	for _, name := range consoleMethods {
+		original := c.obj.Get(name)
+		c.original[name] = original
+		c.obj.Set(name, func(call FunctionCall) Value {
+			args := make([]string, len(call.Arguments))
+			for i, arg := range call.Arguments {
+				args[i] = arg.String()
+			}
+			dbg.emit(ConsoleEvent, strings.Join(args, " "))
+			if fn, ok := AssertFunction(original); ok {
+				if _, err := fn(call.This, call.Arguments...); err != nil {
+					panic(err)
+				}
+			}
+			return _undefined
+		})
+	}
+	if c.created {
+		r.globalObject.Set("console", c.obj)
 	}
-	return dbg
+	dbg.console = c
+	return nil
+}
+
+// Breakpoint is a source location at which execution pauses. It's identified by its location only, the other fields
+// are its configuration and state.
+type Breakpoint struct {
+	ID       int // unique and stable across moves of the breakpoint, it's assigned when the breakpoint is set
+	Filename string
+	Line     int
+
+	Condition   string // JS expression evaluated in the paused frame, the breakpoint only pauses if it's truthy
+	Enabled     bool
+	OncePerCall bool // pause only the first time the line is reached in each call of the function
+	HitCount    int  // number of times execution reached the breakpoint while it was enabled
+	Verified    bool // whether it's been bound to the code of its file, which may not have been run yet
+
+	cond *breakpointCondition
+}
+
+// hitsName is the name conditions can use to refer to the hit count of their breakpoint, including the current hit.
+const hitsName = "$hits"
+
+// breakpointCondition is the Condition of a breakpoint. It's parsed when the breakpoint is set and compiled when it's
+// hit, through the cache of eval: the code depends on the scope of the frame it's hit in, which may differ between
+// hits of the same function, e.g. for the methods of a class which is evaluated more than once.
+type breakpointCondition struct {
+	in *ast.Program
+
+	// the last compilation error and what it was compiled for, as failures aren't cached by eval
+	errKey evalKey
+	err    error
+}
+
+func (c *breakpointCondition) compile(dbg *Debugger, src string) (*Program, error) {
+	key := dbg.evalKey(src, dbg.vm.prg.strict)
+	if p := dbg.evalCache.get(key); p != nil {
+		return p, nil
+	}
+	if c.err != nil && c.errKey == key {
+		return nil, c.err
+	}
+	p, err := dbg.compileEval(c.in, key.strict)
+	if err != nil {
+		c.errKey, c.err = key, err
+		return nil, err
+	}
+	dbg.evalCache.put(key, p)
+	return p, nil
+}
+
+func (b Breakpoint) sameLocation(other Breakpoint) bool {
+	return b.Filename == other.Filename && b.Line == other.Line
+}
+
+// String renders the breakpoint as e.g. foo.js:42 [cond: x>0] (enabled, hits=3).
+func (b Breakpoint) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s:%d ", b.Filename, b.Line)
+	if b.Condition != "" {
+		fmt.Fprintf(&sb, "[cond: %s] ", b.Condition)
+	}
+	state := "enabled"
+	if !b.Enabled {
+		state = "disabled"
+	}
+	fmt.Fprintf(&sb, "(%s, hits=%d)", state, b.HitCount)
+	return sb.String()
 }
 
+// ErrExecTimeout is returned by ExecWithTimeout when the evaluation takes too long.
+var ErrExecTimeout = errors.New("evaluation timed out")
+
+// ErrNoProgram is returned by the commands which need a program when none is loaded.
+var ErrNoProgram = errors.New("no program loaded")
+
 type ActivationReason string
 
 const (
-	ProgramStartActivation      ActivationReason = "start"
-	DebuggerStatementActivation ActivationReason = "debugger"
-	BreakpointActivation        ActivationReason = "breakpoint"
+	ProgramStartActivation       ActivationReason = "start"
+	DebuggerStatementActivation  ActivationReason = "debugger"
+	BreakpointActivation         ActivationReason = "breakpoint"
+	StepActivation               ActivationReason = "step"
+	PropertyAccessActivation     ActivationReason = "property"
+	GlobalAssignmentActivation   ActivationReason = "global"
+	ArrayLengthActivation        ActivationReason = "array-length"
+	FunctionBreakpointActivation ActivationReason = "function"
+	ExitActivation               ActivationReason = "exit"
+	ExceptionActivation          ActivationReason = "exception"
+	ProgramEndActivation         ActivationReason = "end"
 )
 
 var globalBuiltinKeys = map[string]bool{"Object": true, "Function": true, "Array": true, "String": true, "globalThis": true, "NaN": true, "undefined": true, "Infinity": true, "isNaN": true, "parseInt": true, "parseFloat": true, "isFinite": true, "decodeURI": true, "decodeURIComponent": true, "encodeURI": true, "encodeURIComponent": true, "escape": true, "unescape": true, "Number": true, "RegExp": true, "Date": true, "Boolean": true, "Proxy": true, "Reflect": true, "Error": true, "AggregateError": true, "TypeError": true, "ReferenceError": true, "SyntaxError": true, "RangeError": true, "EvalError": true, "URIError": true, "GoError": true, "eval": true, "Math": true, "JSON": true, "ArrayBuffer": true, "DataView": true, "Uint8Array": true, "Uint8ClampedArray": true, "Int8Array": true, "Uint16Array": true, "Int16Array": true, "Uint32Array": true, "Int32Array": true, "Float32Array": true, "Float64Array": true, "Symbol": true, "WeakSet": true, "WeakMap": true, "Map": true, "Set": true, "Promise": true}
 
 func (dbg *Debugger) activate(reason ActivationReason) {
+	dbg.prevStack, dbg.pauseStack = dbg.pauseStack, dbg.stackSnapshot()
 	dbg.active = true
-	ch := <-dbg.activationCh // get channel from waiter
-	ch <- reason             // send what activated it
-	<-ch                     // wait for deactivation
+	dbg.reason = reason
+	dbg.step = nil // whatever the reason, a step in progress is over
+	var ch chan ActivationReason
+	select {
+	case ch = <-dbg.activationCh: // get channel from waiter
+	case <-dbg.ctxDone:
+		// the watcher does the same, but it might be too late
+		dbg.vm.Interrupt(dbg.ctx.Err())
+		dbg.active = false
+		return
+	}
+	if reason == BreakpointActivation && dbg.hitBreakpoint != nil {
+		bp := *dbg.hitBreakpoint
+		dbg.activeBreakpoint = &bp
+	}
+	ch <- reason // send what activated it
+	select {
+	case <-ch: // wait for deactivation
+	case <-dbg.ctxDone:
+		dbg.vm.Interrupt(dbg.ctx.Err())
+	}
 	dbg.active = false
+	dbg.reason = ""
+	dbg.exprValue, dbg.hasExprValue = nil, false
+	dbg.activeBreakpoint = nil
+	dbg.assignment = nil
+	dbg.lengthChange = nil
+	// changes made while paused, e.g. by Exec, aren't reported
+	for _, w := range dbg.globalWatches {
+		w.last = dbg.peekGlobal(w.name)
+	}
+	for _, w := range dbg.lengthWatches {
+		w.last = arrayLength(w.arr)
+	}
+}
+
+// debugRun is where a vm.debug() run started.
+type debugRun struct {
+	prg   *Program
+	pc    int
+	depth int // len(vm.callStack)
+}
+
+// isTry reports whether the run is the one of a try block which has a catch clause.
+func (r debugRun) isTry() bool {
+	if r.prg == nil || r.pc <= 0 || r.pc > len(r.prg.code) {
+		return false
+	}
+	t, ok := r.prg.code[r.pc-1].(try)
+	return ok && t.catchOffset > 0
+}
+
+type frameEntry struct {
+	prg             *Program
+	iterLen, refLen int
+	fired           map[int]bool // IDs of the OncePerCall breakpoints which paused in the call
+	call            uint64       // unique to the call
+}
+
+// start is called by the vm when the outermost run of a program begins.
+func (dbg *Debugger) start() {
+	dbg.mu.Lock()
+	defer dbg.mu.Unlock()
+	if dbg.finished {
+		dbg.finished = false
+		dbg.err = nil
+		dbg.done = make(chan struct{})
+	}
+	dbg.starting = dbg.breakOnStart
+	// no frame is running, the global code is a new call too
+	dbg.frameEntries = dbg.frameEntries[:0]
+}
+
+// SetBreakOnStart makes programs pause (with ProgramStartActivation) before their first instruction, so that they
+// can be stepped through from the start without a breakpoint on their first line.
+func (dbg *Debugger) SetBreakOnStart(enable bool) {
+	dbg.breakOnStart = enable
+}
+
+func (dbg *Debugger) atStart() bool {
+	if !dbg.starting {
+		return false
+	}
+	dbg.starting = false
+	return !dbg.active && dbg.safeToRun()
+}
+
+// pausedOnLine records the current line as the one of the last breakpoint, so that a breakpoint on the line the
+// program has just paused at for its start doesn't pause it again.
+func (dbg *Debugger) pausedOnLine() {
+	dbg.lastBreakpoint.filename = dbg.Filename()
+	dbg.lastBreakpoint.line = dbg.Line()
+	dbg.lastBreakpoint.stackDepth = dbg.callStackDepth()
+}
+
+// SetBreakOnExit makes the program pause (with ExitActivation) right before it ends, so that its final state can be
+// inspected. This includes ending because of an uncaught exception: the program pauses where the exception was
+// thrown, and Err already returns it.
+func (dbg *Debugger) SetBreakOnExit(enable bool) {
+	dbg.breakOnExit = enable
+}
+
+// SetExceptionBreakpoint makes the program pause (with ExceptionActivation) whenever an exception is thrown, whether
+// it's caught or not, before it starts unwinding. PendingException returns the exception being thrown.
+func (dbg *Debugger) SetExceptionBreakpoint(enable bool) {
+	dbg.breakOnThrow = enable
+	dbg.exceptionTypes = nil
+}
+
+// LogExceptions sets whether every exception thrown, caught or not, is reported as an ExceptionEvent. Unlike the
+// exception breakpoint it never pauses, which helps finding the exceptions swallowed by catch blocks.
+func (dbg *Debugger) LogExceptions(enable bool) {
+	dbg.logExceptions = enable
+}
+
+// SetExceptionBreakpointForTypes is like SetExceptionBreakpoint but only pauses for the exceptions whose name
+// property is one of types, e.g. "TypeError". Passing no types disables the exception breakpoint.
+func (dbg *Debugger) SetExceptionBreakpointForTypes(types []string) {
+	dbg.breakOnThrow = len(types) > 0
+	dbg.exceptionTypes = make(map[string]bool, len(types))
+	for _, t := range types {
+		dbg.exceptionTypes[t] = true
+	}
+}
+
+// PendingException returns the exception being thrown when paused with ExceptionActivation, nil otherwise.
+func (dbg *Debugger) PendingException() *Exception {
+	return dbg.thrown
+}
+
+// ResumeSwallowingException resumes execution after a pause on an exception as if the throw statement which threw it
+// hadn't been run: the exception is dropped and execution goes on with what follows the statement. Only exceptions
+// thrown by a throw statement of the paused code can be swallowed, not the ones thrown by operations or native
+// functions. This is meant for experimenting and is dangerous: the code following a throw statement isn't written to
+// be reached, e.g. a function may return undefined where it never could otherwise. If the program ends before it
+// pauses again the error it finished with is returned, or an error saying it halted.
+func (dbg *Debugger) ResumeSwallowingException() error {
+	if dbg.thrown == nil {
+		return errors.New("not paused on an exception")
+	}
+	if prg := dbg.vm.prg; prg == nil || dbg.vm.pc < 0 || dbg.vm.pc >= len(prg.code) || prg.code[dbg.vm.pc] != throw {
+		return errors.New("the exception isn't thrown by a throw statement")
+	}
+	dbg.swallowException = true
+	if dbg.Continue() == ProgramEndActivation {
+		return dbg.endError()
+	}
+	return nil
+}
+
+// InTryBlock reports whether the current instruction is in the try block of a try statement with a catch clause,
+// either in the current function or in one of its callers, that is whether an exception thrown from here would be
+// caught by JS code. Exceptions may still be caught by native code in between, like a promise executor.
+func (dbg *Debugger) InTryBlock() bool {
+	for i := len(dbg.runs) - 1; i >= 0; i-- {
+		if dbg.runs[i].isTry() {
+			return true
+		}
+	}
+	return false
+}
+
+// execInstruction executes the current instruction like the vm does, pausing if it throws an exception the
+// exception breakpoint is set for. The state of the vm is still the one of the throwing instruction at that point.
+func (dbg *Debugger) execInstruction() {
+	vm := dbg.vm
+	defer func() {
+		x := recover()
+		if x == nil {
+			return
+		}
+		ex := vm.exceptionFromPanic(x)
+		if ex == nil {
+			panic(x)
+		}
+		// the same exception goes through the nested runs it's propagated out of, the converted one is re-panicked
+		// so that it can be recognised
+		if ex != dbg.lastThrown {
+			dbg.lastThrown = ex
+			if dbg.logExceptions {
+				dbg.emit(ExceptionEvent, thrownMessage(ex))
+			}
+			if dbg.breakOnThrow && !dbg.active && dbg.matchesException(ex) {
+				dbg.pauseOnException(ex)
+				if dbg.swallowException {
+					// skip the throw instruction, dropping the value it throws
+					dbg.swallowException = false
+					vm.sp--
+					vm.pc++
+					return
+				}
+			}
+		}
+		panic(ex)
+	}()
+	vm.prg.code[vm.pc].exec(vm)
+}
+
+func (dbg *Debugger) matchesException(ex *Exception) bool {
+	if dbg.exceptionTypes == nil {
+		return true
+	}
+	obj, ok := ex.val.(*Object)
+	if !ok {
+		return false
+	}
+	var name Value
+	if e := dbg.vm.try(func() {
+		name = obj.self.getStr("name", nil)
+	}); e != nil || name == nil {
+		return false
+	}
+	return dbg.exceptionTypes[name.String()]
+}
+
+func (dbg *Debugger) pauseOnException(ex *Exception) {
+	vm := dbg.vm
+	if vm.prg == nil && len(vm.callStack) > 0 {
+		// thrown by a native function, pause in its caller
+		var native context
+		vm.saveCtx(&native)
+		vm.restoreCtx(&vm.callStack[len(vm.callStack)-1])
+		defer vm.restoreCtx(&native)
+	}
+	dbg.thrown = ex
+	dbg.activate(ExceptionActivation)
+	dbg.thrown = nil
+}
+
+// atExit reports whether the program is about to end and should pause before that.
+func (dbg *Debugger) atExit() bool {
+	if !dbg.breakOnExit || dbg.active || dbg.runDepth != 1 || !dbg.safeToRun() {
+		return false
+	}
+	_, ok := dbg.vm.prg.code[dbg.vm.pc].(_halt)
+	return ok
+}
+
+func (dbg *Debugger) setErr(err error) {
+	dbg.mu.Lock()
+	defer dbg.mu.Unlock()
+	dbg.err = err
+}
+
+// finish is called by the vm when the outermost run of the program is over, err is the uncaught exception (or
+// other error) it ended with, if any.
+func (dbg *Debugger) finish(result Value, err error) {
+	dbg.mu.Lock()
+	if dbg.finished {
+		dbg.mu.Unlock()
+		return
+	}
+	dbg.finished = true
+	dbg.err = err
+	close(dbg.done)
+	onFinish := dbg.onFinish
+	dbg.mu.Unlock()
+	if onFinish != nil {
+		if err != nil {
+			result = nil
+		}
+		onFinish(result, err)
+	}
+}
+
+// OnFinish registers f to be called on the vm goroutine once the program completes, with its final value, or with
+// the error if it ended with an uncaught exception. Passing nil unregisters it.
+func (dbg *Debugger) OnFinish(f func(result Value, err error)) {
+	dbg.mu.Lock()
+	dbg.onFinish = f
+	dbg.mu.Unlock()
+}
+
+func (dbg *Debugger) isFinished() bool {
+	dbg.mu.Lock()
+	defer dbg.mu.Unlock()
+	return dbg.finished
+}
+
+// Err returns the error the program finished with, like an uncaught exception. It's nil while the program is running
+// or if it completed normally.
+func (dbg *Debugger) Err() error {
+	dbg.mu.Lock()
+	defer dbg.mu.Unlock()
+	return dbg.err
 }
 
 // Continue unblocks the goja runtime to run code as is and will return the reason why it blocked again.
+// If the program finishes instead ProgramEndActivation is returned, see Err for the error it finished with.
+// Unlike the other commands it doesn't fail if no program is loaded: it waits for one to be run, which is how a
+// debugger is usually started.
 func (dbg *Debugger) Continue() ActivationReason {
-	if dbg.currentCh != nil {
-		close(dbg.currentCh)
-	}
-	dbg.currentCh = make(chan ActivationReason)
-	dbg.activationCh <- dbg.currentCh
-	reason := <-dbg.currentCh
-	return reason
+	return dbg.resume(OpContinue)
 }
 
-func (dbg *Debugger) PC() int {
-	return dbg.vm.pc
+// LastExpressionValue returns the value of the last expression statement run since the program was last resumed, by
+// Continue or a step, e.g. 5 after stepping over "2 + 3;" or the return value of a function called by a statement
+// like "foo();". It's only recorded for code compiled in debug mode.
+func (dbg *Debugger) LastExpressionValue() (Value, bool) {
+	return dbg.exprValue, dbg.hasExprValue
 }
 
-// Detach the debugger, after this call this instance of the debugger should *not* be used.
-// This also disables debug mode for the runtime
-func (dbg *Debugger) Detach() { // TODO return an error?
-	dbg.vm.debugger = nil
-	dbg.vm.debugMode = false
-	dbg.vm = nil
-	dbg.active = false
+// resume is Continue for the operation op, see PendingOperation.
+func (dbg *Debugger) resume(op OpKind) ActivationReason {
+	dbg.mu.Lock()
+	dbg.pending = op
+	dbg.mu.Unlock()
 	if dbg.currentCh != nil {
 		close(dbg.currentCh)
 		dbg.currentCh = nil
 	}
+	dbg.mu.Lock()
+	done := dbg.done
+	dbg.mu.Unlock()
+	defer func() {
+		dbg.mu.Lock()
+		dbg.pending = OpNone
+		dbg.mu.Unlock()
+	}()
+	ch := make(chan ActivationReason)
+	select {
+	case dbg.activationCh <- ch:
+		dbg.currentCh = ch
+		return <-ch
+	case <-done:
+		return ProgramEndActivation
+	case <-dbg.ctxDone:
+		return ProgramEndActivation
+	}
 }
 
-func (dbg *Debugger) SetBreakpoint(filename string, line int) (err error) {
-	idx := sort.SearchInts(dbg.breakpoints[filename], line)
-	if idx < len(dbg.breakpoints[filename]) && dbg.breakpoints[filename][idx] == line {
-		err = errors.New("breakpoint exists")
-	} else {
-		dbg.breakpoints[filename] = append(dbg.breakpoints[filename], line)
-		if len(dbg.breakpoints[filename]) > 1 {
-			sort.Ints(dbg.breakpoints[filename])
-		}
+// SetPropertyBreakpoint makes the program pause when the property prop of the object objExpr evaluates to (in the
+// current frame) is read, if onGet is set, or written, if onSet is set. The object is resolved once, so this keeps
+// working on that object whatever objExpr refers to later.
+// Note that this replaces the property descriptor with an accessor property which keeps its value (or calls the
+// original accessors), so the property isn't writable any more as far as Object.getOwnPropertyDescriptor is concerned.
+// Non-configurable properties can't be replaced.
+func (dbg *Debugger) SetPropertyBreakpoint(objExpr, prop string, onGet, onSet bool) error {
+	if !onGet && !onSet {
+		return errors.New("nothing to break on")
+	}
+	v, err := dbg.Exec(objExpr)
+	if err != nil {
+		return err
+	}
+	obj, ok := v.(*Object)
+	if !ok {
+		return fmt.Errorf("%s is not an object", objExpr)
 	}
-	return
-}
 
-func (dbg *Debugger) ClearBreakpoint(filename string, line int) (err error) {
-	if len(dbg.breakpoints[filename]) == 0 {
-		return errors.New("no breakpoints")
+	r := dbg.vm.r
+	var get func(this Value) Value
+	var set func(this, v Value)
+	enumerable := FLAG_TRUE
+	switch p := obj.self.getOwnPropStr(unistring.NewFromString(prop)).(type) {
+	case *valueProperty:
+		if !p.enumerable {
+			enumerable = FLAG_FALSE
+		}
+		if p.accessor {
+			get, set = p.get, p.set
+			break
+		}
+		value := p.value
+		get = func(Value) Value { return value }
+		set = func(_, v Value) { value = v }
+	case nil:
+		var value Value = _undefined
+		get = func(Value) Value { return value }
+		set = func(_, v Value) { value = v }
+	default:
+		value := Value(p)
+		get = func(Value) Value { return value }
+		set = func(_, v Value) { value = v }
 	}
 
-	idx := sort.SearchInts(dbg.breakpoints[filename], line)
-	if idx < len(dbg.breakpoints[filename]) && dbg.breakpoints[filename][idx] == line {
-		dbg.breakpoints[filename] = append(dbg.breakpoints[filename][:idx], dbg.breakpoints[filename][idx+1:]...)
-		if len(dbg.breakpoints[filename]) == 0 {
-			delete(dbg.breakpoints, filename)
+	getter := r.ToValue(func(call FunctionCall) Value {
+		if onGet {
+			dbg.propertyAccess()
 		}
-	} else {
-		err = errors.New("breakpoint doesn't exist")
+		return get(call.This)
+	})
+	setter := r.ToValue(func(call FunctionCall) Value {
+		set(call.This, call.Argument(0))
+		if onSet {
+			dbg.propertyAccess()
+		}
+		return _undefined
+	})
+	if err := obj.DefineAccessorProperty(prop, getter, setter, FLAG_TRUE, enumerable); err != nil {
+		return err
 	}
-	return
+	dbg.propertyBreakpoints = append(dbg.propertyBreakpoints, propertyBreakpoint{
+		objExpr: objExpr,
+		prop:    prop,
+		onGet:   onGet,
+		onSet:   onSet,
+	})
+	return nil
 }
 
-func (dbg *Debugger) Breakpoints() (map[string][]int, error) {
-	if len(dbg.breakpoints) == 0 {
-		return nil, errors.New("no breakpoints")
+type propertyBreakpoint struct {
+	objExpr, prop string
+	onGet, onSet  bool
+}
+
+// propertyAccess is called on the vm goroutine by the accessors installed by SetPropertyBreakpoint. It doesn't pause
+// if the access is made by the debugger itself or by Go code while no program is running.
+func (dbg *Debugger) propertyAccess() {
+	if dbg.runDepth > 0 && !dbg.active {
+		dbg.activate(PropertyAccessActivation)
 	}
+}
 
-	return dbg.breakpoints, nil
+// DebugState is the state of the program at a pause, as recorded by RunCollectingPauses.
+type DebugState struct {
+	Reason   ActivationReason
+	Filename string
+	Line     int
+	Stack    []StackFrame  // see CallStack
+	Scope    ScopeSnapshot // see CaptureScope
 }
 
-func (dbg *Debugger) StepIn() error {
-	// TODO: implement proper error propagation
-	lastLine := dbg.Line()
-	dbg.updateCurrentLine()
-	if dbg.safeToRun() {
-		dbg.updateCurrentLine()
-		dbg.vm.prg.code[dbg.vm.pc].exec(dbg.vm)
-		dbg.updateLastLine(lastLine)
-	} else if dbg.vm.halt {
-		return errors.New("halted")
+// RunCollectingPauses runs the program to completion like calling Continue until it returns ProgramEndActivation,
+// recording the state of the program at each pause instead of waiting for commands. It's meant for analysing runs
+// without a user, the error the program finished with is returned by Err. If the debugger is paused when it's
+// called that pause isn't recorded, as the caller has seen it already.
+func (dbg *Debugger) RunCollectingPauses() []DebugState {
+	var states []DebugState
+	for {
+		reason := dbg.Continue()
+		if reason == ProgramEndActivation {
+			return states
+		}
+		states = append(states, DebugState{
+			Reason:   reason,
+			Filename: dbg.Filename(),
+			Line:     dbg.Line(),
+			Stack:    dbg.CallStack(CallStackOptions{}),
+			Scope:    dbg.CaptureScope(),
+		})
 	}
-	return nil
 }
 
-func (dbg *Debugger) Next() error {
-	// TODO: implement proper error propagation
-	lastLine := dbg.Line()
-	dbg.updateCurrentLine()
-	if dbg.getLastLine() != dbg.Line() {
-		nextLine := dbg.getNextLine()
-		for dbg.safeToRun() && nextLine > 0 && dbg.Line() != nextLine {
-			dbg.updateCurrentLine()
-			dbg.vm.prg.code[dbg.vm.pc].exec(dbg.vm)
-		}
-		dbg.updateLastLine(lastLine)
-	} else if dbg.getNextLine() == 0 {
-		// Step out of functions
-		return errors.New("exhausted")
-	} else if dbg.vm.halt {
-		// Step out of program
-		return errors.New("halted")
+// OpKind is the kind of a debugger operation which lets the program run.
+type OpKind string
+
+const (
+	OpNone     OpKind = "none"
+	OpContinue OpKind = "continue" // Continue and its variants, which run until something pauses the program
+	OpStep     OpKind = "step"     // any kind of step
+)
+
+// PendingOperation returns the operation the program is running for, or OpNone if there isn't any, e.g. because the
+// debugger is paused. It's safe to call from any goroutine, so that a UI can tell whether another command can be
+// issued: the commands which run the program, or inspect or change its state, mustn't be used while an operation is
+// pending.
+func (dbg *Debugger) PendingOperation() OpKind {
+	dbg.mu.Lock()
+	defer dbg.mu.Unlock()
+	return dbg.pending
+}
+
+// ContinueSkippingCurrent resumes execution like Continue, but the breakpoint the debugger is paused at doesn't
+// pause the next time it's reached, only the times after that. Err is set if the debugger isn't paused at a
+// breakpoint or if the program ended.
+func (dbg *Debugger) ContinueSkippingCurrent() Result {
+	bp, ok := dbg.ActiveBreakpoint()
+	if !ok {
+		return Result{Err: errors.New("not paused at a breakpoint")}
 	}
-	return nil
+	dbg.skipBreakpoint = &bp
+	if dbg.Continue() == ProgramEndActivation {
+		dbg.skipBreakpoint = nil
+		return Result{Err: dbg.endError()}
+	}
+	return Result{}
 }
 
-func (dbg *Debugger) Exec(expr string) (Value, error) {
-	if expr == "" {
-		return nil, errors.New("nothing to execute")
+// runStep lets the vm run until the step set in dbg.step is complete or something else pauses it. It returns the
+// error the program finished with if it ended during the step.
+func (dbg *Debugger) runStep() (ActivationReason, error) {
+	if step := dbg.step; step != nil && dbg.justMyCode {
+		dbg.step = func() bool {
+			return step() && dbg.inMyCode()
+		}
+	}
+	exceeded := false
+	if step, limit := dbg.step, dbg.stepLimit; step != nil && limit > 0 {
+		count := 0
+		dbg.step = func() bool {
+			if count++; count > limit {
+				exceeded = true
+				return true
+			}
+			return step()
+		}
+	}
+	reason := dbg.resume(OpStep)
+	if reason == ProgramEndActivation {
+		dbg.step = nil
+		return reason, dbg.endError()
 	}
-	val, err := dbg.eval(expr)
+	if exceeded {
+		return reason, ErrStepLimit
+	}
+	return reason, nil
+}
 
-	lastLine := dbg.Line()
-	dbg.updateLastLine(lastLine)
-	return val, err
+// SetJustMyCode makes the stepping commands only pause in user code, that is in the files added with AddMyCodePath:
+// a step which would end in other code (a library or a native function) goes on until it reaches user code. With no
+// path added all the code counts as user code.
+func (dbg *Debugger) SetJustMyCode(enable bool) {
+	dbg.justMyCode = enable
 }
 
-func (dbg *Debugger) Print(varName string) (string, error) {
-	if varName == "" {
-		return "", errors.New("please specify variable name")
+// AddMyCodePath adds the files whose name starts with prefix to the user code, see SetJustMyCode.
+func (dbg *Debugger) AddMyCodePath(prefix string) {
+	dbg.myCodePaths = append(dbg.myCodePaths, prefix)
+}
+
+// inMyCode reports whether the current instruction is user code.
+func (dbg *Debugger) inMyCode() bool {
+	if len(dbg.myCodePaths) == 0 {
+		return true
 	}
-	val, err := dbg.getValue(varName)
+	if dbg.vm.prg == nil {
+		return false
+	}
+	filename := dbg.Filename()
+	for _, prefix := range dbg.myCodePaths {
+		if strings.HasPrefix(filename, prefix) {
+			return true
+		}
+	}
+	return false
+}
 
-	if val == Undefined() {
-		return fmt.Sprint(dbg.vm.prg.values), err
-	} else {
-		// FIXME: val.ToString() causes debugger to exit abruptly
-		return fmt.Sprint(val), err
+// ErrStepLimit is returned by the stepping commands when the step runs more instructions than allowed by
+// SetStepLimit without completing. The debugger is paused wherever the limit was reached.
+var ErrStepLimit = errors.New("step limit exceeded")
+
+const defaultStepLimit = 100000000
+
+// SetStepLimit sets the maximum number of instructions StepIn, Next and StepToReturn may run before giving up with
+// ErrStepLimit, which keeps a step that can't complete (e.g. stepping over a call which never returns) from hanging.
+// A limit of 0 or less disables it.
+func (dbg *Debugger) SetStepLimit(n int) {
+	dbg.stepLimit = n
+}
+
+// ErrConditionLimit is the error of a breakpoint condition which ran more instructions than allowed by
+// SetConditionLimit, see LastConditionError.
+var ErrConditionLimit = errors.New("condition instruction limit exceeded")
+
+const defaultConditionLimit = 1000000
+
+// SetConditionLimit sets the maximum number of instructions the condition of a breakpoint may run, including the
+// functions it calls, so that one which loops forever doesn't hang the program. A condition going over it is
+// stopped and doesn't pause, like one which throws, and ErrConditionLimit is recorded for LastConditionError. A limit
+// of 0 or less disables it.
+func (dbg *Debugger) SetConditionLimit(n int) {
+	dbg.condLimit = n
+}
+
+// LastConditionError returns the error of the last breakpoint condition which failed to evaluate, because it
+// threw, didn't compile or went over the limit set with SetConditionLimit. It's nil if none has failed.
+func (dbg *Debugger) LastConditionError() error {
+	dbg.mu.Lock()
+	defer dbg.mu.Unlock()
+	return dbg.condErr
+}
+
+func (dbg *Debugger) setConditionError(bp *Breakpoint, err error) {
+	dbg.mu.Lock()
+	dbg.condErr = fmt.Errorf("condition of breakpoint %d at %s:%d: %w", bp.ID, bp.Filename, bp.Line, err)
+	dbg.mu.Unlock()
+}
+
+// runCondition runs the code of a condition compiled by compileEval in the current frame, within the limit set with
+// SetConditionLimit.
+func (dbg *Debugger) runCondition(code *Program) (Value, error) {
+	if dbg.condLimit <= 0 {
+		return dbg.runEval(code)
+	}
+	dbg.condBudget, dbg.condBudgeted = dbg.condLimit, true
+	defer func() {
+		dbg.condBudgeted = false
+	}()
+	return dbg.runEvalWith(code, dbg.runBudgeted)
+}
+
+// runBudgeted is vm.run counting the instructions against the budget of the running condition. The functions called
+// by native ones run with vm.debug(), which counts them in traceFrames.
+func (dbg *Debugger) runBudgeted() {
+	vm := dbg.vm
+	vm.halt = false
+	for !vm.halt {
+		if atomic.LoadUint32(&vm.interrupted) != 0 {
+			vm.run() // which stops with the InterruptedError right away
+			return
+		}
+		dbg.spendConditionBudget()
+		vm.prg.code[vm.pc].exec(vm)
+	}
+}
+
+func (dbg *Debugger) spendConditionBudget() {
+	if dbg.condBudget--; dbg.condBudget < 0 {
+		panic(&uncatchableException{err: ErrConditionLimit})
+	}
+}
+
+func (dbg *Debugger) endError() error {
+	if err := dbg.Err(); err != nil {
+		return err
+	}
+	return errors.New("halted")
+}
+
+func (dbg *Debugger) stepDone() bool {
+	return dbg.step != nil && dbg.step()
+}
+
+func (dbg *Debugger) PC() int {
+	return dbg.vm.pc
+}
+
+// PCForLine returns the first pc at which a breakpoint on the given line would pause, the inverse of Line. Like the
+// value of PC it's relative to the current program, which only has the code of the current function (or of the
+// global code) and not of the functions defined in it, so their lines aren't found.
+func (dbg *Debugger) PCForLine(filename string, line int) (int, bool) {
+	prg := dbg.vm.prg
+	if prg == nil {
+		return 0, false
+	}
+	at := func(pc int) bool {
+		pos := debugPosition(prg, pc)
+		return pos.Line == line && pos.Filename == filename
+	}
+	// see breakableAt
+	for _, pc := range prg.loopTests {
+		if at(pc) {
+			return pc, true
+		}
+	}
+	for pc := range prg.code {
+		if at(pc) {
+			return pc, true
+		}
+	}
+	return 0, false
+}
+
+// Detach the debugger, after this call this instance of the debugger should *not* be used.
+// This also disables debug mode for the runtime, and for the ones added with AddVM.
+func (dbg *Debugger) Detach() { // TODO return an error?
+	for _, s := range dbg.vms {
+		if s.vm == nil {
+			continue
+		}
+		d := &Debugger{debugSession: s}
+		d.detachVM()
+		s.vm = nil
+		s.active = false
+		if s.currentCh != nil {
+			close(s.currentCh)
+			s.currentCh = nil
+		}
+	}
+}
+
+// AddVM attaches the debugger to another runtime, e.g. a worker spawned by the program, and returns the ID to select
+// it by. The runtime the debugger was attached to has ID 0. Each runtime has its own breakpoints, settings and
+// Continue cycle, as its programs run on a goroutine of their own. It fails if a debugger is already attached to r.
+func (dbg *Debugger) AddVM(r *Runtime) (int, error) {
+	if r.vm.debugger != nil {
+		return 0, errors.New("a debugger is already attached to the runtime")
+	}
+	s := newDebugSession(r.vm)
+	attachSession(r.vm, s)
+	dbg.vms = append(dbg.vms, s)
+	return len(dbg.vms) - 1, nil
+}
+
+// SelectVM selects the runtime the commands act on by its ID, see AddVM. It mustn't be called while another command
+// runs, e.g. while Continue waits for the selected runtime to pause.
+func (dbg *Debugger) SelectVM(id int) error {
+	if id < 0 || id >= len(dbg.vms) {
+		return fmt.Errorf("no VM with ID %d", id)
+	}
+	dbg.debugSession, dbg.selected = dbg.vms[id], id
+	return nil
+}
+
+// SelectedVM returns the ID of the runtime the commands act on.
+func (dbg *Debugger) SelectedVM() int {
+	return dbg.selected
+}
+
+func (dbg *Debugger) detachVM() {
+	dbg.vm.debugger = nil
+	dbg.vm.debugMode = false
+	if dbg.stopWatch != nil {
+		close(dbg.stopWatch)
+		dbg.stopWatch = nil
+	}
+}
+
+// watch binds the session to ctx, see Runtime.AttachDebuggerWithContext.
+func (dbg *Debugger) watch(ctx gocontext.Context) {
+	dbg.ctx, dbg.ctxDone = ctx, ctx.Done()
+	dbg.stopWatch = make(chan struct{})
+	vm, stop := dbg.vm, dbg.stopWatch
+	go func() {
+		select {
+		case <-ctx.Done():
+			vm.Interrupt(ctx.Err())
+		case <-stop:
+		}
+	}()
+}
+
+// cancelled reports whether the context the session is bound to is done.
+func (dbg *Debugger) cancelled() bool {
+	select {
+	case <-dbg.ctxDone:
+		return true
+	default:
+		return false
+	}
+}
+
+// SetLineBase sets whether the lines passed to the methods setting, changing or clearing a breakpoint on a line are
+// 0 or 1-based, the default being 1. The lines are translated to the 1-based ones of the code, which the rest of the
+// API uses, including the Line of a Breakpoint.
+func (dbg *Debugger) SetLineBase(base int) error {
+	if base != 0 && base != 1 {
+		return fmt.Errorf("invalid line base %d", base)
+	}
+	dbg.bpMu.Lock()
+	dbg.lineOffset = 1 - base
+	dbg.bpMu.Unlock()
+	return nil
+}
+
+// SetBreakpoint sets a breakpoint on the given line and returns its ID. If there is one already on that line it's
+// made unconditional and enabled, and keeps its ID. It fails if the line is before the first one, see SetLineBase.
+func (dbg *Debugger) SetBreakpoint(filename string, line int) (id int, err error) {
+	return dbg.setBreakpoint(Breakpoint{Filename: filename, Line: line, Enabled: true})
+}
+
+// SetConditionalBreakpoint sets a breakpoint on the given line which only pauses when condition evaluates to a truthy
+// value in the paused frame. A condition which throws doesn't pause. The condition can refer to the hit count of the
+// breakpoint, including the current hit, as $hits unless the frame has a variable with that name. If there is a
+// breakpoint on that line already its condition is replaced.
+func (dbg *Debugger) SetConditionalBreakpoint(filename string, line int, condition string) (int, error) {
+	if condition == "" {
+		return 0, errors.New("empty condition")
+	}
+	in, err := parseEval(condition)
+	if err != nil {
+		return 0, err
+	}
+	return dbg.setBreakpoint(Breakpoint{Filename: filename, Line: line, Condition: condition, Enabled: true, cond: &breakpointCondition{in: in}})
+}
+
+// SetBreakpointEnabled enables or disables the breakpoint on the given line, a disabled breakpoint is kept but never
+// pauses.
+func (dbg *Debugger) SetBreakpointEnabled(filename string, line int, enabled bool) error {
+	dbg.bpMu.Lock()
+	defer dbg.bpMu.Unlock()
+	idx, found := dbg.findBreakpoint(Breakpoint{Filename: filename, Line: line + dbg.lineOffset})
+	if !found {
+		return errors.New("breakpoint doesn't exist")
+	}
+	dbg.breakpoints[filename][idx].Enabled = enabled
+	return nil
+}
+
+// SetBreakpointOncePerCall sets whether the breakpoint on the given line only pauses the first time the line is
+// reached in each call of its function, rather than on every iteration of a loop. The global code of a program
+// counts as one call.
+func (dbg *Debugger) SetBreakpointOncePerCall(filename string, line int, once bool) error {
+	dbg.bpMu.Lock()
+	defer dbg.bpMu.Unlock()
+	idx, found := dbg.findBreakpoint(Breakpoint{Filename: filename, Line: line + dbg.lineOffset})
+	if !found {
+		return errors.New("breakpoint doesn't exist")
+	}
+	dbg.breakpoints[filename][idx].OncePerCall = once
+	return nil
+}
+
+// MuteBreakpoints stops all the breakpoints, including the function ones, from pausing while mute is true, without
+// changing whether each of them is enabled, like the toggle deactivating all the breakpoints of an editor. Muted
+// breakpoints don't count hits. It can be called while the program runs.
+func (dbg *Debugger) MuteBreakpoints(mute bool) {
+	dbg.bpMu.Lock()
+	dbg.muted = mute
+	dbg.bpMu.Unlock()
+}
+
+// BreakpointsMuted reports whether the breakpoints are muted, see MuteBreakpoints.
+func (dbg *Debugger) BreakpointsMuted() bool {
+	dbg.bpMu.Lock()
+	defer dbg.bpMu.Unlock()
+	return dbg.muted
+}
+
+// SetBreakpointEnabledByID is like SetBreakpointEnabled for the breakpoint with the given ID.
+func (dbg *Debugger) SetBreakpointEnabledByID(id int, enabled bool) error {
+	dbg.bpMu.Lock()
+	defer dbg.bpMu.Unlock()
+	filename, idx, found := dbg.findBreakpointByID(id)
+	if !found {
+		return errors.New("breakpoint doesn't exist")
+	}
+	dbg.breakpoints[filename][idx].Enabled = enabled
+	return nil
+}
+
+// ClearBreakpointByID removes the breakpoint with the given ID.
+func (dbg *Debugger) ClearBreakpointByID(id int) error {
+	dbg.bpMu.Lock()
+	defer dbg.bpMu.Unlock()
+	filename, idx, found := dbg.findBreakpointByID(id)
+	if !found {
+		return errors.New("breakpoint doesn't exist")
+	}
+	return dbg.clearBreakpoint(filename, dbg.breakpoints[filename][idx].Line)
+}
+
+func (dbg *Debugger) findBreakpointByID(id int) (filename string, idx int, found bool) {
+	for filename, bps := range dbg.breakpoints {
+		for idx, bp := range bps {
+			if bp.ID == id {
+				return filename, idx, true
+			}
+		}
+	}
+	return "", 0, false
+}
+
+// PathMatchMode is how the filename of a breakpoint is matched against the names of the files being run.
+type PathMatchMode string
+
+const (
+	ExactPathMatch    PathMatchMode = "exact"    // the names are the same
+	SuffixPathMatch   PathMatchMode = "suffix"   // either name ends with the other one, e.g. /src/lib/foo.js and lib/foo.js
+	BasenamePathMatch PathMatchMode = "basename" // the last elements of the names are the same
+)
+
+// SetPathMatching sets how the filenames of breakpoints are matched against the names the files being run were
+// compiled with, which is exact by default. Editors usually use absolute paths while scripts may be compiled with
+// short names, or the other way round. Breakpoints which are already set are matched in the new mode the next time
+// they're reached, but they're only verified against the files run from then on.
+func (dbg *Debugger) SetPathMatching(mode PathMatchMode) {
+	dbg.bpMu.Lock()
+	defer dbg.bpMu.Unlock()
+	dbg.pathMatching = mode
+}
+
+// match reports whether the filename of a breakpoint matches the name of a file being run.
+func (mode PathMatchMode) match(bpFile, filename string) bool {
+	if bpFile == filename {
+		return true
+	}
+	switch mode {
+	case SuffixPathMatch:
+		return isPathSuffix(bpFile, filename) || isPathSuffix(filename, bpFile)
+	case BasenamePathMatch:
+		return pathBase(bpFile) == pathBase(filename)
+	}
+	return false
+}
+
+// isPathSuffix reports whether suffix is made of the last elements of p. Both / and \ are separators.
+func isPathSuffix(p, suffix string) bool {
+	if suffix == "" || !strings.HasSuffix(p, suffix) {
+		return false
+	}
+	if len(p) == len(suffix) {
+		return true
+	}
+	c := p[len(p)-len(suffix)-1]
+	return c == '/' || c == '\\'
+}
+
+// pathBase returns the last element of p.
+func pathBase(p string) string {
+	return p[strings.LastIndexAny(p, "/\\")+1:]
+}
+
+// breakpointFiles returns the filenames of the breakpoints which match the file being run filename, sorted. The
+// caller must hold bpMu.
+func (dbg *Debugger) breakpointFiles(filename string) []string {
+	if dbg.pathMatching == "" || dbg.pathMatching == ExactPathMatch {
+		if _, exists := dbg.breakpoints[filename]; exists {
+			return []string{filename}
+		}
+		return nil
+	}
+	var files []string
+	for bpFile := range dbg.breakpoints {
+		if dbg.pathMatching.match(bpFile, filename) {
+			files = append(files, bpFile)
+		}
+	}
+	sort.Strings(files)
+	return files
+}
+
+// loadedLines returns the executable lines of the file which has been run that the breakpoint filename bpFile
+// matches. The caller must hold bpMu.
+func (dbg *Debugger) loadedLines(bpFile string) ([]int, bool) {
+	if lines, loaded := dbg.loaded[bpFile]; loaded {
+		return lines, true
+	}
+	var match string
+	for filename := range dbg.loaded {
+		if dbg.pathMatching.match(bpFile, filename) && (match == "" || filename < match) {
+			match = filename
+		}
+	}
+	if match == "" {
+		return nil, false
+	}
+	return dbg.loaded[match], true
+}
+
+// exportedBreakpoints is the format of ExportBreakpoints.
+type exportedBreakpoints struct {
+	Breakpoints         []exportedBreakpoint         `json:"breakpoints"`
+	FunctionBreakpoints []exportedFunctionBreakpoint `json:"functionBreakpoints,omitempty"`
+}
+
+type exportedBreakpoint struct {
+	ID          int    `json:"id"`
+	Filename    string `json:"filename"`
+	Line        int    `json:"line"`
+	Condition   string `json:"condition,omitempty"`
+	Enabled     bool   `json:"enabled"`
+	OncePerCall bool   `json:"oncePerCall,omitempty"`
+}
+
+type exportedFunctionBreakpoint struct {
+	Name   string `json:"name"`
+	Ignore int    `json:"ignore,omitempty"` // number of calls still ignored
+}
+
+// ExportBreakpoints serializes the breakpoints as JSON, e.g. to save them with the session of an editor and restore
+// them with ImportBreakpoints. The line breakpoints keep their ID, condition, enabled state and whether they pause
+// once per call, the function breakpoints the number of calls they still ignore. Lines are 1-based whatever the base
+// set with SetLineBase, and the hit counts aren't kept.
+func (dbg *Debugger) ExportBreakpoints() ([]byte, error) {
+	var exported exportedBreakpoints
+	dbg.bpMu.Lock()
+	filenames := make([]string, 0, len(dbg.breakpoints))
+	for filename := range dbg.breakpoints {
+		filenames = append(filenames, filename)
+	}
+	sort.Strings(filenames)
+	for _, filename := range filenames {
+		for _, bp := range dbg.breakpoints[filename] {
+			exported.Breakpoints = append(exported.Breakpoints, exportedBreakpoint{
+				ID:          bp.ID,
+				Filename:    bp.Filename,
+				Line:        bp.Line,
+				Condition:   bp.Condition,
+				Enabled:     bp.Enabled,
+				OncePerCall: bp.OncePerCall,
+			})
+		}
+	}
+	dbg.bpMu.Unlock()
+	names := make([]string, 0, len(dbg.functionBreakpoints))
+	for name := range dbg.functionBreakpoints {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		ignore := dbg.functionBreakpoints[name] - dbg.CallCount(name)
+		if ignore < 0 {
+			ignore = 0
+		}
+		exported.FunctionBreakpoints = append(exported.FunctionBreakpoints, exportedFunctionBreakpoint{Name: name, Ignore: ignore})
+	}
+	return json.Marshal(exported)
+}
+
+// ImportBreakpoints replaces the breakpoints with the ones serialized by ExportBreakpoints. Like the ones set with
+// SetBreakpoint they are resolved against the code of their files if it has been run, and the IDs of the breakpoints
+// set afterwards follow the imported ones. Nothing is changed if data is invalid, has a condition which doesn't parse
+// or the same ID twice.
+func (dbg *Debugger) ImportBreakpoints(data []byte) error {
+	var imported exportedBreakpoints
+	if err := json.Unmarshal(data, &imported); err != nil {
+		return err
+	}
+	bps := make([]Breakpoint, 0, len(imported.Breakpoints))
+	ids := make(map[int]bool, len(imported.Breakpoints))
+	for _, e := range imported.Breakpoints {
+		if e.ID <= 0 || ids[e.ID] {
+			return fmt.Errorf("invalid or duplicate breakpoint ID %d", e.ID)
+		}
+		ids[e.ID] = true
+		bp := Breakpoint{ID: e.ID, Filename: e.Filename, Line: e.Line, Condition: e.Condition, Enabled: e.Enabled,
+			OncePerCall: e.OncePerCall}
+		if e.Condition != "" {
+			in, err := parseEval(e.Condition)
+			if err != nil {
+				return fmt.Errorf("condition of breakpoint %d: %w", e.ID, err)
+			}
+			bp.cond = &breakpointCondition{in: in}
+		}
+		bps = append(bps, bp)
+	}
+
+	dbg.bpMu.Lock()
+	dbg.breakpoints = make(map[string][]Breakpoint)
+	dbg.unresolved = nil
+	for _, bp := range bps {
+		if bp.ID > dbg.lastID {
+			dbg.lastID = bp.ID
+		}
+		dbg.addBreakpoint(bp)
+	}
+	dbg.bpMu.Unlock()
+	dbg.functionBreakpoints = nil
+	for _, f := range imported.FunctionBreakpoints {
+		dbg.SetFunctionBreakpointAfter(f.Name, f.Ignore)
+	}
+	return nil
+}
+
+// setBreakpoint adds bp, replacing the configuration of an existing breakpoint at the same location (but keeping
+// its ID and hit count), and returns its ID. The line of bp is in the base set with SetLineBase.
+func (dbg *Debugger) setBreakpoint(bp Breakpoint) (int, error) {
+	dbg.bpMu.Lock()
+	defer dbg.bpMu.Unlock()
+	if bp.Line+dbg.lineOffset < 1 {
+		return 0, fmt.Errorf("invalid line %d", bp.Line)
+	}
+	bp.Line += dbg.lineOffset
+	return dbg.addBreakpoint(bp), nil
+}
+
+// addBreakpoint is setBreakpoint for a line of the code, a new breakpoint keeps its ID if it has one.
+func (dbg *Debugger) addBreakpoint(bp Breakpoint) int {
+	bp.Verified = false
+	if lines, loaded := dbg.loadedLines(bp.Filename); loaded {
+		bp.Verified = sort.SearchInts(lines, bp.Line) < len(lines)
+	}
+	idx, found := dbg.findBreakpoint(bp)
+	bps := dbg.breakpoints[bp.Filename]
+	if found {
+		bp.ID = bps[idx].ID
+		bp.HitCount = bps[idx].HitCount
+		bps[idx] = bp
+		return bp.ID
+	}
+	if bp.ID == 0 {
+		dbg.lastID++
+		bp.ID = dbg.lastID
+	}
+	if bp.Verified {
+		dbg.emitResolved(bp, dbg.resolvedLine(bp))
+	}
+	bps = append(bps, Breakpoint{})
+	copy(bps[idx+1:], bps[idx:])
+	bps[idx] = bp
+	dbg.breakpoints[bp.Filename] = bps
+	return bp.ID
+}
+
+// findBreakpoint returns the index of the breakpoint at the location of bp, or the index where it would be inserted.
+// The caller must hold bpMu.
+func (dbg *Debugger) findBreakpoint(bp Breakpoint) (int, bool) {
+	bps := dbg.breakpoints[bp.Filename]
+	idx := sort.Search(len(bps), func(i int) bool {
+		return bps[i].Line >= bp.Line
+	})
+	return idx, idx < len(bps) && bps[idx].sameLocation(bp)
+}
+
+// ClearBreakpoint removes the breakpoint on the given line, whatever its configuration.
+func (dbg *Debugger) ClearBreakpoint(filename string, line int) error {
+	dbg.bpMu.Lock()
+	defer dbg.bpMu.Unlock()
+	return dbg.clearBreakpoint(filename, line+dbg.lineOffset)
+}
+
+func (dbg *Debugger) clearBreakpoint(filename string, line int) (err error) {
+	if len(dbg.breakpoints[filename]) == 0 {
+		return errors.New("no breakpoints")
+	}
+
+	idx, found := dbg.findBreakpoint(Breakpoint{Filename: filename, Line: line})
+	if found {
+		dbg.breakpoints[filename] = append(dbg.breakpoints[filename][:idx], dbg.breakpoints[filename][idx+1:]...)
+		if len(dbg.breakpoints[filename]) == 0 {
+			delete(dbg.breakpoints, filename)
+		}
+	} else {
+		err = errors.New("breakpoint doesn't exist")
+	}
+	return
+}
+
+// Rebind re-resolves the breakpoints set on the files of prg against its code. It's meant to be called after a
+// modified script has been recompiled: breakpoints on lines without any code are moved to the next line which has
+// some and the ones past the end of the code are dropped. The dropped breakpoints are returned, and reported by
+// UnresolvedBreakpoints until a program with code for them is run.
+func (dbg *Debugger) Rebind(prg *Program) (stale []Breakpoint) {
+	dbg.bpMu.Lock()
+	defer dbg.bpMu.Unlock()
+	stale = dbg.rebind(prg)
+	for _, bp := range stale {
+		dbg.addUnresolved(bp)
+	}
+	return stale
+}
+
+func (dbg *Debugger) rebind(prg *Program) (stale []Breakpoint) {
+	for filename, lines := range executableLines(prg) {
+		if dbg.loaded == nil {
+			dbg.loaded = make(map[string][]int)
+		}
+		dbg.loaded[filename] = lines
+		for _, bpFile := range dbg.breakpointFiles(filename) {
+			var resolved []Breakpoint
+			for _, bp := range dbg.breakpoints[bpFile] {
+				idx := sort.SearchInts(lines, bp.Line)
+				if idx == len(lines) {
+					bp.Verified = false
+					stale = append(stale, bp)
+					continue
+				}
+				bp.Line = lines[idx]
+				if l := len(resolved); l == 0 || !resolved[l-1].sameLocation(bp) {
+					if !bp.Verified {
+						bp.Verified = true
+						dbg.emitResolved(bp, bp.Line)
+					}
+					resolved = append(resolved, bp)
+				}
+			}
+			if len(resolved) > 0 {
+				dbg.breakpoints[bpFile] = resolved
+			} else {
+				delete(dbg.breakpoints, bpFile)
+			}
+		}
+	}
+	return
+}
+
+// attach is called when prg is about to be run. Breakpoints can be set before the program they are for is compiled,
+// so the ones of its files are verified against it: those with code at or after their line pause at the first such
+// line, the others are reported by UnresolvedBreakpoints. Unlike Rebind it doesn't move or drop any, as other
+// programs may be run under the same name later, and the breakpoints Rebind dropped are restored if prg has code for
+// them.
+func (dbg *Debugger) attach(prg *Program) {
+	dbg.bpMu.Lock()
+	defer dbg.bpMu.Unlock()
+	files, known := dbg.programLines[prg]
+	if !known {
+		files = executableLines(prg)
+		if dbg.programLines == nil {
+			dbg.programLines = make(map[*Program]map[string][]int)
+		}
+		walkPrograms(prg, func(p *Program) {
+			dbg.programLines[p] = files
+		})
+	}
+	if dbg.loaded == nil {
+		dbg.loaded = make(map[string][]int)
+	}
+	for filename, lines := range files {
+		dbg.loaded[filename] = lines
+		unresolved := dbg.unresolved[:0]
+		for _, bp := range dbg.unresolved {
+			if !dbg.pathMatching.match(bp.Filename, filename) || sort.SearchInts(lines, bp.Line) == len(lines) {
+				unresolved = append(unresolved, bp)
+				continue
+			}
+			if _, found := dbg.findBreakpoint(bp); !found {
+				bp.Verified = false
+				dbg.addBreakpoint(bp)
+			}
+		}
+		dbg.unresolved = unresolved
+		for _, bpFile := range dbg.breakpointFiles(filename) {
+			bps := dbg.breakpoints[bpFile]
+			for i := range bps {
+				idx := sort.SearchInts(lines, bps[i].Line)
+				verified := idx < len(lines)
+				if verified && !bps[i].Verified {
+					dbg.emitResolved(bps[i], lines[idx])
+				}
+				bps[i].Verified = verified
+			}
+		}
+	}
+}
+
+// resolvedLine returns the line the verified breakpoint bp pauses at. The caller must hold bpMu.
+func (dbg *Debugger) resolvedLine(bp Breakpoint) int {
+	lines, _ := dbg.loadedLines(bp.Filename)
+	return lines[sort.SearchInts(lines, bp.Line)]
+}
+
+func (dbg *Debugger) emitResolved(bp Breakpoint, line int) {
+	dbg.emitEvent(Event{Kind: BreakpointResolvedEvent, Filename: bp.Filename, Line: line, Breakpoint: bp.ID})
+}
+
+func (dbg *Debugger) addUnresolved(bp Breakpoint) {
+	for i, unresolved := range dbg.unresolved {
+		if unresolved.sameLocation(bp) {
+			dbg.unresolved[i] = bp
+			return
+		}
+	}
+	dbg.unresolved = append(dbg.unresolved, bp)
+}
+
+// UnresolvedBreakpoints returns the breakpoints which have no code at or after their line in the file they were set
+// for, as it was last run, and the ones Rebind dropped for that reason. Programs run with Runtime.RunProgram (or
+// RunScript) verify the breakpoints of their files when they start.
+func (dbg *Debugger) UnresolvedBreakpoints() []Breakpoint {
+	dbg.bpMu.Lock()
+	defer dbg.bpMu.Unlock()
+	unresolved := append([]Breakpoint(nil), dbg.unresolved...)
+	files := make([]string, 0, len(dbg.breakpoints))
+	for filename := range dbg.breakpoints {
+		files = append(files, filename)
+	}
+	sort.Strings(files)
+	for _, filename := range files {
+		if _, loaded := dbg.loadedLines(filename); !loaded {
+			continue
+		}
+		for _, bp := range dbg.breakpoints[filename] {
+			if !bp.Verified {
+				unresolved = append(unresolved, bp)
+			}
+		}
+	}
+	return unresolved
+}
+
+// SourceFiles returns the sorted names of the files with compiled code: the ones of the programs run with
+// Runtime.RunProgram (or RunScript) and the ones of the code currently on the call stack.
+func (dbg *Debugger) SourceFiles() []string {
+	seen := make(map[string]struct{})
+	dbg.bpMu.Lock()
+	for filename := range dbg.loaded {
+		seen[filename] = struct{}{}
+	}
+	dbg.bpMu.Unlock()
+	addFiles := func(prg *Program) {
+		if prg == nil {
+			return
+		}
+		for filename := range executableLines(prg) {
+			seen[filename] = struct{}{}
+		}
+	}
+	addFiles(dbg.vm.prg)
+	for i := range dbg.vm.callStack {
+		addFiles(dbg.vm.callStack[i].prg)
+	}
+	files := make([]string, 0, len(seen))
+	for filename := range seen {
+		files = append(files, filename)
+	}
+	sort.Strings(files)
+	return files
+}
+
+// Breakpoints returns the lines with a breakpoint, by filename.
+func (dbg *Debugger) Breakpoints() (map[string][]int, error) {
+	dbg.bpMu.Lock()
+	defer dbg.bpMu.Unlock()
+	if len(dbg.breakpoints) == 0 {
+		return nil, errors.New("no breakpoints")
+	}
+
+	lines := make(map[string][]int, len(dbg.breakpoints))
+	for filename, bps := range dbg.breakpoints {
+		for _, bp := range bps {
+			lines[filename] = append(lines[filename], bp.Line)
+		}
+	}
+	return lines, nil
+}
+
+// InstrumentKind is the kind of an Instrument.
+type InstrumentKind string
+
+const (
+	BreakpointInstrument          InstrumentKind = "breakpoint"
+	FunctionBreakpointInstrument  InstrumentKind = "function-breakpoint"
+	PropertyBreakpointInstrument  InstrumentKind = "property-breakpoint"
+	VariableWatchInstrument       InstrumentKind = "variable-watch"
+	GlobalWatchInstrument         InstrumentKind = "global-watch"
+	ArrayLengthWatchInstrument    InstrumentKind = "array-length-watch"
+	ExceptionBreakpointInstrument InstrumentKind = "exception-breakpoint"
+)
+
+// Instrument is something set on the debugger to pause the program or report on it, see Instrumentation. Only the
+// fields which apply to its Kind are set.
+type Instrument struct {
+	Kind InstrumentKind
+
+	Breakpoint Breakpoint // of a BreakpointInstrument
+
+	Function string // name of the functions a FunctionBreakpointInstrument pauses in
+
+	Object   string // expression the object of a PropertyBreakpointInstrument or ArrayLengthWatchInstrument was given by
+	Property string
+	OnGet    bool
+	OnSet    bool
+
+	Variable string // name of the variable of a VariableWatchInstrument or of the global of a GlobalWatchInstrument
+
+	ExceptionTypes []string // names of the errors an ExceptionBreakpointInstrument pauses on, nil for all of them
+}
+
+// Instrumentation returns everything set on the debugger which may pause the program or report on it: the
+// breakpoints (sorted by ID), the function breakpoints (sorted by name), the property breakpoints and the variable
+// watches (in the order they were set) and the exception breakpoint, if any.
+func (dbg *Debugger) Instrumentation() []Instrument {
+	var instruments []Instrument
+	dbg.bpMu.Lock()
+	var bps []Breakpoint
+	for _, fileBps := range dbg.breakpoints {
+		bps = append(bps, fileBps...)
+	}
+	dbg.bpMu.Unlock()
+	sort.Slice(bps, func(i, j int) bool {
+		return bps[i].ID < bps[j].ID
+	})
+	for _, bp := range bps {
+		instruments = append(instruments, Instrument{Kind: BreakpointInstrument, Breakpoint: bp})
+	}
+
+	names := make([]string, 0, len(dbg.functionBreakpoints))
+	for name := range dbg.functionBreakpoints {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		instruments = append(instruments, Instrument{Kind: FunctionBreakpointInstrument, Function: name})
+	}
+
+	for _, pb := range dbg.propertyBreakpoints {
+		instruments = append(instruments, Instrument{
+			Kind:     PropertyBreakpointInstrument,
+			Object:   pb.objExpr,
+			Property: pb.prop,
+			OnGet:    pb.onGet,
+			OnSet:    pb.onSet,
+		})
+	}
+
+	watched := make(map[unistring.String]bool)
+	for _, w := range dbg.variableWatches {
+		if !watched[w.name] {
+			watched[w.name] = true
+			instruments = append(instruments, Instrument{Kind: VariableWatchInstrument, Variable: w.name.String()})
+		}
+	}
+	for _, w := range dbg.globalWatches {
+		instruments = append(instruments, Instrument{Kind: GlobalWatchInstrument, Variable: w.name.String()})
+	}
+	for _, w := range dbg.lengthWatches {
+		instruments = append(instruments, Instrument{Kind: ArrayLengthWatchInstrument, Object: w.expr})
+	}
+
+	if dbg.breakOnThrow {
+		var types []string
+		for name := range dbg.exceptionTypes {
+			types = append(types, name)
+		}
+		sort.Strings(types)
+		instruments = append(instruments, Instrument{Kind: ExceptionBreakpointInstrument, ExceptionTypes: types})
+	}
+	return instruments
+}
+
+// executableLines returns the sorted lines which have code, by filename, for prg and all the functions defined in it.
+func executableLines(prg *Program) map[string][]int {
+	seen := make(map[string]map[int]struct{})
+	walkPrograms(prg, func(p *Program) {
+		if p.src == nil {
+			return
+		}
+		for pc := range p.code {
+			pos := debugPosition(p, pc)
+			if seen[pos.Filename] == nil {
+				seen[pos.Filename] = make(map[int]struct{})
+			}
+			seen[pos.Filename][pos.Line] = struct{}{}
+		}
+	})
+	lines := make(map[string][]int, len(seen))
+	for filename, set := range seen {
+		for line := range set {
+			lines[filename] = append(lines[filename], line)
+		}
+		sort.Ints(lines[filename])
+	}
+	return lines
+}
+
+// walkPrograms calls f for prg and every program nested in it (functions, methods, class constructors and field
+// initialisers).
+func walkPrograms(prg *Program, f func(*Program)) {
+	if prg == nil { // e.g. the constructor of a class which doesn't declare one
+		return
+	}
+	f(prg)
+	for _, ins := range prg.code {
+		switch ins := ins.(type) {
+		case *newFunc:
+			walkPrograms(ins.prg, f)
+		case *newArrowFunc:
+			walkPrograms(ins.prg, f)
+		case *newMethod:
+			walkPrograms(ins.prg, f)
+		case *newDerivedClass:
+			walkPrograms(ins.initFields, f)
+			walkPrograms(ins.ctor, f)
+		case *newClass:
+			walkPrograms(ins.initFields, f)
+			walkPrograms(ins.ctor, f)
+		case *newStaticFieldInit:
+			walkPrograms(ins.initFields, f)
+		}
+	}
+}
+
+// Reason returns what the debugger is paused by, e.g. DebuggerStatementActivation when a step reaches a debugger
+// statement, which always pauses for the statement itself. It's empty if it isn't paused.
+func (dbg *Debugger) Reason() ActivationReason {
+	return dbg.reason
+}
+
+// StepIn executes a single instruction, entering the called function if it's a call. If the program finishes
+// because of an uncaught exception the exception is returned.
+func (dbg *Debugger) StepIn() error {
+	if dbg.isFinished() {
+		return dbg.endError()
+	}
+	if dbg.vm.prg == nil {
+		return ErrNoProgram
+	}
+	dbg.updateCurrentLine()
+	prg, pc, depth := dbg.vm.prg, dbg.vm.pc, dbg.callStackDepth()
+	dbg.step = func() bool {
+		return dbg.vm.prg != prg || dbg.vm.pc != pc || dbg.callStackDepth() != depth
+	}
+	if _, err := dbg.runStep(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Next runs until the next line. If the program finishes because of an uncaught exception thrown while doing so the
+// exception is returned.
+func (dbg *Debugger) Next() error {
+	if dbg.isFinished() {
+		// Step out of program
+		return dbg.endError()
+	}
+	if dbg.vm.prg == nil {
+		return ErrNoProgram
+	}
+	dbg.updateCurrentLine()
+	var t lineTracker
+	depth := dbg.callStackDepth()
+	t.start(dbg.vm.prg, dbg.vm.pc, dbg.Line(), depth)
+	dbg.step = func() bool {
+		if dbg.stepIntoAccessors && dbg.enteredAccessor(depth) {
+			return true
+		}
+		return t.done(dbg.vm.prg, dbg.vm.pc, dbg.Line(), dbg.callStackDepth())
+	}
+	if _, err := dbg.runStep(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// StepLine runs until a different line is reached, whichever frame it's in: unlike Next it stops inside the functions
+// the current line calls, at the first of their lines run, or in the caller once the current function returns. Like
+// Next it also stops when a loop on a single line goes round. If the program finishes because of an uncaught exception
+// thrown while doing so the exception is returned.
+func (dbg *Debugger) StepLine() error {
+	if dbg.isFinished() {
+		return dbg.endError()
+	}
+	if dbg.vm.prg == nil {
+		return ErrNoProgram
+	}
+	dbg.updateCurrentLine()
+	prg, pc, line := dbg.vm.prg, dbg.vm.pc, dbg.Line()
+	dbg.step = func() bool {
+		vm := dbg.vm
+		if vm.prg != prg || vm.prg.code[vm.pc] == halt {
+			return true
+		}
+		if dbg.Line() != line {
+			return true
+		}
+		backward := vm.pc < pc
+		pc = vm.pc
+		return backward
+	}
+	if _, err := dbg.runStep(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// SetStepIntoAccessors makes Next pause at the start of the getters and setters of the properties accessed by the
+// current line rather than stepping over them like it does for the other calls, which is the default.
+func (dbg *Debugger) SetStepIntoAccessors(enable bool) {
+	dbg.stepIntoAccessors = enable
+}
+
+// enteredAccessor reports whether a JS getter or setter has just been called by the frame at depth.
+func (dbg *Debugger) enteredAccessor(depth int) bool {
+	vm := dbg.vm
+	// the accessor is called by native code, which pushes the context of the caller and then a marker frame
+	if vm.pc != 0 || vm.prg == nil || len(vm.callStack) != depth+2 {
+		return false
+	}
+	caller := &vm.callStack[depth]
+	if caller.prg == nil || caller.pc <= 0 || caller.pc > len(caller.prg.code) {
+		return false
+	}
+	return isPropertyAccess(caller.prg.code[caller.pc-1])
+}
+
+// NextStatementSameLine runs until the next statement of the current line, stepping over calls, or runs to the next
+// line like Next if the current statement is the last one of its line.
+func (dbg *Debugger) NextStatementSameLine() error {
+	if dbg.isFinished() {
+		return dbg.endError()
+	}
+	if dbg.vm.prg == nil {
+		return ErrNoProgram
+	}
+	prg, pc, line, depth := dbg.vm.prg, dbg.vm.pc, dbg.Line(), dbg.callStackDepth()
+	i := sort.SearchInts(prg.stmts, pc+1)
+	if i == len(prg.stmts) || debugPosition(prg, prg.stmts[i]).Line != line {
+		return dbg.Next()
+	}
+	next := prg.stmts[i]
+	dbg.updateCurrentLine()
+	dbg.step = func() bool {
+		d := dbg.callStackDepth()
+		if d != depth || dbg.vm.prg != prg {
+			return d < depth
+		}
+		// a jump may skip the statement or leave the line altogether
+		return dbg.vm.pc >= next || dbg.vm.pc < pc || dbg.Line() != line
+	}
+	if _, err := dbg.runStep(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// lineTracker decides when a Next has reached the next line. It's started at the position Next is called from and
+// then fed every position the vm is about to execute until done reports true, which happens when a different line of
+// the same frame is reached (whether it's after or before the starting one, as at the end of a loop body), when the
+// same line is re-entered by a jump backwards (the next iteration of a loop written on a single line), when the
+// frame returns to its caller or when the program is about to halt, so that stepping never runs off its end.
+// Positions inside called functions are stepped over.
+type lineTracker struct {
+	prg   *Program
+	pc    int
+	line  int
+	depth int
+}
+
+func (t *lineTracker) start(prg *Program, pc, line, depth int) {
+	t.prg, t.pc, t.line, t.depth = prg, pc, line, depth
+}
+
+func (t *lineTracker) done(prg *Program, pc, line, depth int) bool {
+	if depth < t.depth {
+		return true
+	}
+	if depth > t.depth || prg != t.prg {
+		return false
+	}
+	if line != t.line || prg.code[pc] == halt {
+		return true
+	}
+	backward := pc < t.pc
+	t.pc = pc
+	return backward
+}
+
+// OnFrameEnter registers f to be called on the vm goroutine whenever a JS function starts executing, with its
+// frame. Passing nil unregisters it.
+func (dbg *Debugger) OnFrameEnter(f func(StackFrame)) {
+	dbg.onFrameEnter = f
+	dbg.frameDepth = len(dbg.vm.callStack)
+}
+
+// OnFrameExit registers f to be called on the vm goroutine whenever a JS function is about to return, with its
+// frame and the returned value. Frames unwound by an exception are not reported. Passing nil unregisters it.
+func (dbg *Debugger) OnFrameExit(f func(StackFrame, Value)) {
+	dbg.onFrameExit = f
+}
+
+// SetFunctionBreakpoint makes the program pause whenever a function with the given name is called, once it has set up
+// its frame (so that its arguments can be inspected).
+func (dbg *Debugger) SetFunctionBreakpoint(name string) {
+	dbg.SetFunctionBreakpointAfter(name, 0)
+}
+
+// SetFunctionBreakpointAfter is like SetFunctionBreakpoint but the first n calls (counting from now) are ignored.
+func (dbg *Debugger) SetFunctionBreakpointAfter(name string, n int) {
+	if dbg.functionBreakpoints == nil {
+		dbg.functionBreakpoints = make(map[string]int)
+	}
+	dbg.functionBreakpoints[name] = dbg.CallCount(name) + n
+}
+
+// ClearFunctionBreakpoint removes the function breakpoint set for name.
+func (dbg *Debugger) ClearFunctionBreakpoint(name string) error {
+	if _, exists := dbg.functionBreakpoints[name]; !exists {
+		return errors.New("function breakpoint doesn't exist")
+	}
+	delete(dbg.functionBreakpoints, name)
+	return nil
+}
+
+// CallCount returns how many times functions with the given name have been called since the debugger was attached.
+func (dbg *Debugger) CallCount(name string) int {
+	return dbg.callCounts[name]
+}
+
+// traceFrames is called by the vm before each instruction.
+func (dbg *Debugger) traceFrames() {
+	vm := dbg.vm
+	if dbg.condBudgeted {
+		dbg.spendConditionBudget()
+	}
+	if len(dbg.variableWatches) > 0 {
+		dbg.checkVariableWatches()
+	}
+	if len(dbg.globalWatches) > 0 {
+		dbg.checkGlobalWatches()
+	}
+	if len(dbg.lengthWatches) > 0 {
+		dbg.checkLengthWatches()
+	}
+	depth := len(vm.callStack)
+	if prg := dbg.enteredFunction; prg != nil {
+		dbg.enteredFunction = nil
+		if vm.prg == prg && !dbg.active {
+			dbg.activate(FunctionBreakpointActivation)
+		}
+	}
+	if vm.pc == 0 && depth != dbg.frameDepth {
+		dbg.enterFrame()
+	}
+	dbg.frameDepth = depth
+	if dbg.onFrameExit != nil && dbg.isReturn() {
+		dbg.onFrameExit(dbg.currentFrame(), dbg.PendingReturnValue())
+	}
+}
+
+type variableWatch struct {
+	name unistring.String
+	last Value
+	f    func(old, new Value)
+}
+
+// OnVariableChange registers f to be called on the vm goroutine whenever the value of the variable name, as seen from
+// the code being run, changes. Unlike a breakpoint it doesn't pause. A variable which isn't in scope is considered
+// undefined, so f is also called with undefined when name goes out of scope and with its value when it comes back.
+// Values are compared with SameValue, so objects only count as changed when name holds another object. Passing nil
+// removes the callbacks registered for name.
+func (dbg *Debugger) OnVariableChange(name string, f func(old, new Value)) {
+	n := unistring.NewFromString(name)
+	if f == nil {
+		watches := dbg.variableWatches[:0]
+		for _, w := range dbg.variableWatches {
+			if w.name != n {
+				watches = append(watches, w)
+			}
+		}
+		dbg.variableWatches = watches
+		return
+	}
+	w := &variableWatch{name: n, last: _undefined, f: f}
+	if dbg.vm.prg != nil {
+		w.last = dbg.peekVariable(n)
+	}
+	dbg.variableWatches = append(dbg.variableWatches, w)
+}
+
+func (dbg *Debugger) checkVariableWatches() {
+	for _, w := range dbg.variableWatches {
+		if v := dbg.peekVariable(w.name); !v.SameAs(w.last) {
+			old := w.last
+			w.last = v
+			w.f(old, v)
+		}
+	}
+}
+
+// peekVariable returns the value of the variable name in the current scope, or undefined if it's not in scope or not
+// initialised yet. Unlike getValue it never runs any code, so the objects of with statements and the accessor
+// properties of the global object are skipped.
+func (dbg *Debugger) peekVariable(name unistring.String) Value {
+	for st := dbg.vm.stash; st != nil; st = st.outer {
+		if st.obj != nil {
+			continue
+		}
+		if idx, exists := st.names[name]; exists {
+			if v := st.values[idx&^maskTyp]; v != nil {
+				return v
+			}
+			return _undefined
+		}
+	}
+	return dbg.peekGlobal(name)
+}
+
+// peekGlobal returns the value of the property name of the global object, or undefined if it has no such data
+// property.
+func (dbg *Debugger) peekGlobal(name unistring.String) Value {
+	switch v := dbg.vm.r.globalObject.self.getOwnPropStr(name).(type) {
+	case nil:
+		return _undefined
+	case *valueProperty:
+		if v.accessor {
+			return _undefined
+		}
+		return nilSafe(v.value)
+	default:
+		return v
+	}
+}
+
+type globalWatch struct {
+	name unistring.String
+	last Value
+}
+
+// GlobalAssignment is a change of a global watched with WatchGlobal, along with the position of the code which
+// made it.
+type GlobalAssignment struct {
+	Name     string
+	Old, New Value
+	Filename string
+	Line     int
+}
+
+// WatchGlobal makes the program pause with GlobalAssignmentActivation whenever the value of the property name of the
+// global object changes, which includes global var declarations and functions. It pauses right after the
+// instruction which changed it, see Assignment. As the value is checked between instructions, assignments of the
+// value the property already has (by SameValue) don't pause, and neither do changes of accessor properties.
+// Watching a global which is already watched does nothing.
+func (dbg *Debugger) WatchGlobal(name string) {
+	n := unistring.NewFromString(name)
+	for _, w := range dbg.globalWatches {
+		if w.name == n {
+			return
+		}
+	}
+	dbg.globalWatches = append(dbg.globalWatches, &globalWatch{name: n, last: dbg.peekGlobal(n)})
+	dbg.lastPrg, dbg.lastPc = dbg.vm.prg, dbg.vm.pc
+}
+
+// UnwatchGlobal stops watching the global name.
+func (dbg *Debugger) UnwatchGlobal(name string) error {
+	n := unistring.NewFromString(name)
+	for i, w := range dbg.globalWatches {
+		if w.name == n {
+			dbg.globalWatches = append(dbg.globalWatches[:i], dbg.globalWatches[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("global %s is not watched", name)
+}
+
+// Assignment returns the change of a watched global the debugger is paused at, if it's paused with
+// GlobalAssignmentActivation.
+func (dbg *Debugger) Assignment() (GlobalAssignment, bool) {
+	if dbg.assignment == nil {
+		return GlobalAssignment{}, false
+	}
+	return *dbg.assignment, true
+}
+
+func (dbg *Debugger) checkGlobalWatches() {
+	prg, pc := dbg.lastPrg, dbg.lastPc
+	dbg.lastPrg, dbg.lastPc = dbg.vm.prg, dbg.vm.pc
+	for _, w := range dbg.globalWatches {
+		v := dbg.peekGlobal(w.name)
+		if v.SameAs(w.last) {
+			continue
+		}
+		a := &GlobalAssignment{Name: w.name.String(), Old: w.last, New: v}
+		w.last = v
+		if prg == nil {
+			prg, pc = dbg.vm.prg, dbg.vm.pc
+		}
+		if prg != nil {
+			pos := debugPosition(prg, pc)
+			a.Filename, a.Line = pos.Filename, pos.Line
+		}
+		if !dbg.active {
+			dbg.assignment = a
+			dbg.activate(GlobalAssignmentActivation)
+		}
+	}
+}
+
+type lengthWatch struct {
+	expr string
+	arr  *Object
+	last int64
+}
+
+// ArrayLengthChange is a change of the length of an array watched with WatchArrayLength.
+type ArrayLengthChange struct {
+	Expr     string // the array was given by
+	Old, New int64
+}
+
+// WatchArrayLength makes the program pause with ArrayLengthActivation when the length of the array expr evaluates to
+// (in the current frame) changes. The array is resolved once, so this keeps working on that array whatever expr
+// refers to later. The length is checked when the program gets to another line, so it pauses at the start of the
+// line following the one which changed it, see LengthChange. A change which is undone within a line isn't noticed.
+func (dbg *Debugger) WatchArrayLength(expr string) error {
+	v, err := dbg.Exec(expr)
+	if err != nil {
+		return err
+	}
+	arr, ok := v.(*Object)
+	if !ok || arr.self.className() != classArray {
+		return fmt.Errorf("%s is not an array", expr)
+	}
+	dbg.lengthWatches = append(dbg.lengthWatches, &lengthWatch{expr: expr, arr: arr, last: arrayLength(arr)})
+	dbg.lengthPrg, dbg.lengthLine = dbg.vm.prg, dbg.Line()
+	return nil
+}
+
+// LengthChange returns the change of the length of a watched array the debugger is paused at, if it's paused with
+// ArrayLengthActivation.
+func (dbg *Debugger) LengthChange() (ArrayLengthChange, bool) {
+	if dbg.lengthChange == nil {
+		return ArrayLengthChange{}, false
+	}
+	return *dbg.lengthChange, true
+}
+
+// arrayLength returns the length of arr without running any code.
+func arrayLength(arr *Object) int64 {
+	if p, ok := arr.self.getOwnPropStr("length").(*valueProperty); ok && !p.accessor {
+		return p.value.ToInteger()
+	}
+	return 0
+}
+
+func (dbg *Debugger) checkLengthWatches() {
+	prg, line := dbg.vm.prg, dbg.Line()
+	if prg == dbg.lengthPrg && line == dbg.lengthLine {
+		return
+	}
+	dbg.lengthPrg, dbg.lengthLine = prg, line
+	for _, w := range dbg.lengthWatches {
+		l := arrayLength(w.arr)
+		if l == w.last {
+			continue
+		}
+		c := &ArrayLengthChange{Expr: w.expr, Old: w.last, New: l}
+		w.last = l
+		if !dbg.active {
+			dbg.lengthChange = c
+			dbg.activate(ArrayLengthActivation)
+		}
+	}
+}
+
+func (dbg *Debugger) enterFrame() {
+	name := dbg.vm.prg.funcName.String()
+	if dbg.callCounts == nil {
+		dbg.callCounts = make(map[string]int)
+	}
+	dbg.callCounts[name]++
+	dbg.calls++
+	*dbg.currentEntry() = frameEntry{prg: dbg.vm.prg, iterLen: len(dbg.vm.iterStack), refLen: len(dbg.vm.refStack), call: dbg.calls}
+	if ignore, exists := dbg.functionBreakpoints[name]; exists && dbg.callCounts[name] > ignore && !dbg.BreakpointsMuted() {
+		// pause on the next instruction, once the function has entered its scope
+		dbg.enteredFunction = dbg.vm.prg
+	}
+	if dbg.onFrameEnter != nil {
+		dbg.onFrameEnter(dbg.currentFrame())
+	}
+}
+
+// currentEntry returns the frameEntries entry of the current frame. The one of the global code is empty.
+func (dbg *Debugger) currentEntry() *frameEntry {
+	depth := len(dbg.vm.callStack)
+	for len(dbg.frameEntries) <= depth {
+		dbg.frameEntries = append(dbg.frameEntries, frameEntry{})
+	}
+	return &dbg.frameEntries[depth]
+}
+
+func (dbg *Debugger) currentFrame() StackFrame {
+	return StackFrame{prg: dbg.vm.prg, pc: dbg.vm.pc, funcName: dbg.vm.prg.funcName}
+}
+
+// CallStackOptions controls which frames CallStack returns.
+type CallStackOptions struct {
+	HideInternal bool // leave out the frames of native functions (builtins and Go functions), which have no JS source
+}
+
+// CallStack returns the frames of the current call stack, the current one first.
+func (dbg *Debugger) CallStack(opts CallStackOptions) []StackFrame {
+	stack := dbg.vm.captureStack(make([]StackFrame, 0, len(dbg.vm.callStack)+1), 0)
+	if !opts.HideInternal {
+		return stack
+	}
+	frames := stack[:0]
+	for _, frame := range stack {
+		if frame.prg != nil {
+			frames = append(frames, frame)
+		}
+	}
+	return frames
+}
+
+// maxAsyncStackSegments is how many scheduling points AsyncCallStack goes back at most, so that a chain of promises
+// scheduling each other doesn't keep growing the recorded stacks.
+const maxAsyncStackSegments = 16
+
+// pausedFrame is a frame of the call stack at a pause, along with the call it belongs to (0 if it's unknown).
+type pausedFrame struct {
+	frame StackFrame
+	call  uint64
+}
+
+// stackSnapshot returns the frames of the current call stack with their calls, the outermost first.
+func (dbg *Debugger) stackSnapshot() []pausedFrame {
+	vm := dbg.vm
+	stack := vm.captureStack(make([]StackFrame, 0, len(vm.callStack)+1), 0)
+	// the depths of the frames in the same order as captureStack
+	depths := make([]int, 0, len(stack))
+	if vm.pc != -1 {
+		depths = append(depths, len(vm.callStack))
+	}
+	for i := len(vm.callStack) - 1; i >= 0; i-- {
+		if vm.callStack[i].pc != -1 {
+			depths = append(depths, i)
+		}
+	}
+	frames := make([]pausedFrame, len(stack))
+	for i, frame := range stack {
+		f := pausedFrame{frame: frame}
+		if d := depths[i]; d < len(dbg.frameEntries) && frame.prg != nil && dbg.frameEntries[d].prg == frame.prg {
+			f.call = dbg.frameEntries[d].call
+		}
+		frames[len(stack)-1-i] = f
+	}
+	return frames
+}
+
+// StackDelta compares the call stack at the current pause with the one at the previous pause, and returns the frames
+// which were entered and the ones which were exited in between, the innermost first like CallStack. A frame which
+// was exited and entered again, e.g. by calling the same function twice in a row, counts as both. At the first pause
+// all the frames count as entered.
+func (dbg *Debugger) StackDelta() (pushed, popped []StackFrame) {
+	prev, cur := dbg.prevStack, dbg.pauseStack
+	common := 0
+	for common < len(prev) && common < len(cur) && prev[common].frame.prg == cur[common].frame.prg &&
+		prev[common].frame.funcName == cur[common].frame.funcName && prev[common].call == cur[common].call {
+		common++
+	}
+	for i := len(cur) - 1; i >= common; i-- {
+		pushed = append(pushed, cur[i].frame)
+	}
+	for i := len(prev) - 1; i >= common; i-- {
+		popped = append(popped, prev[i].frame)
+	}
+	return pushed, popped
+}
+
+// SetAsyncStackTraces enables recording the call stack whenever a promise job (the reaction to a promise being
+// settled) is scheduled, which lets AsyncCallStack show where the job comes from. It's off by default as it
+// captures a stack for every scheduled job.
+func (dbg *Debugger) SetAsyncStackTraces(enable bool) {
+	dbg.asyncStacks = enable
+}
+
+// AsyncCallStack returns the current call stack followed by the stacks at which the running promise jobs were
+// scheduled: the first segment is what CallStack returns, the second one is the stack which scheduled the current
+// job, the third one the stack which scheduled the job that scheduled it and so on. Only the first segment is
+// returned outside promise jobs or if SetAsyncStackTraces isn't enabled.
+func (dbg *Debugger) AsyncCallStack() [][]StackFrame {
+	return append([][]StackFrame{dbg.CallStack(CallStackOptions{})}, dbg.asyncStack...)
+}
+
+// asyncJob wraps a promise job which is being scheduled so that it runs with the current stack as its async stack.
+func (dbg *Debugger) asyncJob(job func()) func() {
+	if !dbg.asyncStacks {
+		return job
+	}
+	stack := dbg.AsyncCallStack()
+	if len(stack) > maxAsyncStackSegments {
+		stack = stack[:maxAsyncStackSegments]
+	}
+	return func() {
+		prev := dbg.asyncStack
+		dbg.asyncStack = stack
+		defer func() {
+			dbg.asyncStack = prev
+		}()
+		job()
+	}
+}
+
+// JobKind is the kind of a promise job, see JobInfo.
+type JobKind string
+
+const (
+	PromiseReactionJob        JobKind = "promiseReaction"        // runs a handler passed to then, catch or finally
+	PromiseResolveThenableJob JobKind = "promiseResolveThenable" // calls the then method of a thenable a promise is resolved with
+)
+
+// JobInfo describes a promise job which is waiting to run, see MicrotaskQueue.
+type JobInfo struct {
+	Kind     JobKind
+	Function string  // name of the function the job calls, empty if it's anonymous or there is none
+	Promise  *Object // the promise the job settles, nil if there is none
+}
+
+type queuedJob struct {
+	info    JobInfo
+	handler Value
+	run     func()
+	done    bool
+}
+
+// queueJob wraps a promise job which is being scheduled so that it's listed by MicrotaskQueue until it runs. The
+// wrapped job only runs once, so that DrainMicrotasks can run it ahead of the runtime.
+func (dbg *Debugger) queueJob(job func(), kind JobKind, handler *jobCallback, promise *Object) func() {
+	q := &queuedJob{info: JobInfo{Kind: kind, Promise: promise}, run: job}
+	if handler != nil {
+		q.handler = handler.fn
+	}
+	dbg.jobs = append(dbg.jobs, q)
+	return func() {
+		dbg.runJob(q)
+	}
+}
+
+func (dbg *Debugger) runJob(q *queuedJob) {
+	if q.done {
+		return
+	}
+	q.done = true
+	for i, j := range dbg.jobs {
+		if j == q {
+			dbg.jobs = append(dbg.jobs[:i], dbg.jobs[i+1:]...)
+			break
+		}
+	}
+	q.run()
+}
+
+// MicrotaskQueue returns the promise jobs which are waiting to run, in the order they will run. Only the jobs
+// scheduled while the debugger is attached are listed.
+func (dbg *Debugger) MicrotaskQueue() []JobInfo {
+	var infos []JobInfo
+	for _, q := range dbg.jobs {
+		info := q.info
+		if fn, ok := q.handler.(*Object); ok {
+			prop := fn.self.getOwnPropStr("name")
+			if p, ok := prop.(*valueProperty); ok && !p.accessor {
+				prop = p.value
+			}
+			if name, ok := prop.(valueString); ok {
+				info.Function = name.String()
+			}
+		}
+		infos = append(infos, info)
+	}
+	return infos
+}
+
+// DrainMicrotasks runs the promise jobs which are waiting to run, and the ones they schedule, until there are none
+// left, rather than when the paused program lets the runtime run them. It stops with the first exception not caught
+// by a job, or with ErrExecTimeout if the jobs keep scheduling new ones for longer than awaitTimeout.
+func (dbg *Debugger) DrainMicrotasks() error {
+	r := dbg.vm.r
+	deadline := time.Now().Add(awaitTimeout)
+	for {
+		var job func()
+		if len(dbg.jobs) > 0 {
+			q := dbg.jobs[0]
+			job = func() {
+				dbg.runJob(q)
+			}
+		} else if len(r.jobQueue) > 0 {
+			// the ones scheduled before the debugger was attached
+			job = r.jobQueue[0]
+			r.jobQueue = r.jobQueue[1:]
+		} else {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return ErrExecTimeout
+		}
+		if ex := dbg.vm.try(job); ex != nil {
+			return ex
+		}
+	}
+}
+
+// Result is the outcome of a debugger command which may produce a value.
+type Result struct {
+	Value Value
+	Err   error
+
+	Assigned map[string]Value // the variables an ExecCommand assigned to, with their values afterwards
+}
+
+// String renders the error of the result if there is one, its value otherwise.
+func (r Result) String() string {
+	if r.Err != nil {
+		return "error: " + r.Err.Error()
+	}
+	if r.Value == nil {
+		return "<no value>"
+	}
+	return inspect(r.Value, 0)
+}
+
+// StepToReturn runs the current function until it's about to return and pauses there, so that the value about to
+// be returned can be inspected with PendingReturnValue. Functions with several return points stop at whichever one
+// is reached first. If execution pauses before that, e.g. on a breakpoint, the Value of the result is nil.
+func (dbg *Debugger) StepToReturn() Result {
+	if dbg.isFinished() {
+		return Result{Err: dbg.endError()}
+	}
+	if dbg.vm.prg == nil {
+		return Result{Err: ErrNoProgram}
+	}
+	depth := dbg.callStackDepth()
+	dbg.step = func() bool {
+		d := dbg.callStackDepth()
+		return d < depth || d == depth && (dbg.isReturn() || dbg.vm.prg.code[dbg.vm.pc] == halt)
+	}
+	if _, err := dbg.runStep(); err != nil {
+		return Result{Err: err}
+	}
+	dbg.updateCurrentLine()
+	if dbg.vm.prg.code[dbg.vm.pc] == halt {
+		return Result{Err: errors.New("no return in the current frame")}
+	}
+	return Result{Value: dbg.PendingReturnValue()}
+}
+
+// StepOutWithValue runs until the current function returns and pauses in its caller, returning the value the
+// function returned along with the Result of the step, which only carries errors. The value is nil if execution
+// pauses before the function returns, e.g. on a breakpoint, or if the function throws.
+func (dbg *Debugger) StepOutWithValue() (Result, Value) {
+	if dbg.isFinished() {
+		return Result{Err: dbg.endError()}, nil
+	}
+	if dbg.vm.prg == nil {
+		return Result{Err: ErrNoProgram}, nil
+	}
+	depth := dbg.callStackDepth()
+	if depth == 0 {
+		return Result{Err: errors.New("not in a function")}, nil
+	}
+	var ret Value
+	returned := false
+	dbg.step = func() bool {
+		d := dbg.callStackDepth()
+		if d < depth {
+			return true
+		}
+		// only count the return if it's the last instruction run in the frame, not if a finally block follows it
+		ret, returned = nil, false
+		if d == depth && dbg.isReturn() {
+			ret, returned = dbg.PendingReturnValue(), true
+		}
+		return false
+	}
+	if _, err := dbg.runStep(); err != nil {
+		return Result{Err: err}, nil
+	}
+	dbg.updateCurrentLine()
+	if !returned || dbg.callStackDepth() >= depth {
+		return Result{}, nil
+	}
+	return Result{}, ret
+}
+
+// PendingReturnValue returns the value the current function is about to return, or nil if execution isn't paused
+// on a return.
+func (dbg *Debugger) PendingReturnValue() Value {
+	if !dbg.safeToRun() {
+		return nil
+	}
+	switch ins := dbg.vm.prg.code[dbg.vm.pc].(type) {
+	case _ret:
+		return dbg.vm.stack[dbg.vm.sp-1]
+	case cret:
+		return nilSafe(*dbg.vm.getStashPtr(uint32(ins)))
+	}
+	return nil
+}
+
+// NextIsCall reports whether what's left of the current line may call a function, that is whether StepIn can enter
+// one. Besides calls and constructors (tagged templates are calls too) this includes the property accesses, as they
+// may invoke a getter or a setter.
+func (dbg *Debugger) NextIsCall() bool {
+	if !dbg.safeToRun() {
+		return false
+	}
+	prg := dbg.vm.prg
+	line := dbg.Line()
+	for pc := dbg.vm.pc; pc < len(prg.code) && debugPosition(prg, pc).Line == line; pc++ {
+		if isCall(prg.code[pc]) {
+			return true
+		}
+	}
+	return false
+}
+
+func isCall(ins instruction) bool {
+	switch ins.(type) {
+	case call, callEval, callEvalStrict, _callVariadic, _callEvalVariadic, _callEvalVariadicStrict,
+		_new, _newVariadic, superCall, _superCallVariadic:
+		return true
+	}
+	return isPropertyAccess(ins)
+}
+
+// isPropertyAccess reports whether ins gets or sets a property, which calls its getter or setter if it has one.
+func isPropertyAccess(ins instruction) bool {
+	switch ins.(type) {
+	case getProp, getPropRecv, getPropCallee, getPropRecvCallee,
+		getPropRef, getPropRefRecv, getPropRefStrict, getPropRefRecvStrict,
+		setProp, setPropP, setPropStrict, setPropStrictP, setPropRecv, setPropRecvP, setPropRecvStrict, setPropRecvStrictP,
+		_getElem, _getElemRecv, _getElemCallee, _getElemRecvCallee,
+		_getElemRef, _getElemRefRecv, _getElemRefStrict, _getElemRefRecvStrict,
+		_setElem, _setElem1, _setElem1Named, _setElemP, _setElemStrict, _setElemStrictP,
+		_setElemRecv, _setElemRecvP, _setElemRecvStrict, _setElemRecvStrictP:
+		return true
+	}
+	return false
+}
+
+func (dbg *Debugger) isReturn() bool {
+	switch dbg.vm.prg.code[dbg.vm.pc].(type) {
+	case _ret, cret:
+		return true
+	}
+	return false
+}
+
+// Exec evaluates expr in the current frame, in strict mode if the code of the frame is strict.
+func (dbg *Debugger) Exec(expr string) (Value, error) {
+	if dbg.vm.prg == nil {
+		return nil, ErrNoProgram
+	}
+	return dbg.exec(expr, dbg.vm.prg.strict)
+}
+
+// ExecCommand is like Exec but the result also reports the variables expr assigns to, with their values after the
+// evaluation, so that a UI can refresh them. They're found in the source of expr: the targets of assignments
+// (including destructuring ones), increments, decrements and initialised declarations, leaving out the ones of
+// nested functions and the ones which aren't visible after the evaluation, like let declarations. The variables are
+// reported even if the evaluation throws after assigning them. Values are read without running code, so variables
+// of with statements and accessor properties of the global object are reported as undefined.
+func (dbg *Debugger) ExecCommand(expr string) Result {
+	val, err := dbg.Exec(expr)
+	res := Result{Value: val, Err: err}
+	in, perr := parseEval(expr)
+	if perr != nil {
+		return res
+	}
+	for _, name := range assignedNames(in) {
+		if !dbg.resolvable(name) {
+			continue
+		}
+		if res.Assigned == nil {
+			res.Assigned = make(map[string]Value)
+		}
+		res.Assigned[name.String()] = dbg.peekVariable(name)
+	}
+	return res
+}
+
+// assignedNames returns the names of the variables the code of in assigns to, see ExecCommand.
+func assignedNames(in *ast.Program) []unistring.String {
+	var names []unistring.String
+	add := func(id *ast.Identifier) {
+		names = append(names, id.Name)
+	}
+	walkAST(in, func(node interface{}, children func()) {
+		switch n := node.(type) {
+		case *ast.FunctionLiteral, *ast.ArrowFunctionLiteral, *ast.ClassLiteral:
+			return
+		case *ast.AssignExpression:
+			patternIdentifiers(n.Left, add)
+		case *ast.UnaryExpression:
+			if n.Operator == token.INCREMENT || n.Operator == token.DECREMENT {
+				patternIdentifiers(n.Operand, add)
+			}
+		case *ast.Binding:
+			if n.Initializer != nil {
+				patternIdentifiers(n.Target, add)
+			}
+		}
+		children()
+	})
+	return names
+}
+
+// patternIdentifiers calls f with the identifiers target (an identifier or a destructuring pattern) binds or assigns
+// to. Properties and elements of other objects which a pattern assigns to are skipped.
+func patternIdentifiers(target ast.Node, f func(*ast.Identifier)) {
+	switch t := target.(type) {
+	case *ast.Identifier:
+		f(t)
+	case *ast.AssignExpression: // a default value in a pattern
+		patternIdentifiers(t.Left, f)
+	case *ast.ArrayPattern:
+		for _, elem := range t.Elements {
+			patternIdentifiers(elem, f)
+		}
+		patternIdentifiers(t.Rest, f)
+	case *ast.ObjectPattern:
+		for _, prop := range t.Properties {
+			switch p := prop.(type) {
+			case *ast.PropertyShort:
+				f(&p.Name)
+			case *ast.PropertyKeyed:
+				patternIdentifiers(p.Value, f)
+			}
+		}
+		patternIdentifiers(t.Rest, f)
+	}
+}
+
+// astPkgPath is the package path of the AST nodes, see walkAST.
+var astPkgPath = reflect.TypeOf(ast.Identifier{}).PkgPath()
+
+// walkAST calls visit with every node of the tree rooted at root, parents first. The children of a node are only
+// walked if visit calls children, which lets it skip them or do something after they've been walked. The nodes are
+// walked by reflection, there are too many kinds of them to list their children by hand.
+func walkAST(root interface{}, visit func(node interface{}, children func())) {
+	var walk func(v reflect.Value)
+	walk = func(v reflect.Value) {
+		switch v.Kind() {
+		case reflect.Interface:
+			if !v.IsNil() {
+				walk(v.Elem())
+			}
+		case reflect.Ptr:
+			if !v.IsNil() {
+				visit(v.Interface(), func() {
+					walk(v.Elem())
+				})
+			}
+		case reflect.Struct:
+			if v.Type().PkgPath() != astPkgPath {
+				return
+			}
+			for i := 0; i < v.NumField(); i++ {
+				walk(v.Field(i))
+			}
+		case reflect.Slice:
+			for i := 0; i < v.Len(); i++ {
+				walk(v.Index(i))
+			}
+		}
+	}
+	walk(reflect.ValueOf(root))
+}
+
+// ExecStrict is like Exec but always evaluates expr in strict mode, so that e.g. var declarations don't leak out
+// of the evaluation.
+func (dbg *Debugger) ExecStrict(expr string) (Value, error) {
+	return dbg.exec(expr, true)
+}
+
+// ExecSloppy is like Exec but always evaluates expr in non-strict mode.
+func (dbg *Debugger) ExecSloppy(expr string) (Value, error) {
+	return dbg.exec(expr, false)
+}
+
+// ExecJSON is like Exec but returns the value serialized by JSON.stringify, indented with two spaces. Rather than
+// failing, circular references are serialized as "[Circular]" and functions as "[Function <name>]". Values which
+// have no JSON representation, like undefined, result in an empty string.
+func (dbg *Debugger) ExecJSON(expr string) (string, error) {
+	val, err := dbg.Exec(expr)
+	if err != nil {
+		return "", err
+	}
+	r := dbg.vm.r
+	var ancestors []*Object // objects being serialized, outermost first
+	replacer := r.newNativeFunc(func(call FunctionCall) Value {
+		// the holder is the object the value is a property of, so anything below it has been serialized already
+		if holder, ok := call.This.(*Object); ok {
+			for len(ancestors) > 0 && ancestors[len(ancestors)-1] != holder {
+				ancestors = ancestors[:len(ancestors)-1]
+			}
+		}
+		v := call.Argument(1)
+		obj, ok := v.(*Object)
+		if !ok {
+			return v
+		}
+		if _, ok := obj.self.assertCallable(); ok {
+			return newStringValue(fmt.Sprintf("[Function %s]", nilSafe(obj.self.getStr("name", nil)).String()))
+		}
+		for _, a := range ancestors {
+			if a == obj {
+				return newStringValue("[Circular]")
+			}
+		}
+		ancestors = append(ancestors, obj)
+		return v
+	}, nil, "", nil, 2)
+	var res Value
+	if ex := dbg.vm.try(func() {
+		res = r.builtinJSON_stringify(FunctionCall{Arguments: []Value{val, replacer, intToValue(2)}})
+	}); ex != nil {
+		return "", ex
+	}
+	if res == _undefined {
+		return "", nil
+	}
+	return res.String(), nil
+}
+
+// ExecTable is like Exec but lays the value out as a table, the way console.table does: a row for each of its
+// properties and a column for each of the properties of those, in the order they are first seen, with the cells
+// rendered as Print would. The first row holds the headers, "(index)" and then the column names, and is followed by
+// a "Values" column if any of the rows isn't an object. Missing cells are empty. A value which isn't an object has a
+// single "Values" column holding the value.
+func (dbg *Debugger) ExecTable(expr string) ([][]string, error) {
+	val, err := dbg.Exec(expr)
+	if err != nil {
+		return nil, err
+	}
+	obj, ok := val.(*Object)
+	if !ok {
+		return [][]string{{"Values"}, {dbg.format(val)}}, nil
+	}
+	var table [][]string
+	if ex := dbg.vm.try(func() {
+		table = dbg.table(obj)
+	}); ex != nil {
+		return nil, ex
+	}
+	return table, nil
+}
+
+func (dbg *Debugger) table(obj *Object) [][]string {
+	type row struct {
+		index  string
+		cells  map[string]string
+		value  string
+		object bool
+	}
+	var rows []row
+	var columns []string
+	seen := make(map[string]bool)
+	hasValues := false
+	for _, index := range obj.Keys() {
+		r := row{index: index}
+		v := obj.Get(index)
+		if o, ok := v.(*Object); ok {
+			r.object = true
+			r.cells = make(map[string]string)
+			for _, key := range o.Keys() {
+				if !seen[key] {
+					seen[key] = true
+					columns = append(columns, key)
+				}
+				r.cells[key] = dbg.format(o.Get(key))
+			}
+		} else {
+			hasValues = true
+			r.value = dbg.format(v)
+		}
+		rows = append(rows, r)
+	}
+	header := append([]string{"(index)"}, columns...)
+	if hasValues {
+		header = append(header, "Values")
+	}
+	table := [][]string{header}
+	for _, r := range rows {
+		line := make([]string, len(header))
+		line[0] = r.index
+		for i, key := range columns {
+			line[i+1] = r.cells[key]
+		}
+		if !r.object {
+			line[len(line)-1] = r.value
+		}
+		table = append(table, line)
+	}
+	return table
+}
+
+// ExecWithTimeout is like Exec but the evaluation is interrupted if it takes longer than d, in which case
+// ErrExecTimeout is returned. The paused program isn't affected by the interruption.
+func (dbg *Debugger) ExecWithTimeout(expr string, d time.Duration) Result {
+	marker := &execTimeout{d: d}
+	fired := make(chan struct{})
+	timer := time.AfterFunc(d, func() {
+		dbg.vm.Interrupt(marker)
+		close(fired)
+	})
+	v, err := dbg.Exec(expr)
+	if !timer.Stop() {
+		<-fired
+		// the interrupt might have been too late to stop the evaluation, it mustn't stop the program instead
+		dbg.vm.interruptLock.Lock()
+		if dbg.vm.interruptVal == marker {
+			dbg.vm.interruptVal = nil
+			dbg.vm.ClearInterrupt()
+		}
+		dbg.vm.interruptLock.Unlock()
+	}
+	var interrupted *InterruptedError
+	if errors.As(err, &interrupted) && interrupted.Value() == marker {
+		return Result{Err: ErrExecTimeout}
+	}
+	return Result{Value: v, Err: err}
+}
+
+// execTimeout is the value ExecWithTimeout interrupts the vm with.
+type execTimeout struct {
+	d time.Duration
+}
+
+func (dbg *Debugger) exec(expr string, strict bool) (Value, error) {
+	if expr == "" {
+		return nil, errors.New("nothing to execute")
+	}
+	if dbg.vm.prg == nil {
+		return nil, ErrNoProgram
+	}
+	var val Value
+	var err error
+	dbg.withLastResult(func() {
+		if operand, ok := awaitOperand(expr); ok {
+			val, err = dbg.await(operand, strict)
+		} else {
+			val, err = dbg.eval(expr, strict)
+		}
+	})
+	if err == nil {
+		dbg.lastResult = val
+	}
+	return val, err
+}
+
+// EvalSilent evaluates expr in the current frame like Exec, but leaves the state of the debugger session alone: the
+// result doesn't become the value of _ and the changes the evaluation makes to watched variables aren't reported.
+// It's meant for the evaluations made by tools rather than by the user, e.g. to render a variables view. A leading
+// await isn't supported, as running the promise jobs would affect the program.
+func (dbg *Debugger) EvalSilent(expr string) Result {
+	if expr == "" {
+		return Result{Err: errors.New("nothing to execute")}
+	}
+	if dbg.vm.prg == nil {
+		return Result{Err: ErrNoProgram}
+	}
+	var res Result
+	dbg.withLastResult(func() {
+		res.Value, res.Err = dbg.eval(expr, dbg.vm.prg.strict)
+	})
+	for _, w := range dbg.variableWatches {
+		w.last = dbg.peekVariable(w.name)
+	}
+	return res
+}
+
+// awaitTimeout is how long an awaiting Exec runs the promise jobs for at most.
+const awaitTimeout = 5 * time.Second
+
+// awaitOperand returns the expression awaited by expr if it starts with await, like await in a REPL. Only a
+// leading await is supported as the parser doesn't know about async code.
+func awaitOperand(expr string) (string, bool) {
+	expr = strings.TrimLeft(expr, " \t\r\n")
+	if !strings.HasPrefix(expr, "await") {
+		return "", false
+	}
+	rest := expr[len("await"):]
+	if rest == "" || !strings.ContainsAny(rest[:1], " \t\r\n(") {
+		return "", false
+	}
+	return rest, true
+}
+
+// await evaluates operand and, if it results in a promise (or a thenable), runs the promise jobs until it's settled.
+// The jobs are run in the order they were scheduled, including the ones scheduled by the paused program. It returns
+// the value the promise is fulfilled with, the reason it's rejected with as an *Exception, or ErrExecTimeout if it
+// doesn't settle within awaitTimeout.
+func (dbg *Debugger) await(operand string, strict bool) (Value, error) {
+	val, err := dbg.eval(operand, strict)
+	if err != nil {
+		return nil, err
+	}
+	r := dbg.vm.r
+	var promise *Promise
+	if ex := dbg.vm.try(func() {
+		promise, _ = r.promiseResolve(r.global.Promise, val).self.(*Promise)
+	}); ex != nil {
+		return nil, ex
+	}
+	deadline := time.Now().Add(awaitTimeout)
+	for promise.state == PromiseStatePending {
+		if len(r.jobQueue) == 0 {
+			return nil, errors.New("the promise can't settle while the program is paused")
+		}
+		if time.Now().After(deadline) {
+			return nil, ErrExecTimeout
+		}
+		job := r.jobQueue[0]
+		r.jobQueue = r.jobQueue[1:]
+		if ex := dbg.vm.try(job); ex != nil {
+			return nil, ex
+		}
+	}
+	if promise.state == PromiseStateRejected {
+		return nil, &Exception{val: promise.result}
+	}
+	return promise.result, nil
+}
+
+// lastResultName is the name expressions can use to refer to the last result, like in a REPL.
+const lastResultName = "_"
+
+// LastResult returns the value of the last successful Exec or Print, which the expressions passed to them can refer
+// to as _ unless the paused code has a variable with that name. It's nil if there hasn't been any.
+func (dbg *Debugger) LastResult() Value {
+	return dbg.lastResult
+}
+
+// withLastResult runs f, which evaluates code in the current frame, with _ bound to the last result.
+func (dbg *Debugger) withLastResult(f func()) {
+	if dbg.lastResult == nil {
+		f()
+		return
+	}
+	dbg.withBinding(lastResultName, dbg.lastResult, f)
+}
+
+// withBinding runs f, which evaluates code in the current frame, with name bound to v unless the code has a variable
+// with that name. The binding is in a scope of its own enclosing the evaluated code only, like the variables of
+// EvalAgainst, so the functions the code calls don't see it.
+func (dbg *Debugger) withBinding(name unistring.String, v Value, f func()) {
+	if dbg.resolvable(name) {
+		f()
+		return
+	}
+	saved := dbg.vm.stash
+	dbg.vm.stash = &stash{
+		outer:  saved,
+		names:  map[unistring.String]uint32{name: maskVar},
+		values: []Value{v},
+	}
+	defer func() {
+		dbg.vm.stash = saved
+	}()
+	f()
+}
+
+// resolvable reports whether name refers to a variable or a global object property in the current scope.
+func (dbg *Debugger) resolvable(name unistring.String) bool {
+	for st := dbg.vm.stash; st != nil; st = st.outer {
+		if st.obj != nil {
+			if stashObjHas(st.obj, name) {
+				return true
+			}
+		} else if _, exists := st.names[name]; exists {
+			return true
+		}
+	}
+	return dbg.vm.r.globalObject.self.hasPropertyStr(name)
+}
+
+// ScopeSnapshot holds the values of the variables visible at the point where it was captured, by name. Primitive
+// values are immutable so they keep the value they had at that point, objects however are held by reference and
+// reflect any later mutation of their properties.
+type ScopeSnapshot map[string]Value
+
+// CaptureScope takes a snapshot of the variables visible from the current position, including globals.
+func (dbg *Debugger) CaptureScope() ScopeSnapshot {
+	return ScopeSnapshot(dbg.visibleVariables())
+}
+
+// EvalAgainst evaluates expr in the current frame with the variables of snap shadowing the current ones, so that
+// values from an earlier pause can be compared against the state at this one. Names which are not part of the
+// snapshot resolve as usual. Assignments to snapshot variables only affect the evaluation.
+func (dbg *Debugger) EvalAgainst(snap ScopeSnapshot, expr string) (Value, error) {
+	if expr == "" {
+		return nil, errors.New("nothing to execute")
+	}
+	if dbg.vm.prg == nil {
+		return nil, ErrNoProgram
+	}
+	st := &stash{
+		outer:  dbg.vm.stash,
+		names:  make(map[unistring.String]uint32, len(snap)),
+		values: make([]Value, 0, len(snap)),
+	}
+	for name, val := range snap {
+		st.names[unistring.String(name)] = uint32(len(st.values)) | maskVar
+		st.values = append(st.values, val)
+	}
+	saved := dbg.vm.stash
+	dbg.vm.stash = st
+	defer func() {
+		dbg.vm.stash = saved
+	}()
+	return dbg.eval(expr, dbg.vm.prg.strict)
+}
+
+// EvalAt evaluates expr in the frame running the code at the given position of a file, e.g. for the expression
+// under the cursor in an editor. As the scope at a position only exists while the code around it runs, the frame is
+// the innermost one on the call stack whose function (or global code) encloses the position, even if it's paused at
+// another position. Variables of functions nested in it which aren't running are thus not visible, and block scoped
+// variables are those of the position the frame is paused at. Columns are 1-based. filename is matched like the ones
+// of breakpoints, see SetPathMatching.
+func (dbg *Debugger) EvalAt(filename string, line, col int, expr string) Result {
+	if expr == "" {
+		return Result{Err: errors.New("nothing to execute")}
+	}
+	vm := dbg.vm
+	if vm.prg == nil {
+		return Result{Err: ErrNoProgram}
+	}
+	dbg.bpMu.Lock()
+	pathMatching := dbg.pathMatching
+	dbg.bpMu.Unlock()
+	var frame context
+	vm.saveCtx(&frame)
+	found, size := false, 0
+	consider := func(ctx *context) {
+		if ctx.pc == -1 || ctx.prg == nil || ctx.prg.src == nil || !pathMatching.match(filename, ctx.prg.src.Name()) {
+			return
+		}
+		start, end := ctx.prg.funcStart, ctx.prg.funcEnd
+		if end == 0 { // global code
+			start, end = 0, len(ctx.prg.src.Source())
+		}
+		if found && end-start >= size || !positionIn(ctx.prg.src, line, col, start, end) {
+			return
+		}
+		frame, found, size = *ctx, true, end-start
+	}
+	consider(&frame)
+	for i := len(vm.callStack) - 1; i >= 0; i-- {
+		consider(&vm.callStack[i])
+	}
+	if !found {
+		return Result{Err: fmt.Errorf("no running code at %s:%d:%d", filename, line, col)}
+	}
+	return dbg.evalInFrame(&frame, expr)
+}
+
+// evalInFrame evaluates expr in the frame of ctx, which is a context of the vm or of its call stack.
+func (dbg *Debugger) evalInFrame(ctx *context, expr string) Result {
+	vm := dbg.vm
+	var saved context
+	vm.saveCtx(&saved)
+	defer vm.restoreCtx(&saved)
+	vm.restoreCtx(ctx)
+	v, err := dbg.eval(expr, ctx.prg.strict)
+	return Result{Value: v, Err: err}
+}
+
+// FrameResult is the result of evaluating an expression in a frame of the call stack, see EvalInAllFrames.
+type FrameResult struct {
+	Frame StackFrame
+	Result
+}
+
+// EvalInAllFrames evaluates expr in each frame of the call stack, the current one first like CallStack, e.g. to see
+// what a variable is at each level of the call chain. The result for a frame where expr can't be evaluated, because
+// it refers to variables which don't exist there or because it's the frame of a native function, has an error.
+func (dbg *Debugger) EvalInAllFrames(expr string) []FrameResult {
+	vm := dbg.vm
+	if vm.prg == nil && len(vm.callStack) == 0 {
+		return nil
+	}
+	var current context
+	vm.saveCtx(&current)
+	contexts := make([]context, 0, len(vm.callStack)+1)
+	if current.pc != -1 {
+		contexts = append(contexts, current)
+	}
+	for i := len(vm.callStack) - 1; i >= 0; i-- {
+		if vm.callStack[i].pc != -1 {
+			contexts = append(contexts, vm.callStack[i])
+		}
+	}
+	stack := vm.captureStack(make([]StackFrame, 0, len(contexts)), 0)
+	results := make([]FrameResult, len(stack))
+	for i, frame := range stack {
+		results[i].Frame = frame
+		if ctx := &contexts[i]; ctx.prg == nil {
+			results[i].Err = errors.New("frame of a native function")
+		} else {
+			results[i].Result = dbg.evalInFrame(ctx, expr)
+		}
+	}
+	return results
+}
+
+// positionIn reports whether line:col of f is within the source offsets [start, end).
+func positionIn(f *file.File, line, col, start, end int) bool {
+	before := func(a, b file.Position) bool {
+		return a.Line < b.Line || a.Line == b.Line && a.Column < b.Column
+	}
+	pos := file.Position{Line: line, Column: col}
+	return !before(pos, f.Position(start)) && before(pos, f.Position(end))
+}
+
+// VarDiffKind is how a variable differs between two scope snapshots.
+type VarDiffKind string
+
+const (
+	VarAdded   VarDiffKind = "added"
+	VarRemoved VarDiffKind = "removed"
+	VarChanged VarDiffKind = "changed"
+)
+
+// VarDiff is a variable which differs between two scope snapshots. Old is nil for an added variable and New for a
+// removed one.
+type VarDiff struct {
+	Name     string
+	Kind     VarDiffKind
+	Old, New Value
+}
+
+// DiffScopes returns the variables which differ from snapshot a to snapshot b, sorted by name. Values are compared
+// with SameValue, so an object only counts as changed if the variable holds another object, not if its properties
+// were modified.
+func (dbg *Debugger) DiffScopes(a, b ScopeSnapshot) []VarDiff {
+	var diffs []VarDiff
+	for name, old := range a {
+		if v, exists := b[name]; !exists {
+			diffs = append(diffs, VarDiff{Name: name, Kind: VarRemoved, Old: old})
+		} else if !v.SameAs(old) {
+			diffs = append(diffs, VarDiff{Name: name, Kind: VarChanged, Old: old, New: v})
+		}
+	}
+	for name, v := range b {
+		if _, exists := a[name]; !exists {
+			diffs = append(diffs, VarDiff{Name: name, Kind: VarAdded, New: v})
+		}
+	}
+	sort.Slice(diffs, func(i, j int) bool {
+		return diffs[i].Name < diffs[j].Name
+	})
+	return diffs
+}
+
+// ObjectSummary describes an object found by HeapSnapshot.
+type ObjectSummary struct {
+	Type    string // name of the constructor, or the class of the object (e.g. Object, Array, Function) if it has none
+	Size    int    // rough estimate of the memory used by the object itself in bytes, not counting what it refers to
+	Preview string // rendering of the object, see previewValue, truncated to maxPreviewLength characters
+	Path    string // how the object was reached first, e.g. globalThis.a.b or <scope>.x for a variable
+}
+
+// maxPreviewLength is the length of the previews of HeapSnapshot past which they're truncated.
+const maxPreviewLength = 80
+
+// HeapSnapshot returns the objects reachable from the global object and from the current call stack (the variables
+// of the scopes of the frames and the values on the vm stack), breadth first so that the path of each object is one
+// of the shortest. Objects are followed through their own properties (including the accessors, which aren't called),
+// their prototype, the contents of arrays, maps and sets, the scopes captured by functions and what bound functions
+// are bound to. The targets of proxies are followed but their traps aren't called. No code of the program is run,
+// including to render the previews.
+func (dbg *Debugger) HeapSnapshot() []ObjectSummary {
+	vm := dbg.vm
+	type heapItem struct {
+		obj  *Object
+		path string
+	}
+	var queue []heapItem
+	seen := make(map[*Object]bool)
+	add := func(v Value, path string) {
+		if obj, ok := v.(*Object); ok && !seen[obj] {
+			seen[obj] = true
+			queue = append(queue, heapItem{obj: obj, path: path})
+		}
+	}
+	addStash := func(st *stash, path string) {
+		for ; st != nil; st = st.outer {
+			if st.obj != nil {
+				add(st.obj, path+".<with>")
+				continue
+			}
+			for name := range st.names {
+				if v, ok := stashValue(st, name); ok {
+					add(v, path+"."+name.String())
+				}
+			}
+			for i, v := range st.extraArgs {
+				add(v, fmt.Sprintf("%s.<arguments>[%d]", path, i))
+			}
+		}
+	}
+
+	add(vm.r.globalObject, "globalThis")
+	addStash(vm.stash, "<scope>")
+	for i := len(vm.callStack) - 1; i >= 0; i-- {
+		addStash(vm.callStack[i].stash, "<scope>")
+	}
+	for i := 0; i < vm.sp && i < len(vm.stack); i++ {
+		add(vm.stack[i], fmt.Sprintf("<stack>[%d]", i))
+	}
+
+	summaries := make([]ObjectSummary, 0, len(queue))
+	for i := 0; i < len(queue); i++ {
+		item := queue[i]
+		summaries = append(summaries, summarizeObject(item.obj, item.path))
+		walkReferences(item.obj, func(name string, v Value) {
+			add(v, item.path+name)
+		})
+	}
+	return summaries
+}
+
+func summarizeObject(obj *Object, path string) ObjectSummary {
+	preview := []rune(previewValue(obj, 0))
+	if len(preview) > maxPreviewLength {
+		preview = append(preview[:maxPreviewLength], []rune("...")...)
+	}
+	return ObjectSummary{
+		Type:    objectType(obj),
+		Size:    estimateSize(obj),
+		Preview: string(preview),
+		Path:    path,
+	}
+}
+
+// previewValue renders val like inspect does but without calling any code: objects show their own data properties,
+// their accessors being rendered as [Getter/Setter], proxies are rendered as [Proxy], functions by their name, e.g.
+// [Function: f], and the objects inspect would render by their String method by their type, e.g. [RegExp].
+func previewValue(val Value, depth int) string {
+	obj, ok := val.(*Object)
+	if !ok {
+		return inspect(val, depth)
+	}
+	if depth > maxInspectDepth {
+		return "[" + objectType(obj) + "]"
+	}
+	var b strings.Builder
+	switch o := obj.self.(type) {
+	case *proxyObject:
+		return "[Proxy]"
+	case *baseObject:
+		if o.class != classObject {
+			return "[" + objectType(obj) + "]"
+		}
+		b.WriteByte('{')
+		for i, key := range o.stringKeys(false, nil) {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			b.WriteString(key.String())
+			b.WriteString(": ")
+			b.WriteString(previewProperty(o.getOwnPropStr(key.string()), depth))
+		}
+		b.WriteByte('}')
+	case *arrayObject, *sparseArrayObject:
+		length := toLength(dataProperty(obj, "length"))
+		b.WriteByte('[')
+		for i := int64(0); i < length && b.Len() <= maxPreviewLength; i++ {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			if prop := obj.self.getOwnPropIdx(valueInt(i)); prop != nil {
+				b.WriteString(previewProperty(prop, depth))
+			}
+		}
+		b.WriteByte(']')
+	case *mapObject:
+		fmt.Fprintf(&b, "Map(%d){", o.m.size)
+		iter := o.m.newIter()
+		for entry, i := iter.next(), 0; entry != nil; entry, i = iter.next(), i+1 {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			b.WriteString(previewValue(entry.key, depth+1))
+			b.WriteString(" => ")
+			b.WriteString(previewValue(entry.value, depth+1))
+		}
+		b.WriteByte('}')
+	case *setObject:
+		fmt.Fprintf(&b, "Set(%d){", o.m.size)
+		iter := o.m.newIter()
+		for entry, i := iter.next(), 0; entry != nil; entry, i = iter.next(), i+1 {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			b.WriteString(previewValue(entry.key, depth+1))
+		}
+		b.WriteByte('}')
+	case *typedArrayObject:
+		name := "TypedArray"
+		if o.defaultCtor != nil {
+			name = functionName(o.defaultCtor)
+		}
+		fmt.Fprintf(&b, "%s(%d)[", name, o.length)
+		for i := 0; i < o.length && b.Len() <= maxPreviewLength; i++ {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			b.WriteString(inspect(o._getIdx(i), depth+1))
+		}
+		b.WriteByte(']')
+	case *dateObject, *weakMapObject, *weakSetObject:
+		return inspect(val, depth) // rendered from their internal state only
+	case *boundFuncObject:
+		fmt.Fprintf(&b, "[Bound Function: %s] {this: %s, args: [", functionName(o.wrapped),
+			previewValue(o.boundThis, depth+1))
+		for i, arg := range o.boundArgs {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			b.WriteString(previewValue(arg, depth+1))
+		}
+		b.WriteString("]}")
+	case *Promise:
+		switch o.state {
+		case PromiseStateFulfilled:
+			fmt.Fprintf(&b, "Promise {<fulfilled>: %s}", previewValue(o.result, depth+1))
+		case PromiseStateRejected:
+			fmt.Fprintf(&b, "Promise {<rejected>: %s}", previewValue(o.result, depth+1))
+		default:
+			b.WriteString("Promise {<pending>}")
+		}
+	default:
+		if _, ok := obj.self.assertCallable(); ok {
+			return "[Function: " + functionName(obj) + "]"
+		}
+		return "[" + objectType(obj) + "]"
+	}
+	return b.String()
+}
+
+// previewProperty is previewValue for the own property prop of an object.
+func previewProperty(prop Value, depth int) string {
+	if p, ok := prop.(*valueProperty); ok {
+		if p.accessor {
+			return "[Getter/Setter]"
+		}
+		prop = p.value
+	}
+	return previewValue(prop, depth+1)
+}
+
+// functionName returns the name of the function f, as its own data property, or "" if it has none.
+func functionName(f *Object) string {
+	if name, ok := dataProperty(f, "name").(valueString); ok {
+		return name.String()
+	}
+	return ""
+}
+
+// objectType returns the name of the constructor of obj, as found on its prototype without calling any code, or its
+// class if it has none.
+func objectType(obj *Object) string {
+	if _, isProxy := obj.self.(*proxyObject); !isProxy {
+		if proto := obj.self.proto(); proto != nil {
+			if _, isProxy := proto.self.(*proxyObject); !isProxy {
+				if ctor, ok := dataProperty(proto, "constructor").(*Object); ok {
+					if name, ok := dataProperty(ctor, "name").(valueString); ok && name.length() > 0 {
+						return name.String()
+					}
+				}
+			}
+		}
+	}
+	return obj.self.className()
+}
+
+// dataProperty returns the value of the own data property name of obj, or nil if it's not a data property.
+func dataProperty(obj *Object, name unistring.String) Value {
+	prop := obj.self.getOwnPropStr(name)
+	if p, ok := prop.(*valueProperty); ok {
+		if p.accessor {
+			return nil
+		}
+		return p.value
+	}
+	return prop
+}
+
+// estimateSize returns a rough estimate of the size of obj in bytes, not counting the values it refers to.
+func estimateSize(obj *Object) int {
+	const objectSize, propertySize, valueSize, entrySize = 64, 32, 16, 48
+	size := objectSize
+	switch o := obj.self.(type) {
+	case *arrayObject:
+		size += len(o.values) * valueSize
+	case *typedArrayObject:
+		size += o.length * o.elemSize
+	case *arrayBufferObject:
+		size += len(o.data)
+	case *mapObject:
+		size += o.m.size * entrySize
+	case *setObject:
+		size += o.m.size * entrySize
+	case *proxyObject:
+		return size
+	}
+	return size + len(obj.self.stringKeys(true, nil))*propertySize
+}
+
+// walkReferences calls f with the objects obj refers to, along with the suffix of the path to them.
+func walkReferences(obj *Object, f func(name string, v Value)) {
+	if p, ok := obj.self.(*proxyObject); ok {
+		f(".<target>", p.target)
+		if h, ok := p.handler.(*jsProxyHandler); ok {
+			f(".<handler>", h.handler)
+		}
+		return
+	}
+	if proto := obj.self.proto(); proto != nil {
+		f(".__proto__", proto)
+	}
+	for _, key := range obj.self.stringKeys(true, nil) {
+		name := key.string()
+		switch p := obj.self.getOwnPropStr(name).(type) {
+		case *valueProperty:
+			if p.accessor {
+				if p.getterFunc != nil {
+					f(".<get "+name.String()+">", p.getterFunc)
+				}
+				if p.setterFunc != nil {
+					f(".<set "+name.String()+">", p.setterFunc)
+				}
+			} else {
+				f("."+name.String(), p.value)
+			}
+		case Value:
+			f("."+name.String(), p)
+		}
+	}
+	for _, sym := range obj.self.symbols(true, nil) {
+		switch p := obj.self.getOwnPropSym(sym.(*Symbol)).(type) {
+		case *valueProperty:
+			if !p.accessor {
+				f("["+sym.String()+"]", p.value)
+			}
+		case Value:
+			f("["+sym.String()+"]", p)
+		}
+	}
+	switch o := obj.self.(type) {
+	case *mapObject:
+		iter := o.m.newIter()
+		for entry, i := iter.next(), 0; entry != nil; entry, i = iter.next(), i+1 {
+			f(fmt.Sprintf(".<key %d>", i), entry.key)
+			f(fmt.Sprintf(".<value %d>", i), entry.value)
+		}
+	case *setObject:
+		iter := o.m.newIter()
+		for entry, i := iter.next(), 0; entry != nil; entry, i = iter.next(), i+1 {
+			f(fmt.Sprintf(".<value %d>", i), entry.key)
+		}
+	case *boundFuncObject:
+		f(".<target>", o.wrapped)
+		f(".<this>", o.boundThis)
+		for i, arg := range o.boundArgs {
+			f(fmt.Sprintf(".<args>[%d]", i), arg)
+		}
+	}
+	var fn *baseJsFuncObject
+	switch o := obj.self.(type) {
+	case *funcObject:
+		fn = &o.baseJsFuncObject
+	case *methodFuncObject:
+		fn = &o.baseJsFuncObject
+	case *arrowFuncObject:
+		fn = &o.baseJsFuncObject
+	case *classFuncObject:
+		fn = &o.baseJsFuncObject
+	}
+	if fn != nil {
+		for st := fn.stash; st != nil && st.obj == nil; st = st.outer {
+			for name := range st.names {
+				if v, ok := stashValue(st, name); ok {
+					f(".<closure>."+name.String(), v)
+				}
+			}
+		}
+	}
+}
+
+// Variables returns everything visible from the current position in one map: the variables of the current scope and
+// of the enclosing ones (inner ones shadowing the outer), including arguments, the globals, and this.
+func (dbg *Debugger) Variables() map[string]Value {
+	vars := dbg.visibleVariables()
+	vars["this"] = dbg.this()
+	return vars
+}
+
+// visibleVariables collects the variables visible from the current position, the inner ones shadowing the outer.
+func (dbg *Debugger) visibleVariables() map[string]Value {
+	vars := make(map[string]Value)
+	for st := dbg.vm.stash; st != nil; st = st.outer {
+		for name := range st.names {
+			if _, exists := vars[name.String()]; exists || name == thisBindingName {
+				continue
+			}
+			if val, ok := stashValue(st, name); ok {
+				vars[name.String()] = val
+			}
+		}
+	}
+	globals, _ := dbg.GetGlobalVariables()
+	for name, val := range globals {
+		if _, exists := vars[name]; !exists {
+			vars[name] = val
+		}
+	}
+	return vars
+}
+
+// stashValue returns the value of name in st, reporting false for bindings which haven't been initialised yet.
+func stashValue(st *stash, name unistring.String) (val Value, ok bool) {
+	defer func() {
+		if x := recover(); x != nil {
+			val, ok = nil, false
+		}
+	}()
+	return st.getByName(name)
+}
+
+func (dbg *Debugger) Print(varName string) (string, error) {
+	if varName == "" {
+		return "", errors.New("please specify variable name")
+	}
+	if dbg.vm.prg == nil {
+		return "", ErrNoProgram
+	}
+	val, err := dbg.getValue(varName)
+	if _, unresolved := val.(valueUnresolved); unresolved {
+		if varName == lastResultName && dbg.lastResult != nil {
+			val = dbg.lastResult
+		}
+	} else if val != nil && err == nil {
+		dbg.lastResult = val
+	}
+
+	if val == Undefined() {
+		return fmt.Sprint(dbg.vm.prg.values), err
+	} else {
+		// FIXME: val.ToString() causes debugger to exit abruptly
+		return dbg.format(val), err
+	}
+}
+
+// SetValueFormatter sets the function used to render values as text, e.g. by Print. Passing nil restores the
+// default rendering.
+func (dbg *Debugger) SetValueFormatter(f func(Value) string) {
+	dbg.formatter = f
+}
+
+func (dbg *Debugger) format(val Value) string {
+	if val == nil {
+		return fmt.Sprint(val)
+	}
+	if dbg.formatter == nil {
+		return inspect(val, 0)
+	}
+	return dbg.formatter(val)
+}
+
+// maxInspectDepth is how deep inspect goes into collections nested in collections, which also stops the ones
+// containing themselves.
+const maxInspectDepth = 2
+
+// inspect renders val the way Print does by default. Maps, sets and typed arrays show their contents, e.g.
+// Map(2){a => 1, b => 2}, Set(3){1,2,3} and Int32Array(2)[1,2], and bound functions what they were bound to, e.g.
+// [Bound Function: add] {this: undefined, args: [1]}, and promises their state and what they settled with, e.g.
+// Promise {<pending>}, Promise {<fulfilled>: 1} and Promise {<rejected>: Error: boom}. Proxies are rendered by what
+// their traps report, within bounds, see inspectProxy. Weak maps and sets are only labelled, e.g. [WeakMap]. Plain
+// objects show their own enumerable properties, e.g. {a: 1, b: <error: boom>} where getting b throws. Numbers are
+// rendered like console.log does, which is their String except for -0, e.g. 42, 1.5, -0, NaN, -Infinity and 1e+21.
+// Anything else is rendered by its String method.
+func inspect(val Value, depth int) string {
+	if f, ok := val.(valueFloat); ok && f == 0 && math.Signbit(float64(f)) {
+		return "-0"
+	}
+	obj, ok := val.(*Object)
+	if !ok {
+		return safeString(val)
+	}
+	if depth > maxInspectDepth {
+		if _, isProxy := obj.self.(*proxyObject); isProxy {
+			return "[Proxy]" // its String method would run its traps unbounded
+		}
+		return safeString(val)
+	}
+	var b strings.Builder
+	switch o := obj.self.(type) {
+	case *baseObject:
+		if o.class != classObject {
+			return safeString(val)
+		}
+		inspectProperties(&b, obj, obj.Keys(), depth)
+	case *proxyObject:
+		return inspectProxy(obj, depth)
+	case *weakMapObject:
+		return "[WeakMap]" // the keys aren't enumerable, and holding on to them would keep them alive
+	case *weakSetObject:
+		return "[WeakSet]"
+	case *mapObject:
+		fmt.Fprintf(&b, "Map(%d){", o.m.size)
+		iter := o.m.newIter()
+		for entry, i := iter.next(), 0; entry != nil; entry, i = iter.next(), i+1 {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			b.WriteString(inspect(entry.key, depth+1))
+			b.WriteString(" => ")
+			b.WriteString(inspect(entry.value, depth+1))
+		}
+		b.WriteByte('}')
+	case *setObject:
+		fmt.Fprintf(&b, "Set(%d){", o.m.size)
+		iter := o.m.newIter()
+		for entry, i := iter.next(), 0; entry != nil; entry, i = iter.next(), i+1 {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			b.WriteString(inspect(entry.key, depth+1))
+		}
+		b.WriteByte('}')
+	case *typedArrayObject:
+		name := "TypedArray"
+		if o.defaultCtor != nil {
+			name = nilSafe(o.defaultCtor.self.getStr("name", nil)).String()
+		}
+		fmt.Fprintf(&b, "%s(%d)[", name, o.length)
+		for i := 0; i < o.length; i++ {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			b.WriteString(inspect(o._getIdx(i), depth+1))
+		}
+		b.WriteByte(']')
+	case *dateObject:
+		if !o.isSet() {
+			return "Invalid Date"
+		}
+		fmt.Fprintf(&b, "Date(%s)", isoDateString(o.timeUTC()))
+	case *boundFuncObject:
+		name := ""
+		prop := o.wrapped.self.getOwnPropStr("name")
+		if p, ok := prop.(*valueProperty); ok && !p.accessor {
+			prop = p.value
+		}
+		if str, ok := prop.(valueString); ok {
+			name = str.String()
+		}
+		fmt.Fprintf(&b, "[Bound Function: %s] {this: %s, args: [", name, inspect(o.boundThis, depth+1))
+		for i, arg := range o.boundArgs {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			b.WriteString(inspect(arg, depth+1))
+		}
+		b.WriteString("]}")
+	case *Promise:
+		switch o.state {
+		case PromiseStateFulfilled:
+			fmt.Fprintf(&b, "Promise {<fulfilled>: %s}", inspect(o.result, depth+1))
+		case PromiseStateRejected:
+			fmt.Fprintf(&b, "Promise {<rejected>: %s}", inspect(o.result, depth+1))
+		default:
+			b.WriteString("Promise {<pending>}")
+		}
+	default:
+		return safeString(val)
+	}
+	return b.String()
+}
+
+// inspectProperties renders the given properties of obj like {a: 1, b: 2}.
+func inspectProperties(b *strings.Builder, obj *Object, keys []string, depth int) {
+	b.WriteByte('{')
+	for i, key := range keys {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(key)
+		b.WriteString(": ")
+		var v Value
+		if ex := obj.runtime.vm.try(func() {
+			v = obj.self.getStr(unistring.NewFromString(key), nil)
+		}); ex != nil {
+			fmt.Fprintf(b, "<error: %s>", thrownMessage(ex))
+		} else {
+			b.WriteString(inspect(v, depth+1))
+		}
+	}
+	b.WriteByte('}')
+}
+
+// maxProxyTraps is how many traps may be called while inspecting a proxy, including the ones of the proxies nested in
+// it, and maxProxyCallDepth how deep the calls they make may nest.
+const (
+	maxProxyTraps     = 1000
+	maxProxyCallDepth = 100
+)
+
+// errProxyTrapLimit stops the traps of a proxy being inspected once maxProxyTraps of them have been called.
+var errProxyTrapLimit = errors.New("too many proxy traps called")
+
+// inspectProxy renders a proxy by its own enumerable properties, as its traps report them, e.g. Proxy {a: 1}. As the
+// traps may loop (or recurse) forever the number of them called and the depth of their calls are bounded, the proxy
+// is rendered as [Proxy] if they are exceeded.
+func inspectProxy(obj *Object, depth int) (str string) {
+	vm := obj.runtime.vm
+	if !vm.limitProxyTraps {
+		// this is the outermost proxy, which sets the bounds for the nested ones and is the one rendered as [Proxy]
+		maxCallStackSize := vm.maxCallStackSize
+		vm.limitProxyTraps, vm.proxyTraps = true, maxProxyTraps
+		if size := len(vm.callStack) + maxProxyCallDepth; size < maxCallStackSize {
+			vm.maxCallStackSize = size
+		}
+		defer func() {
+			vm.limitProxyTraps, vm.maxCallStackSize = false, maxCallStackSize
+			if x := recover(); x != nil {
+				ex, ok := x.(*uncatchableException)
+				if !ok {
+					panic(x)
+				}
+				if _, overflow := ex.err.(*StackOverflowError); !overflow && ex.err != errProxyTrapLimit {
+					panic(x)
+				}
+				str = "[Proxy]"
+			}
+		}()
+	}
+	var keys []string
+	if ex := vm.try(func() {
+		keys = obj.Keys()
+	}); ex != nil {
+		return fmt.Sprintf("Proxy <error: %s>", thrownMessage(ex))
+	}
+	var b strings.Builder
+	b.WriteString("Proxy ")
+	inspectProperties(&b, obj, keys, depth)
+	return b.String()
+}
+
+// safeString is the String method of val, rendering what a throwing toString method throws rather than panicking.
+func safeString(val Value) string {
+	obj, ok := val.(*Object)
+	if !ok {
+		return fmt.Sprint(val)
+	}
+	var str string
+	if ex := obj.runtime.vm.try(func() {
+		str = obj.String()
+	}); ex != nil {
+		return fmt.Sprintf("<error: %s>", thrownMessage(ex))
+	}
+	return str
+}
+
+// thrownMessage returns the message of the error thrown with ex, or what's thrown if it's not an error.
+func thrownMessage(ex *Exception) string {
+	obj, ok := ex.val.(*Object)
+	if !ok {
+		return fmt.Sprint(ex.val)
+	}
+	if _, isError := obj.self.(*errorObject); isError {
+		prop := obj.self.getOwnPropStr("message")
+		if p, ok := prop.(*valueProperty); ok && !p.accessor {
+			prop = p.value
+		}
+		if str, ok := prop.(valueString); ok {
+			return str.String()
+		}
+	}
+	// not its String method, which might throw again
+	return fmt.Sprintf("[object %s]", obj.self.className())
+}
+
+// RunScript runs commands one after the other and returns the result of each, in order. A failing command doesn't
+// stop the script, its error is recorded in its Result and the next command is run. The commands are:
+//
+//	break <file>:<line>, b   sets a breakpoint, results in its ID
+//	clear <file>:<line>      clears a breakpoint
+//	continue, c              results in the activation reason
+//	next, n                  results in the line reached
+//	step, s                  steps in, results in the line reached
+//	print <name>, p          results in the rendering of the variable
+//	exec <expr>, e           results in the value of the expression and the variables it assigns to
+func (dbg *Debugger) RunScript(commands []string) []Result {
+	results := make([]Result, 0, len(commands))
+	for _, command := range commands {
+		results = append(results, dbg.runCommand(command))
+	}
+	return results
+}
+
+func (dbg *Debugger) runCommand(command string) Result {
+	command = strings.TrimSpace(command)
+	name, args := command, ""
+	if i := strings.IndexAny(command, " \t"); i >= 0 {
+		name, args = command[:i], strings.TrimSpace(command[i+1:])
+	}
+	switch name {
+	case "break", "b", "clear":
+		idx := strings.LastIndexByte(args, ':')
+		if idx < 0 {
+			return Result{Err: fmt.Errorf("expected <file>:<line>, got %q", args)}
+		}
+		line, err := strconv.Atoi(args[idx+1:])
+		if err != nil {
+			return Result{Err: fmt.Errorf("invalid line %q", args[idx+1:])}
+		}
+		if name == "clear" {
+			return Result{Err: dbg.ClearBreakpoint(args[:idx], line)}
+		}
+		id, err := dbg.SetBreakpoint(args[:idx], line)
+		if err != nil {
+			return Result{Err: err}
+		}
+		return Result{Value: intToValue(int64(id))}
+	case "continue", "c":
+		return Result{Value: newStringValue(string(dbg.Continue()))}
+	case "next", "n", "step", "s":
+		var err error
+		if name == "next" || name == "n" {
+			err = dbg.Next()
+		} else {
+			err = dbg.StepIn()
+		}
+		if err != nil {
+			return Result{Err: err}
+		}
+		return Result{Value: intToValue(int64(dbg.Line()))}
+	case "print", "p":
+		str, err := dbg.Print(args)
+		if err != nil {
+			return Result{Err: err}
+		}
+		return Result{Value: newStringValue(str)}
+	case "exec", "e":
+		return dbg.ExecCommand(args)
+	case "":
+		return Result{Err: errors.New("empty command")}
+	}
+	return Result{Err: fmt.Errorf("unknown command %q", name)}
+}
+
+// InstructionInfo describes an instruction of the current program and the source position it was compiled from.
+type InstructionInfo struct {
+	PC       int
+	Opcode   string // name of the instruction type, e.g. loadVal
+	Filename string
+	Line     int
+	Column   int
+}
+
+// InstructionMap returns the instructions of the current program, which is the code of the current function (the
+// functions it defines have their own programs), indexed by pc. It's the data Line and Filename look up.
+func (dbg *Debugger) InstructionMap() []InstructionInfo {
+	prg := dbg.vm.prg
+	if prg == nil {
+		return nil
+	}
+	instructions := make([]InstructionInfo, len(prg.code))
+	for pc, ins := range prg.code {
+		pos := debugPosition(prg, pc)
+		opcode := fmt.Sprintf("%T", ins)
+		opcode = strings.TrimPrefix(strings.TrimPrefix(opcode, "*"), "goja.")
+		instructions[pc] = InstructionInfo{PC: pc, Opcode: opcode, Filename: pos.Filename, Line: pos.Line, Column: pos.Column}
+	}
+	return instructions
+}
+
+// SourceLine is a line of the source as returned by List.
+type SourceLine struct {
+	Number        int
+	Text          string
+	IsCurrent     bool
+	HasBreakpoint bool
+}
+
+// List returns the lines of the current source, marking the current line and the lines with a breakpoint.
+func (dbg *Debugger) List() ([]SourceLine, error) {
+	if dbg.vm.prg == nil {
+		return nil, ErrNoProgram
+	}
+	// TODO probably better to get only some of the lines, but fine for now
+	lines, err := stringToLines(dbg.vm.prg.src.Source())
+	if err != nil {
+		return nil, err
+	}
+	current := dbg.Line()
+	filename := dbg.Filename()
+	src := make([]SourceLine, len(lines))
+	dbg.bpMu.Lock()
+	defer dbg.bpMu.Unlock()
+	bpFiles := dbg.breakpointFiles(filename)
+	for i, text := range lines {
+		number := i + 1
+		hasBreakpoint := false
+		for _, bpFile := range bpFiles {
+			if _, found := dbg.findBreakpoint(Breakpoint{Filename: bpFile, Line: number}); found {
+				hasBreakpoint = true
+				break
+			}
+		}
+		src[i] = SourceLine{
+			Number:        number,
+			Text:          text,
+			IsCurrent:     number == current,
+			HasBreakpoint: hasBreakpoint,
+		}
 	}
+	return src, nil
 }
 
-func (dbg *Debugger) List() ([]string, error) {
-	// TODO probably better to get only some of the lines, but fine for now
-	return stringToLines(dbg.vm.prg.src.Source())
+// CurrentLineText returns the source of the current line, trimmed, or "" if it's unknown.
+func (dbg *Debugger) CurrentLineText() string {
+	if dbg.vm.prg == nil || dbg.vm.prg.src == nil {
+		return ""
+	}
+	lines, err := stringToLines(dbg.vm.prg.src.Source())
+	if err != nil {
+		return ""
+	}
+	line := dbg.Line() // 1-based
+	if line < 1 || line > len(lines) {
+		return ""
+	}
+	return strings.TrimSpace(lines[line-1])
 }
 
 func stringToLines(s string) (lines []string, err error) {
@@ -196,30 +4068,132 @@ func stringToLines(s string) (lines []string, err error) {
 	return
 }
 
+// breakpoint reports whether there's an enabled breakpoint at the current position, remembering it for hit.
 func (dbg *Debugger) breakpoint() bool {
 	filename := dbg.Filename()
+	dbg.bpMu.Lock()
+	defer dbg.bpMu.Unlock()
+	if dbg.muted {
+		dbg.hitBreakpoint = nil
+		return false
+	}
 	line := dbg.Line()
+	// breakpoints on the lines without code before this one pause here too
+	first := line
+	if lines := dbg.programLines[dbg.vm.prg][filename]; lines != nil {
+		if i := sort.SearchInts(lines, line); i < len(lines) && lines[i] == line {
+			first = 1
+			if i > 0 {
+				first = lines[i-1] + 1
+			}
+		}
+	}
+	for _, bpFile := range dbg.breakpointFiles(filename) {
+		bps := dbg.breakpoints[bpFile]
+		idx, _ := dbg.findBreakpoint(Breakpoint{Filename: bpFile, Line: line + 1})
+		// the closest one wins
+		for idx--; idx >= 0 && bps[idx].Line >= first; idx-- {
+			if bps[idx].Enabled && dbg.breakableAt(filename, line) {
+				bp := bps[idx]
+				dbg.hitBreakpoint = &bp
+				return true
+			}
+		}
+	}
+	dbg.hitBreakpoint = nil
+	return false
+}
 
-	idx := sort.SearchInts(dbg.breakpoints[filename], line)
-	if idx < len(dbg.breakpoints[filename]) && dbg.breakpoints[filename][idx] == line {
+// breakableAt reports whether a breakpoint on the current line (at filename:line) pauses at the current instruction.
+// If the line has the condition of a loop only the condition counts, so that a breakpoint on the header of a for loop
+// pauses once per iteration rather than on the initialization and the update too. Anywhere else does otherwise.
+func (dbg *Debugger) breakableAt(filename string, line int) bool {
+	prg, pc := dbg.vm.prg, dbg.vm.pc
+	if len(prg.loopTests) == 0 {
 		return true
-	} else {
-		return false
 	}
+	i := sort.SearchInts(prg.loopTests, pc)
+	if i < len(prg.loopTests) && prg.loopTests[i] == pc {
+		return true
+	}
+	for _, test := range prg.loopTests {
+		if pos := debugPosition(prg, test); pos.Line == line && pos.Filename == filename {
+			return false
+		}
+	}
+	return true
+}
+
+// ActiveBreakpoint returns the breakpoint the debugger is paused at, the second value is false if it isn't paused at
+// a breakpoint (for example after a step).
+func (dbg *Debugger) ActiveBreakpoint() (Breakpoint, bool) {
+	if dbg.activeBreakpoint == nil {
+		return Breakpoint{}, false
+	}
+	return *dbg.activeBreakpoint, true
 }
 
-func (dbg *Debugger) getLastLine() int {
-	if dbg.lastLine >= 0 {
-		return dbg.lastLine
+// hit is called by the vm when it reaches the breakpoint found by breakpoint, it counts the hit and reports whether
+// it should pause there according to the condition.
+func (dbg *Debugger) hit() bool {
+	bp := dbg.hitBreakpoint
+	dbg.bpMu.Lock()
+	// it may have been changed or removed since it was found
+	if idx, found := dbg.findBreakpoint(*bp); found {
+		dbg.breakpoints[bp.Filename][idx].HitCount++
+		*bp = dbg.breakpoints[bp.Filename][idx]
+	} else {
+		bp.HitCount++
+	}
+	dbg.bpMu.Unlock()
+	if bp.OncePerCall && dbg.currentEntry().fired[bp.ID] {
+		return false
+	}
+	if bp.cond != nil {
+		code, err := bp.cond.compile(dbg, bp.Condition)
+		if err != nil {
+			dbg.setConditionError(bp, err)
+			return false
+		}
+		var v Value
+		dbg.withBinding(hitsName, intToValue(int64(bp.HitCount)), func() {
+			v, err = dbg.runCondition(code)
+		})
+		if err != nil {
+			dbg.setConditionError(bp, err)
+			return false
+		}
+		if !v.ToBoolean() {
+			return false
+		}
+	}
+	if dbg.skipBreakpoint != nil && dbg.skipBreakpoint.sameLocation(*bp) {
+		dbg.skipBreakpoint = nil
+		return false
+	}
+	if bp.OncePerCall {
+		entry := dbg.currentEntry()
+		if entry.fired == nil {
+			entry.fired = make(map[int]bool)
+		}
+		entry.fired[bp.ID] = true
 	}
-	// First executed line (current line) is considered the last line
-	return dbg.Line()
+	return true
 }
 
-func (dbg *Debugger) updateLastLine(lineNumber int) {
-	if dbg.lastLine != lineNumber {
-		dbg.lastLine = lineNumber
+// Depth returns the number of active call frames, including the current one. It's 1 at the global scope.
+func (dbg *Debugger) Depth() int {
+	depth := 0
+	if dbg.vm.pc != -1 {
+		depth++
+	}
+	for i := range dbg.vm.callStack {
+		// frames with pc == -1 are only markers for nested runs (see captureStack)
+		if dbg.vm.callStack[i].pc != -1 {
+			depth++
+		}
 	}
+	return depth
 }
 
 func (dbg *Debugger) callStackDepth() int {
@@ -230,33 +4204,126 @@ func (dbg *Debugger) Line() int {
 	// FIXME: Some lines are skipped, which causes this function to report incorrect lines
 	// TODO: lines inside function are reported differently and the vm.pc is reset from the start
 	// of each function, so account for functions (ref: TestDebuggerStepIn)
-	return dbg.vm.prg.src.Position(dbg.vm.prg.sourceOffset(dbg.vm.pc)).Line
+	if dbg.vm.prg == nil {
+		return 0
+	}
+	return debugPosition(dbg.vm.prg, dbg.vm.pc).Line
 }
 
+// Filename returns the name of the file the current line belongs to, which is the original file when the source
+// has a source map, like Line.
 func (dbg *Debugger) Filename() string {
-	return dbg.vm.prg.src.Name()
+	if dbg.vm.prg == nil {
+		return ""
+	}
+	return debugPosition(dbg.vm.prg, dbg.vm.pc).Filename
+}
+
+// debugPosition returns the source position of the instruction at pc. The instructions before the first one with a
+// position (e.g. the ones setting up a function's frame) get the position of that one instead of the start of the
+// source, and the filename is never empty, so that Line and Filename always agree with the breakpoints.
+func debugPosition(prg *Program, pc int) file.Position {
+	if prg.src == nil {
+		return file.Position{}
+	}
+	offset := prg.sourceOffset(pc)
+	if len(prg.srcMap) > 0 && pc < prg.srcMap[0].pc {
+		offset = prg.srcMap[0].srcPos
+	}
+	pos := prg.src.Position(offset)
+	if pos.Filename == "" {
+		pos.Filename = prg.src.Name()
+	}
+	return pos
 }
 
 func (dbg *Debugger) updateCurrentLine() {
 	dbg.currentLine = dbg.Line()
 }
 
-func (dbg *Debugger) getNextLine() int {
-	for idx := range dbg.vm.prg.code[dbg.vm.pc:] {
-		nextLine := dbg.vm.prg.src.Position(dbg.vm.prg.sourceOffset(dbg.vm.pc + idx + 1)).Line
-		if nextLine > dbg.Line() {
-			return nextLine
+func (dbg *Debugger) safeToRun() bool {
+	return dbg.vm.prg != nil && dbg.vm.pc < len(dbg.vm.prg.code)
+}
+
+func (dbg *Debugger) eval(expr string, strict bool) (Value, error) {
+	key := dbg.evalKey(expr, strict)
+	p := dbg.evalCache.get(key)
+	if p == nil {
+		in, err := parseEval(expr)
+		if err != nil {
+			return nil, err
+		}
+		p, err = dbg.compileEval(in, strict)
+		if err != nil {
+			return nil, err
 		}
+		dbg.evalCache.put(key, p)
 	}
-	return 0
+	return dbg.runEval(p)
 }
 
-func (dbg *Debugger) safeToRun() bool {
-	return dbg.vm.pc < len(dbg.vm.prg.code)
+// evalCacheSize is how many compiled expressions the debugger keeps for reuse by eval.
+const evalCacheSize = 64
+
+// evalKey identifies the code compiled for an expression: besides its source and strictness that depends on the
+// parts of the scope compileEval looks at, which are whether it's global, the kind of the enclosing function and the
+// private names of the enclosing classes.
+type evalKey struct {
+	expr     string
+	strict   bool
+	inGlobal bool
+	funcType funcType
+	privEnv  *privateEnv
+}
+
+func (dbg *Debugger) evalKey(expr string, strict bool) evalKey {
+	key := evalKey{expr: expr, strict: strict, inGlobal: dbg.evalInGlobal(), privEnv: dbg.vm.privEnv}
+	if !key.inGlobal {
+		for s := dbg.vm.stash; s != nil; s = s.outer {
+			if ft := s.funcType; ft != funcNone && ft != funcArrow {
+				key.funcType = ft
+				break
+			}
+		}
+	}
+	return key
+}
+
+// evalCache holds the most recently used programs compiled by eval, so that evaluating the same expression again
+// (like a watch at every pause) needn't parse and compile it again.
+type evalCache struct {
+	programs map[evalKey]*list.Element
+	order    list.List // of *evalCacheEntry, most recently used first
+}
+
+type evalCacheEntry struct {
+	key evalKey
+	prg *Program
+}
+
+func (c *evalCache) get(key evalKey) *Program {
+	e := c.programs[key]
+	if e == nil {
+		return nil
+	}
+	c.order.MoveToFront(e)
+	return e.Value.(*evalCacheEntry).prg
+}
+
+func (c *evalCache) put(key evalKey, prg *Program) {
+	if c.programs == nil {
+		c.programs = make(map[evalKey]*list.Element)
+	}
+	if c.order.Len() >= evalCacheSize {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.programs, oldest.Value.(*evalCacheEntry).key)
+	}
+	c.programs[key] = c.order.PushFront(&evalCacheEntry{key: key, prg: prg})
 }
 
-func (dbg *Debugger) eval(expr string) (v Value, err error) {
-	prg, err := parser.ParseFile(nil, "<eval>", expr, 0)
+func parseEval(expr string) (*ast.Program, error) {
+	in, err := parser.ParseFile(nil, "<eval>", expr, 0)
 	if err != nil {
 		return nil, &CompilerSyntaxError{
 			CompilerError: CompilerError{
@@ -264,7 +4331,11 @@ func (dbg *Debugger) eval(expr string) (v Value, err error) {
 			},
 		}
 	}
+	return in, nil
+}
 
+// compileEval compiles in as if it was a direct eval in the current frame.
+func (dbg *Debugger) compileEval(in *ast.Program, strict bool) (p *Program, err error) {
 	c := newCompiler(true)
 
 	defer func() {
@@ -279,14 +4350,59 @@ func (dbg *Debugger) eval(expr string) (v Value, err error) {
 		}
 	}()
 
-	var this Value
+	c.compile(in, strict, dbg.evalInGlobal(), dbg.vm)
+	return c.p, nil
+}
+
+// evalInGlobal returns whether code compiled by compileEval is global code. Same as a direct eval that depends on the
+// scope, not on this (which is the global object in sloppy functions too). Either way unresolved names are looked up
+// in the global object.
+func (dbg *Debugger) evalInGlobal() bool {
+	for s := dbg.vm.stash; s != nil; s = s.outer {
+		if s.isVariable() {
+			return false
+		}
+	}
+	return true
+}
+
+// ValueStack returns a copy of the operand stack of the current frame, from its base to the top. Besides the frame's
+// this, arguments and locals it holds the intermediate values of the expression being evaluated.
+func (dbg *Debugger) ValueStack() []Value {
+	sb := dbg.vm.sb
+	if sb < 0 {
+		sb = 0
+	}
+	if sb >= dbg.vm.sp {
+		return nil
+	}
+	stack := make([]Value, dbg.vm.sp-sb)
+	copy(stack, dbg.vm.stack[sb:dbg.vm.sp])
+	return stack
+}
+
+// StackBase returns the index in the vm stack of the current frame base, which is where its this is. It's -1 in the
+// global code, which has no frame on the stack.
+func (dbg *Debugger) StackBase() int {
+	return dbg.vm.sb
+}
+
+// this returns the this value of the current frame.
+func (dbg *Debugger) this() Value {
 	if dbg.vm.sb >= 0 {
-		this = dbg.vm.stack[dbg.vm.sb]
-	} else {
-		this = dbg.vm.r.globalObject
+		return dbg.vm.stack[dbg.vm.sb]
 	}
+	return dbg.vm.r.globalObject
+}
 
-	c.compile(prg, false, true, this == dbg.vm.r.globalObject)
+// runEval runs the code compiled by compileEval in the current frame.
+func (dbg *Debugger) runEval(p *Program) (v Value, err error) {
+	return dbg.runEvalWith(p, dbg.vm.run)
+}
+
+// runEvalWith is runEval running the code with run.
+func (dbg *Debugger) runEvalWith(p *Program, run func()) (v Value, err error) {
+	this := dbg.this()
 
 	defer func() {
 		if x := recover(); x != nil {
@@ -302,13 +4418,16 @@ func (dbg *Debugger) eval(expr string) (v Value, err error) {
 	}()
 
 	dbg.vm.pushCtx()
-	dbg.vm.prg = c.p
+	dbg.vm.prg = p
 	dbg.vm.pc = 0
 	dbg.vm.args = 0
 	dbg.vm.result = _undefined
 	dbg.vm.sb = dbg.vm.sp
 	dbg.vm.push(this)
-	dbg.vm.run()
+	// if it throws (even from a nested call) this restores the state of the vm to the one above
+	if ex := dbg.vm.try(run); ex != nil {
+		return nil, ex
+	}
 	v = dbg.vm.result
 	return v, err
 }
@@ -358,7 +4477,601 @@ func (dbg *Debugger) GetGlobalVariables() (map[string]Value, error) {
 	return globals, nil
 }
 
+// ClosureVariables returns the variables the current function captured from the enclosing scopes, that is the ones
+// declared in the scopes between its own and the global one. The inner variables shadow the outer ones.
+func (dbg *Debugger) ClosureVariables() map[string]Value {
+	vars := make(map[string]Value)
+	for st := dbg.calleeStash(); st != nil && st != &dbg.vm.r.global.stash; st = st.outer {
+		for name := range st.names {
+			if _, exists := vars[name.String()]; exists || name == thisBindingName || name == "arguments" {
+				continue
+			}
+			if val, ok := stashValue(st, name); ok {
+				vars[name.String()] = val
+			}
+		}
+	}
+	return vars
+}
+
+// CallInfo is how the function of the current frame was called compared to how it's declared, see
+// Debugger.CallInfo.
+type CallInfo struct {
+	Args      int      // number of arguments passed
+	Params    int      // number of declared parameters, not counting the rest parameter
+	Rest      bool     // whether there is a rest parameter
+	Defaulted []string // the parameters with a default value no argument was passed for, by their source
+}
+
+// CallInfo returns the number of arguments passed to the current function and the parameters it declares, e.g. to
+// spot a call passing fewer arguments than expected. A parameter passed undefined gets its default value too, but
+// isn't reported in Defaulted. It's the zero CallInfo in global code and if the source of the function isn't
+// available.
+func (dbg *Debugger) CallInfo() CallInfo {
+	if dbg.callee() == nil {
+		return CallInfo{}
+	}
+	p, err := dbg.CurrentFunctionAST()
+	if err != nil {
+		return CallInfo{}
+	}
+	var params *ast.ParameterList
+	walkAST(p, func(node interface{}, children func()) {
+		if params != nil {
+			return
+		}
+		switch n := node.(type) {
+		case *ast.FunctionLiteral:
+			params = n.ParameterList
+		case *ast.ArrowFunctionLiteral:
+			params = n.ParameterList
+		default:
+			children()
+		}
+	})
+	if params == nil {
+		return CallInfo{}
+	}
+	info := CallInfo{Args: dbg.vm.args, Params: len(params.List), Rest: params.Rest != nil}
+	src := p.File.Source()
+	for i, param := range params.List {
+		if param.Initializer != nil && i >= info.Args {
+			info.Defaulted = append(info.Defaulted, src[param.Target.Idx0()-1:param.Target.Idx1()-1])
+		}
+	}
+	return info
+}
+
+// Arguments returns the arguments of the current call: the named parameters (including the ones which weren't passed,
+// which are undefined unless they have been assigned) followed by the extra arguments. It returns nil if the current
+// frame isn't a JS function or its arguments aren't accessible.
+func (dbg *Debugger) Arguments() []Value {
+	st, numArgs := dbg.argsStash()
+	if st == nil {
+		return nil
+	}
+	args := make([]Value, 0, numArgs+len(st.extraArgs))
+	args = append(args, st.values[:numArgs]...)
+	return append(args, st.extraArgs...)
+}
+
+// SetArgument sets the argument i of the current call, as returned by Arguments. Setting a named parameter is the
+// same as assigning to it (in sloppy mode this is also reflected in the arguments object), extra arguments aren't
+// seen by the function any more once the arguments object and the rest parameter have been created.
+func (dbg *Debugger) SetArgument(i int, v Value) error {
+	st, numArgs := dbg.argsStash()
+	if st == nil {
+		return errors.New("arguments of the current frame are not accessible")
+	}
+	if i < 0 || i >= numArgs+len(st.extraArgs) {
+		return fmt.Errorf("argument index %d out of range", i)
+	}
+	if i < numArgs {
+		st.values[i] = v
+	} else {
+		st.extraArgs[i-numArgs] = v
+	}
+	return nil
+}
+
+// RestartFrame unwinds the call stack down to the frame frameIndex (numbered as by CallStack, the current one being 0)
+// and runs its function again from the start, with the same this and the current values of its arguments (see
+// Arguments). The frames above it are discarded without running their finally blocks or closing their iterators.
+// The debugger stays paused and the function restarts on Continue or a step. It's only possible while paused at a
+// breakpoint, a debugger statement or after a step, and for frames of JS functions which can be reached without
+// unwinding native code or leaving a try block.
+func (dbg *Debugger) RestartFrame(frameIndex int) error {
+	vm := dbg.vm
+	switch dbg.reason {
+	case BreakpointActivation, DebuggerStatementActivation, StepActivation, FunctionBreakpointActivation:
+	case "":
+		return errors.New("not paused")
+	default:
+		return fmt.Errorf("cannot restart a frame while paused by %s", dbg.reason)
+	}
+	if frameIndex < 0 || frameIndex > len(vm.callStack) {
+		return fmt.Errorf("frame index %d out of range", frameIndex)
+	}
+	depth := len(vm.callStack) - frameIndex
+	var target context
+	if depth == len(vm.callStack) {
+		vm.saveCtx(&target)
+	} else {
+		target = vm.callStack[depth]
+	}
+	for i := depth; i < len(vm.callStack); i++ {
+		if ctx := &vm.callStack[i]; ctx.pc == -1 || ctx.prg == nil {
+			return fmt.Errorf("cannot unwind native code down to frame %d", frameIndex)
+		}
+	}
+	f := dbg.calleeAt(target.sb)
+	st, numArgs := frameArgsStash(f, target.prg, target.stash)
+	if st == nil {
+		return fmt.Errorf("frame %d is not a call of a JS function", frameIndex)
+	}
+	if len(dbg.runs) == 0 {
+		return errors.New("not running")
+	}
+	if run := dbg.runs[len(dbg.runs)-1]; run.depth > depth || run.depth == depth && (run.pc != 0 || run.prg != target.prg) {
+		return fmt.Errorf("cannot leave the try block or the native call frame %d is in", frameIndex)
+	}
+
+	args := make([]Value, 0, numArgs+len(st.extraArgs))
+	args = append(args, st.values[:numArgs]...)
+	args = append(args, st.extraArgs...)
+	for len(vm.callStack) > depth {
+		vm.popCtx()
+	}
+	if depth < len(dbg.frameEntries) {
+		if entry := &dbg.frameEntries[depth]; entry.prg == target.prg {
+			entry.fired = nil
+			iterTail := vm.iterStack[entry.iterLen:]
+			for i := range iterTail {
+				iterTail[i] = iterStackItem{}
+			}
+			vm.iterStack = vm.iterStack[:entry.iterLen]
+			refTail := vm.refStack[entry.refLen:]
+			for i := range refTail {
+				refTail[i] = nil
+			}
+			vm.refStack = vm.refStack[:entry.refLen]
+		}
+	}
+	// set the frame up as it was when the function was called, the stack holding the callee, this and the arguments
+	vm.stash = f.stash
+	vm.privEnv = f.privEnv
+	vm.sp = vm.sb + 1
+	for _, arg := range args {
+		vm.push(arg)
+	}
+	vm.args = len(args)
+	vm.pc = 0
+	dbg.frameDepth = len(vm.callStack)
+	dbg.lastBreakpoint.filename = ""
+	dbg.lastBreakpoint.line = -1
+	return nil
+}
+
+// argsStash returns the stash of the current function which holds its arguments, and the number of named
+// parameters. Code compiled for debugging always keeps the arguments in the stash.
+func (dbg *Debugger) argsStash() (*stash, int) {
+	return frameArgsStash(dbg.callee(), dbg.vm.prg, dbg.vm.stash)
+}
+
+// frameArgsStash is argsStash for the frame of f running prg with the stash st.
+func frameArgsStash(f *baseJsFuncObject, prg *Program, st *stash) (*stash, int) {
+	if f == nil || f.prg != prg || len(f.prg.code) == 0 {
+		return nil, 0
+	}
+	enter, ok := f.prg.code[0].(*enterFunc)
+	if !ok || !enter.argsToStash {
+		return nil, 0
+	}
+	// the function's own stash is the one created on top of the stash it captured, the ones in between (if any)
+	// are block scopes
+	for ; st != nil; st = st.outer {
+		if st.outer == f.stash {
+			return st, int(enter.numArgs)
+		}
+	}
+	return nil, 0
+}
+
+// ScopeKind is the kind of a ScopeGroup.
+type ScopeKind string
+
+const (
+	LocalScope   ScopeKind = "local"   // the variables of the current function
+	BlockScope   ScopeKind = "block"   // let, const and class declarations of a block of the current code
+	ClosureScope ScopeKind = "closure" // the scopes the current function was created in
+	ScriptScope  ScopeKind = "script"  // top-level let, const and class declarations
+	GlobalScope  ScopeKind = "global"  // the properties of the global object
+)
+
+// ScopeGroup is one of the scopes visible from the current position.
+type ScopeGroup struct {
+	Kind      ScopeKind
+	Label     string
+	Variables map[string]Value
+}
+
+// ScopeChain returns the scopes visible from the current position, innermost first, the way debugger UIs usually
+// show them. Empty block, closure and script scopes are left out.
+func (dbg *Debugger) ScopeChain() []ScopeGroup {
+	var groups []ScopeGroup
+	add := func(kind ScopeKind, label string, vars map[string]Value) {
+		if len(vars) > 0 || kind == LocalScope || kind == GlobalScope {
+			groups = append(groups, ScopeGroup{Kind: kind, Label: label, Variables: vars})
+		}
+	}
+
+	global := &dbg.vm.r.global.stash
+	var closure *stash
+	if f := dbg.callee(); f != nil {
+		closure = f.stash
+	}
+	own := true // st belongs to the current code rather than to a closure
+	for st := dbg.vm.stash; st != nil; st = st.outer {
+		if st.obj != nil { // with statement
+			continue
+		}
+		switch {
+		case st == global:
+			add(ScriptScope, "Script", stashVariables(st))
+		case !own:
+			add(ClosureScope, "Closure", stashVariables(st))
+		case st.funcType == funcNone:
+			add(BlockScope, "Block", stashVariables(st))
+		default:
+			label := dbg.vm.prg.funcName.String()
+			if label == "" {
+				label = "(anonymous)"
+			}
+			add(LocalScope, label, stashVariables(st))
+		}
+		if closure != nil && st.outer == closure {
+			own = false
+		}
+	}
+	globals, _ := dbg.GetGlobalVariables()
+	add(GlobalScope, "Global", globals)
+	return groups
+}
+
+// stashVariables returns the initialised variables declared in st.
+func stashVariables(st *stash) map[string]Value {
+	vars := make(map[string]Value, len(st.names))
+	for name := range st.names {
+		if name == thisBindingName || name == "arguments" {
+			continue
+		}
+		if val, ok := stashValue(st, name); ok {
+			vars[name.String()] = val
+		}
+	}
+	return vars
+}
+
+// calleeStash returns the stash captured by the function of the current frame (i.e. the one it was created in),
+// or nil if the current frame isn't a JS function.
+func (dbg *Debugger) calleeStash() *stash {
+	if f := dbg.callee(); f != nil {
+		return f.stash
+	}
+	return nil
+}
+
+// callee returns the JS function of the current frame, or nil in global code.
+func (dbg *Debugger) callee() *baseJsFuncObject {
+	return dbg.calleeAt(dbg.vm.sb)
+}
+
+// calleeAt returns the JS function of the frame with the stack base sb.
+func (dbg *Debugger) calleeAt(sb int) *baseJsFuncObject {
+	if sb <= 0 {
+		return nil
+	}
+	if obj, ok := dbg.vm.stack[sb-1].(*Object); ok {
+		switch f := obj.self.(type) {
+		case *funcObject:
+			return &f.baseJsFuncObject
+		case *methodFuncObject:
+			return &f.baseJsFuncObject
+		case *arrowFuncObject:
+			return &f.baseJsFuncObject
+		case *classFuncObject:
+			return &f.baseJsFuncObject
+		}
+	}
+	return nil
+}
+
+// CurrentFunctionAST returns the AST of the source of the current function, or of the whole program in global
+// code. For functions the top-level statement of the returned program is the function itself (object and class
+// methods are wrapped in a class expression so that they can be parsed), positions are relative to its source.
+// The result is cached per function, and per file for global code.
+func (dbg *Debugger) CurrentFunctionAST() (*ast.Program, error) {
+	prg := dbg.vm.prg
+	if prg == nil {
+		return nil, ErrNoProgram
+	}
+	if p, exists := dbg.asts[prg]; exists {
+		return p, nil
+	}
+	var src string
+	if f := dbg.callee(); f != nil && f.prg == prg {
+		src = f.src
+	} else if dbg.vm.sb <= 0 && prg.src != nil {
+		return dbg.parseSource(prg)
+	} else {
+		return nil, errors.New("source of the current function is not available")
+	}
+
+	p, err := parser.ParseFile(nil, prg.src.Name(), src, 0)
+	if err != nil {
+		// anonymous function expressions and methods can't be parsed as they are
+		for _, wrapped := range []string{"(" + src + ")", "(class {" + src + "})"} {
+			if p, err = parser.ParseFile(nil, prg.src.Name(), wrapped, 0); err == nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if dbg.asts == nil {
+		dbg.asts = make(map[*Program]*ast.Program)
+	}
+	dbg.asts[prg] = p
+	return p, nil
+}
+
+// walkScopes walks the tree rooted at root like walkAST, calling visit (unless it's nil) with every node and declare
+// with every declared identifier and the node of the scope it's declared in: the function for var declarations,
+// parameters and the names of function expressions, and the innermost block (or function, catch clause or loop) for
+// lexical declarations and the names of function and class declarations. scope is the one of the declarations which
+// aren't in a function or block of root, they aren't reported if it's nil.
+func walkScopes(root ast.Node, scope ast.Node, declare func(scope ast.Node, id *ast.Identifier), visit func(node interface{})) {
+	fnScope, blockScope := scope, scope
+	declareIn := func(scope ast.Node) func(*ast.Identifier) {
+		return func(id *ast.Identifier) {
+			if scope != nil {
+				declare(scope, id)
+			}
+		}
+	}
+	declareAll := func(scope ast.Node, bindings []*ast.Binding) {
+		for _, b := range bindings {
+			patternIdentifiers(b.Target, declareIn(scope))
+		}
+	}
+	walkAST(root, func(node interface{}, children func()) {
+		if visit != nil {
+			visit(node)
+		}
+		savedFn, savedBlock := fnScope, blockScope
+		defer func() {
+			fnScope, blockScope = savedFn, savedBlock
+		}()
+		switch n := node.(type) {
+		case *ast.VariableStatement:
+			declareAll(fnScope, n.List)
+		case *ast.ForLoopInitializerVarDeclList:
+			declareAll(fnScope, n.List)
+		case *ast.ForIntoVar:
+			declareAll(fnScope, []*ast.Binding{n.Binding})
+		case *ast.LexicalDeclaration:
+			declareAll(blockScope, n.List)
+		case *ast.ForLoopInitializerLexicalDecl:
+			declareAll(blockScope, n.LexicalDeclaration.List)
+		case *ast.ForDeclaration:
+			patternIdentifiers(n.Target, declareIn(blockScope))
+		case *ast.FunctionDeclaration:
+			if n.Function.Name != nil {
+				declareIn(blockScope)(n.Function.Name)
+			}
+		case *ast.ClassDeclaration:
+			if n.Class.Name != nil {
+				declareIn(blockScope)(n.Class.Name)
+			}
+		case *ast.FunctionLiteral:
+			fnScope, blockScope = n, n
+			if n.Name != nil { // the name of a function expression is only visible inside it
+				declareIn(n)(n.Name)
+			}
+			declareAll(n, n.ParameterList.List)
+			patternIdentifiers(n.ParameterList.Rest, declareIn(n))
+		case *ast.ArrowFunctionLiteral:
+			fnScope, blockScope = n, n
+			declareAll(n, n.ParameterList.List)
+			patternIdentifiers(n.ParameterList.Rest, declareIn(n))
+		case *ast.CatchStatement:
+			blockScope = n
+			if n.Parameter != nil {
+				patternIdentifiers(n.Parameter, declareIn(n))
+			}
+		case *ast.BlockStatement, *ast.ForStatement, *ast.ForInStatement, *ast.ForOfStatement, *ast.SwitchStatement:
+			blockScope = n.(ast.Node)
+		}
+		children()
+	})
+}
+
+// FreeVariables returns the names of the variables the current function refers to without declaring them, that is
+// the ones it (or a function nested in it) closes over, in the order they first appear in its source. Unlike
+// ClosureVariables the names are found in the source, so they're listed even if they can't be resolved at the moment,
+// e.g. because they're in their temporal dead zone or were never declared, and the ones of globals are listed too.
+// It returns nil in global code and if the source of the function isn't available.
+func (dbg *Debugger) FreeVariables() []string {
+	if dbg.callee() == nil {
+		return nil
+	}
+	p, err := dbg.CurrentFunctionAST()
+	if err != nil {
+		return nil
+	}
+	type declaration struct {
+		name       unistring.String
+		start, end file.Idx
+	}
+	var declarations []declaration
+	var references []*ast.Identifier
+	skip := make(map[*ast.Identifier]bool) // identifiers which aren't variables
+	walkScopes(p, nil, func(scope ast.Node, id *ast.Identifier) {
+		declarations = append(declarations, declaration{id.Name, scope.Idx0(), scope.Idx1()})
+	}, func(node interface{}) {
+		switch n := node.(type) {
+		case *ast.Identifier:
+			if !skip[n] {
+				references = append(references, n)
+			}
+		case *ast.PropertyShort: // {x} refers to x
+			references = append(references, &n.Name)
+		case *ast.FunctionLiteral:
+			skip[n.Name] = true // a reference to the function from the outside, if it's the current one
+			declarations = append(declarations, declaration{"arguments", n.Idx0(), n.Idx1()})
+		case *ast.ClassLiteral: // the name of a class is visible inside it
+			if n.Name != nil {
+				skip[n.Name] = true
+				declarations = append(declarations, declaration{n.Name.Name, n.Idx0(), n.Idx1()})
+			}
+		case *ast.LabelledStatement:
+			skip[n.Label] = true
+		case *ast.BranchStatement:
+			skip[n.Label] = true
+		case *ast.MetaProperty:
+			skip[n.Meta], skip[n.Property] = true, true
+		}
+	})
+
+	var names []string
+	seen := make(map[unistring.String]bool)
+references:
+	for _, ref := range references {
+		if seen[ref.Name] {
+			continue
+		}
+		for _, d := range declarations {
+			if d.name == ref.Name && ref.Idx >= d.start && ref.Idx < d.end {
+				continue references
+			}
+		}
+		seen[ref.Name] = true
+		names = append(names, ref.Name.String())
+	}
+	return names
+}
+
+// DefinitionOf returns the position of the declaration of the variable name resolves to at the current position,
+// e.g. to jump to where it's defined in an editor. The declaration is looked up in the source of the current
+// program, so variables which aren't declared in it, like builtins and globals defined elsewhere, result in ok being
+// false, as do names which don't resolve to a variable. Function parameters, catch parameters and the names of
+// function and class declarations are declarations too.
+func (dbg *Debugger) DefinitionOf(name string) (filename string, line int, ok bool) {
+	prg := dbg.vm.prg
+	if prg == nil || prg.src == nil || !dbg.resolvable(unistring.NewFromString(name)) {
+		return "", 0, false
+	}
+	p, err := dbg.parseSource(prg)
+	if err != nil {
+		return "", 0, false
+	}
+	// the parsed positions are 1-based offsets
+	pos := file.Idx(prg.sourceOffset(dbg.vm.pc) + 1)
+
+	var found *ast.Identifier
+	size := 0
+	walkScopes(p, p, func(scope ast.Node, id *ast.Identifier) {
+		start, end := scope.Idx0(), scope.Idx1()
+		if id.Name.String() != name || pos < start || pos >= end || found != nil && int(end-start) >= size {
+			return
+		}
+		found, size = id, int(end-start)
+	}, nil)
+	if found == nil {
+		return "", 0, false
+	}
+	return prg.src.Name(), prg.src.Position(int(found.Idx) - 1).Line, true
+}
+
+// statementOffset is the source offset of the code at pc, like Program.sourceOffset, except at the start of a
+// statement whose first instructions have no position of their own (e.g. the resolution of the variable a declaration
+// initializes), which would get the one of the previous statement. Those get the first position of their statement.
+func statementOffset(prg *Program, pc int) int {
+	offset := prg.sourceOffset(pc)
+	i := sort.SearchInts(prg.stmts, pc+1) - 1 // the statement pc is in
+	if i < 0 {
+		return offset
+	}
+	start, end := prg.stmts[i], len(prg.code)
+	if i+1 < len(prg.stmts) {
+		end = prg.stmts[i+1]
+	}
+	j := sort.Search(len(prg.srcMap), func(k int) bool {
+		return prg.srcMap[k].pc > pc
+	})
+	if j > 0 && prg.srcMap[j-1].pc >= start {
+		return offset
+	}
+	if j < len(prg.srcMap) && prg.srcMap[j].pc < end {
+		return prg.srcMap[j].srcPos
+	}
+	return offset
+}
+
+// parseSource parses the whole source of the file of prg. The result is cached per file.
+func (dbg *Debugger) parseSource(prg *Program) (*ast.Program, error) {
+	if p, exists := dbg.fileASTs[prg.src]; exists {
+		return p, nil
+	}
+	p, err := parser.ParseFile(nil, prg.src.Name(), prg.src.Source(), 0)
+	if err != nil {
+		return nil, err
+	}
+	if dbg.fileASTs == nil {
+		dbg.fileASTs = make(map[*file.File]*ast.Program)
+	}
+	dbg.fileASTs[prg.src] = p
+	return p, nil
+}
+
+// CurrentStatementSpan returns the offsets in the source of the current file where the current statement starts and
+// ends (exclusive), e.g. to highlight it in an editor. The statement is the innermost one enclosing the current
+// position, other than a block. Both are -1 if the source isn't available.
+func (dbg *Debugger) CurrentStatementSpan() (startOffset, endOffset int) {
+	prg := dbg.vm.prg
+	if prg == nil || prg.src == nil {
+		return -1, -1
+	}
+	p, err := dbg.parseSource(prg)
+	if err != nil {
+		return -1, -1
+	}
+	offset := statementOffset(prg, dbg.vm.pc)
+	startOffset, endOffset = -1, -1
+	walkAST(p, func(node interface{}, children func()) {
+		stmt, ok := node.(ast.Statement)
+		if !ok {
+			children()
+			return
+		}
+		// the parsed positions are 1-based offsets
+		start, end := int(stmt.Idx0())-1, int(stmt.Idx1())-1
+		if offset < start || offset >= end {
+			return
+		}
+		if _, isBlock := stmt.(*ast.BlockStatement); !isBlock {
+			startOffset, endOffset = start, end
+		}
+		children()
+	})
+	return
+}
+
 func (dbg *Debugger) GetLocalVariables() (map[string]Value, error) {
+	if dbg.vm.prg == nil {
+		return nil, ErrNoProgram
+	}
 	defer func() {
 		if err := recover(); err != nil {
 			return
@@ -367,6 +5080,9 @@ func (dbg *Debugger) GetLocalVariables() (map[string]Value, error) {
 
 	locals := make(map[string]Value)
 	for name := range dbg.vm.stash.names {
+		if name == thisBindingName || name == "arguments" {
+			continue
+		}
 		val, _ := dbg.getValue(name.String())
 		if val == nil {
 			locals[name.String()] = Undefined()
@@ -1,8 +1,17 @@
 package goja
 
 import (
+	gocontext "context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/dop251/goja/ast"
+	"github.com/dop251/goja/file"
 	"github.com/dop251/goja/parser"
 )
 
@@ -19,7 +28,7 @@ func TestDebuggerBreakpoint(t *testing.T) {
 	debugger := r.AttachDebugger()
 
 	setBreakpointAndLog := func(line int) {
-		if err := debugger.SetBreakpoint("test.js", line); err != nil {
+		if _, err := debugger.SetBreakpoint("test.js", line); err != nil {
 			t.Fatal(err)
 		} else {
 			t.Logf("Set breakpoint on line %d", line)
@@ -114,7 +123,7 @@ func TestDebuggerNext(t *testing.T) {
 			t.Errorf("wrong line and vm.pc, PC: %d, Line: %d", debugger.PC(), debugger.Line())
 		} else {
 			src, _ := debugger.List()
-			t.Logf("Go to line 3: > %s\n", src[debugger.Line()-1])
+			t.Logf("Go to line 3: > %s\n", src[debugger.Line()-1].Text)
 		}
 
 		if err := debugger.Next(); err != nil {
@@ -124,7 +133,7 @@ func TestDebuggerNext(t *testing.T) {
 			t.Errorf("wrong line and vm.pc, PC: %d, Line: %d", debugger.PC(), debugger.Line())
 		} else {
 			src, _ := debugger.List()
-			t.Logf("Go to line 4: > %s\n", src[debugger.Line()-1])
+			t.Logf("Go to line 4: > %s\n", src[debugger.Line()-1].Text)
 		}
 	}()
 	testScript1WithRuntime(SCRIPT, intToValue(3), t, r)
@@ -170,7 +179,7 @@ func TestDebuggerContinue(t *testing.T) {
 			t.Errorf("wrong line and vm.pc, PC: %d, Line: %d", debugger.PC(), debugger.Line())
 		} else {
 			src, _ := debugger.List()
-			t.Logf("Continue to line 6: > %s\n", src[debugger.Line()-1])
+			t.Logf("Continue to line 6: > %s\n", src[debugger.Line()-1].Text)
 		}
 	}()
 	testScript1WithRuntime(SCRIPT, intToValue(4), t, r)
@@ -203,7 +212,7 @@ f1();
 	debugger := r.AttachDebugger()
 
 	breakLine := 16
-	if err := debugger.SetBreakpoint("test.js", breakLine); err != nil {
+	if _, err := debugger.SetBreakpoint("test.js", breakLine); err != nil {
 		t.Fatal(err)
 	} else {
 		t.Logf("Set breakpoint on line %d", breakLine)
@@ -244,6 +253,46 @@ f1();
 
 }
 
+func TestDebuggerLocalVariablesInternalBindings(t *testing.T) {
+	const SCRIPT = `
+	function f(a) {
+		debugger;
+		return this.x + arguments.length + a;
+	}
+	f.call({x: 1}, 1);
+	`
+	r := &Runtime{}
+	r.init()
+	debugger := r.AttachDebugger()
+
+	ch := make(chan struct{})
+	go func() {
+		defer close(ch)
+		defer debugger.Detach()
+		defer func() {
+			if t.Failed() {
+				r.Interrupt("failed test")
+			}
+		}()
+
+		reason := debugger.Continue()
+		if reason != DebuggerStatementActivation {
+			t.Errorf("wrong activation %s", reason)
+		}
+		locals, err := debugger.GetLocalVariables()
+		if err != nil {
+			t.Errorf("error while getting locals: %s", err)
+		}
+		for _, name := range []string{thisBindingName, "arguments"} {
+			if _, ok := locals[name]; ok {
+				t.Errorf("%q shouldn't be a local, locals: %v", name, locals)
+			}
+		}
+	}()
+	testScript1WithRuntime(SCRIPT, intToValue(3), t, r)
+	<-ch // wait for the debugger
+}
+
 func TestDebuggerSkipOuterNestedBreakpoint(t *testing.T) {
 	const SCRIPT = `var a = false;
 function fact(num) {
@@ -267,7 +316,7 @@ test();
 	debugger := r.AttachDebugger()
 
 	for _, line := range []int{6, 9, 11, 14, 15} {
-		if err := debugger.SetBreakpoint("test.js", line); err != nil {
+		if _, err := debugger.SetBreakpoint("test.js", line); err != nil {
 			t.Fatal(err)
 		} else {
 			t.Logf("Set breakpoint on line %d", line)
@@ -333,7 +382,7 @@ func TestDebuggerStepIn(t *testing.T) {
 			t.Errorf("wrong line and vm.pc, PC: %d, Line: %d", debugger.PC(), debugger.Line())
 		} else {
 			src, _ := debugger.List()
-			t.Logf("Step-in to line 6: > %s\n", src[debugger.Line()-1])
+			t.Logf("Step-in to line 6: > %s\n", src[debugger.Line()-1].Text)
 		}
 
 		if err := debugger.StepIn(); err != nil {
@@ -344,7 +393,7 @@ func TestDebuggerStepIn(t *testing.T) {
 			t.Errorf("wrong line and vm.pc, PC: %d, Line: %d", debugger.PC(), debugger.Line())
 		} else {
 			src, _ := debugger.List()
-			t.Logf("Step-in to line 2 (line 1 of function): > %s\n", src[debugger.Line()])
+			t.Logf("Step-in to line 2 (line 1 of function): > %s\n", src[debugger.Line()].Text)
 		}
 	}()
 	testScript1WithRuntime(SCRIPT, intToValue(3), t, r)
@@ -424,10 +473,10 @@ func TestDebuggerList(t *testing.T) {
 		if err := debugger.Next(); err != nil {
 			t.Errorf("error while executing %s", err)
 		}
-		if src, err := debugger.List(); err != nil || src[debugger.Line()-1] != "	x = 1;" {
+		if src, err := debugger.List(); err != nil || src[debugger.Line()-1].Text != "	x = 1;" {
 			t.Errorf("error while executing %s", err)
 		} else {
-			t.Logf("Current line (%d) contains %s", debugger.Line(), src[debugger.Line()-1])
+			t.Logf("Current line (%d) contains %s", debugger.Line(), src[debugger.Line()-1].Text)
 		}
 	}()
 	testScript1WithRuntime(SCRIPT, intToValue(1), t, r)
@@ -501,7 +550,7 @@ testClosure()
 	debugger := r.AttachDebugger()
 
 	for _, line := range []int{2, 3, 4, 5, 6, 8, 11, 20, 21} {
-		if err := debugger.SetBreakpoint("test.js", line); err != nil {
+		if _, err := debugger.SetBreakpoint("test.js", line); err != nil {
 			t.Fatal(err)
 		} else {
 			t.Logf("Set breakpoint on line %d", line)
@@ -533,33 +582,5804 @@ testClosure()
 	<-ch // wait for the debugger
 }
 
-func testScript1WithRuntime(script string, expectedResult Value, t *testing.T, r *Runtime) {
-	prg, err := parser.ParseFile(nil, "test.js", script, 0)
+func TestDebuggerStepToReturn(t *testing.T) {
+	const SCRIPT = `
+	function f(x) {
+		debugger;
+		if (x > 1) {
+			return x * 2;
+		}
+		return -x;
+	}
+	f(3) + f(1);
+	`
+	r := &Runtime{}
+	r.init()
+	debugger := r.AttachDebugger()
+
+	ch := make(chan struct{})
+	go func() {
+		defer close(ch)
+		defer func() {
+			if t.Failed() {
+				r.Interrupt("failed test")
+			}
+		}()
+		defer debugger.Detach()
+		for _, expected := range []struct {
+			line  int
+			value Value
+		}{{5, intToValue(6)}, {7, intToValue(-1)}} {
+			reason := debugger.Continue()
+			if reason != DebuggerStatementActivation {
+				t.Errorf("wrong activation %s", reason)
+			}
+			res := debugger.StepToReturn()
+			if res.Err != nil {
+				t.Errorf("error while executing %s", res.Err)
+			} else if debugger.Line() != expected.line {
+				t.Errorf("expected line: %d, wrong line: %d", expected.line, debugger.Line())
+			} else if !res.Value.SameAs(expected.value) || !debugger.PendingReturnValue().SameAs(expected.value) {
+				t.Errorf("wrong return value %v, expected %v", res.Value, expected.value)
+			}
+		}
+	}()
+	testScript1WithRuntime(SCRIPT, intToValue(5), t, r)
+	<-ch // wait for the debugger
+}
+
+func TestDebuggerRebind(t *testing.T) {
+	r := &Runtime{}
+	r.init()
+	debugger := r.AttachDebugger()
+
+	for _, line := range []int{2, 3, 4} {
+		if _, err := debugger.SetBreakpoint("test.js", line); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := debugger.SetBreakpoint("other.js", 1); err != nil {
+		t.Fatal(err)
+	}
+
+	// line 2 is now empty and line 4 is gone
+	prg, err := Compile("test.js", "x = 1;\n\ny = 2;\n", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale := debugger.Rebind(prg)
+	if len(stale) != 1 || !stale[0].sameLocation(Breakpoint{Filename: "test.js", Line: 4}) {
+		t.Errorf("wrong stale breakpoints: %v", stale)
+	}
+	breakpoints, err := debugger.Breakpoints()
 	if err != nil {
 		t.Fatal(err)
 	}
+	if lines := breakpoints["test.js"]; len(lines) != 1 || lines[0] != 3 {
+		t.Errorf("wrong breakpoints after rebind: %v", lines)
+	}
+	if lines := breakpoints["other.js"]; len(lines) != 1 || lines[0] != 1 {
+		t.Errorf("breakpoints of other files should be untouched: %v", lines)
+	}
 
-	c := newCompiler(true) // TODO have it as a parameter?
-	c.compile(prg, false, false, true)
+	// a class without a constructor has no code for it
+	prg, err = Compile("test.js", "class A {\n\tm() {}\n}\nnew A();\n", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stale := debugger.Rebind(prg); len(stale) != 0 {
+		t.Errorf("wrong stale breakpoints: %v", stale)
+	}
+}
 
-	vm := r.vm
-	vm.prg = c.p
-	vm.prg.dumpCode(t.Logf)
-	vm.result = _undefined
-	vm.debug()
-	v := vm.result
-	t.Logf("stack size: %d", len(vm.stack))
-	t.Logf("stashAllocs: %d", vm.stashAllocs)
+func TestDebuggerListMarkers(t *testing.T) {
+	const SCRIPT = `debugger
+	x = 1;
+	y = 2;
+	`
+	r := &Runtime{}
+	r.init()
+	debugger := r.AttachDebugger()
+	if _, err := debugger.SetBreakpoint("test.js", 3); err != nil {
+		t.Fatal(err)
+	}
 
-	if v == nil && expectedResult != nil || !v.SameAs(expectedResult) {
-		t.Errorf("Result: %+v, expected: %+v", v, expectedResult)
+	ch := make(chan struct{})
+	go func() {
+		defer close(ch)
+		defer func() {
+			if t.Failed() {
+				r.Interrupt("failed test")
+			}
+		}()
+		defer debugger.Detach()
+		reason := debugger.Continue()
+		if reason != DebuggerStatementActivation {
+			t.Errorf("wrong activation %s", reason)
+		}
+		src, err := debugger.List()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if len(src) != 4 {
+			t.Errorf("wrong number of lines: %d", len(src))
+			return
+		}
+		for _, line := range src {
+			if line.IsCurrent != (line.Number == 2) {
+				t.Errorf("wrong current marker on line %d: %+v", line.Number, line)
+			}
+			if line.HasBreakpoint != (line.Number == 3) {
+				t.Errorf("wrong breakpoint marker on line %d: %+v", line.Number, line)
+			}
+		}
+		if src[1].Text != "	x = 1;" {
+			t.Errorf("wrong text: %q", src[1].Text)
+		}
+	}()
+	testScript1WithRuntime(SCRIPT, intToValue(2), t, r)
+	<-ch // wait for the debugger
+}
+
+func TestDebuggerEvalAgainstSnapshot(t *testing.T) {
+	const SCRIPT = `
+	var x = 1;
+	var o = {a: 1};
+	debugger;
+	x = 5;
+	o.a = 2;
+	debugger;
+	x;
+	`
+	r := &Runtime{}
+	r.init()
+	debugger := r.AttachDebugger()
+
+	ch := make(chan struct{})
+	go func() {
+		defer close(ch)
+		defer func() {
+			if t.Failed() {
+				r.Interrupt("failed test")
+			}
+		}()
+		defer debugger.Detach()
+		if reason := debugger.Continue(); reason != DebuggerStatementActivation {
+			t.Errorf("wrong activation %s", reason)
+		}
+		snap := debugger.CaptureScope()
+		if v := snap["x"]; v == nil || !v.SameAs(intToValue(1)) {
+			t.Errorf("wrong captured value of x: %v", v)
+		}
+
+		if reason := debugger.Continue(); reason != DebuggerStatementActivation {
+			t.Errorf("wrong activation %s", reason)
+		}
+		if v, err := debugger.EvalAgainst(snap, "x + 1"); err != nil {
+			t.Errorf("error while executing %s", err)
+		} else if !v.SameAs(intToValue(2)) {
+			t.Errorf("wrong value against snapshot: %v", v)
+		}
+		// objects are held by reference
+		if v, err := debugger.EvalAgainst(snap, "o.a"); err != nil {
+			t.Errorf("error while executing %s", err)
+		} else if !v.SameAs(intToValue(2)) {
+			t.Errorf("wrong value against snapshot: %v", v)
+		}
+		if v, err := debugger.Exec("x"); err != nil {
+			t.Errorf("error while executing %s", err)
+		} else if !v.SameAs(intToValue(5)) {
+			t.Errorf("wrong current value: %v", v)
+		}
+	}()
+	testScript1WithRuntime(SCRIPT, intToValue(5), t, r)
+	<-ch // wait for the debugger
+}
+
+func TestDebuggerDepth(t *testing.T) {
+	const SCRIPT = `debugger;
+	function inner() {
+		debugger;
+		return 1;
+	}
+	function outer() {
+		debugger;
+		return inner();
 	}
+	outer();
+	debugger;
+	`
+	r := &Runtime{}
+	r.init()
+	debugger := r.AttachDebugger()
 
-	if vm.sp != 0 {
-		t.Errorf("sp: %d", vm.sp)
+	ch := make(chan struct{})
+	go func() {
+		defer close(ch)
+		defer func() {
+			if t.Failed() {
+				r.Interrupt("failed test")
+			}
+		}()
+		defer debugger.Detach()
+		for _, depth := range []int{1, 2, 3, 1} {
+			if reason := debugger.Continue(); reason != DebuggerStatementActivation {
+				t.Errorf("wrong activation %s", reason)
+			}
+			if debugger.Depth() != depth {
+				t.Errorf("wrong depth on line %d: %d, expected %d", debugger.Line(), debugger.Depth(), depth)
+			}
+		}
+	}()
+	testScript1WithRuntime(SCRIPT, intToValue(1), t, r)
+	<-ch // wait for the debugger
+}
+
+func TestDebuggerExceptionPropagation(t *testing.T) {
+	const SCRIPT = `debugger;
+	throw new Error("boom");
+	x = 2;
+	`
+	for _, step := range []struct {
+		name string
+		run  func(*Debugger) error
+	}{
+		{"next", func(dbg *Debugger) error {
+			return dbg.Next()
+		}},
+		{"continue", func(dbg *Debugger) error {
+			if reason := dbg.Continue(); reason != ProgramEndActivation {
+				return fmt.Errorf("wrong activation %s", reason)
+			}
+			return dbg.Err()
+		}},
+	} {
+		t.Run(step.name, func(t *testing.T) {
+			r := New()
+			debugger := r.AttachDebugger()
+			defer debugger.Detach()
+
+			ch := make(chan struct{})
+			go func() {
+				defer close(ch)
+				if reason := debugger.Continue(); reason != DebuggerStatementActivation {
+					t.Errorf("wrong activation %s", reason)
+				}
+				err := step.run(debugger)
+				var ex *Exception
+				if !errors.As(err, &ex) {
+					t.Errorf("expected an exception, got %v", err)
+				} else if !strings.Contains(ex.Value().String(), "boom") {
+					t.Errorf("wrong exception %s", ex.Value())
+				}
+				// the program is over
+				if reason := debugger.Continue(); reason != ProgramEndActivation {
+					t.Errorf("wrong activation %s", reason)
+				}
+				if err := debugger.Next(); err == nil {
+					t.Error("expected an error stepping a finished program")
+				}
+			}()
+			if _, err := r.RunScript("test.js", SCRIPT); err == nil {
+				t.Error("expected an error")
+			}
+			<-ch // wait for the debugger
+		})
 	}
+}
 
-	if l := len(vm.iterStack); l > 0 {
-		t.Errorf("iter stack is not empty: %d", l)
+func TestDebuggerCaptureConsole(t *testing.T) {
+	const SCRIPT = `debugger;
+	var a = 1;
+	console.log("hi", a);
+	`
+	r := New()
+	var logged []string
+	console := r.NewObject()
+	console.Set("log", func(call FunctionCall) Value {
+		logged = append(logged, call.Argument(0).String())
+		return _undefined
+	})
+	r.Set("console", console)
+	debugger := r.AttachDebugger()
+	defer debugger.Detach()
+	if err := debugger.CaptureConsole(true); err != nil {
+		t.Fatal(err)
+	}
+
+	ch := make(chan struct{})
+	go func() {
+		defer close(ch)
+		if reason := debugger.Continue(); reason != DebuggerStatementActivation {
+			t.Errorf("wrong activation %s", reason)
+		}
+		if reason := debugger.Continue(); reason != ProgramEndActivation {
+			t.Errorf("wrong activation %s", reason)
+		}
+	}()
+	if _, err := r.RunScript("test.js", SCRIPT); err != nil {
+		t.Fatal(err)
+	}
+	<-ch // wait for the debugger
+
+	select {
+	case ev := <-debugger.Events():
+		expected := Event{Kind: ConsoleEvent, Filename: "test.js", Line: 3, Message: "hi 1"}
+		if ev != expected {
+			t.Errorf("wrong event %+v, expected %+v", ev, expected)
+		}
+	default:
+		t.Error("no console event")
+	}
+	if len(logged) != 1 || logged[0] != "hi" {
+		t.Errorf("the original console wasn't called: %v", logged)
+	}
+
+	if err := debugger.CaptureConsole(false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.RunString(`console.log("bye")`); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case ev := <-debugger.Events():
+		t.Errorf("unexpected event after restoring the console: %+v", ev)
+	default:
+	}
+}
+
+func TestDebuggerExecStrictness(t *testing.T) {
+	const SCRIPT = `
+	function sloppy() {
+		debugger;
 	}
+	function strict() {
+		"use strict";
+		debugger;
+	}
+	sloppy();
+	strict();
+	`
+	r := &Runtime{}
+	r.init()
+	debugger := r.AttachDebugger()
+
+	ch := make(chan struct{})
+	go func() {
+		defer close(ch)
+		defer func() {
+			if t.Failed() {
+				r.Interrupt("failed test")
+			}
+		}()
+		defer debugger.Detach()
+		typeOf := func(name string) string {
+			v, err := debugger.Exec("typeof " + name)
+			if err != nil {
+				t.Errorf("error while executing %s", err)
+				return ""
+			}
+			return v.String()
+		}
+		mustExec := func(exec func(string) (Value, error), expr string) {
+			if _, err := exec(expr); err != nil {
+				t.Errorf("error while executing %s", err)
+			}
+		}
+
+		if reason := debugger.Continue(); reason != DebuggerStatementActivation {
+			t.Errorf("wrong activation %s", reason)
+		}
+		mustExec(debugger.ExecStrict, "var a = 1")
+		mustExec(debugger.ExecSloppy, "var b = 1")
+		mustExec(debugger.Exec, "var c = 1")
+		if typ := typeOf("a"); typ != "undefined" {
+			t.Errorf("var leaked out of strict eval: %s", typ)
+		}
+		if typ := typeOf("b"); typ != "number" {
+			t.Errorf("var didn't leak out of sloppy eval: %s", typ)
+		}
+		if typ := typeOf("c"); typ != "number" {
+			t.Errorf("var didn't leak out of eval in a sloppy function: %s", typ)
+		}
+
+		if reason := debugger.Continue(); reason != DebuggerStatementActivation {
+			t.Errorf("wrong activation %s", reason)
+		}
+		mustExec(debugger.Exec, "var d = 1")
+		if typ := typeOf("d"); typ != "undefined" {
+			t.Errorf("var leaked out of eval in a strict function: %s", typ)
+		}
+	}()
+	testScript1WithRuntime(SCRIPT, _undefined, t, r)
+	<-ch // wait for the debugger
+}
+
+func TestDebuggerFrameCallbacks(t *testing.T) {
+	const SCRIPT = `
+	function add(a, b) {
+		return a + b;
+	}
+	var x = add(1, 2);
+	x;
+	`
+	r := &Runtime{}
+	r.init()
+	debugger := r.AttachDebugger()
+	defer debugger.Detach()
+
+	var entered, exited []string
+	var retval Value
+	debugger.OnFrameEnter(func(frame StackFrame) {
+		entered = append(entered, frame.FuncName())
+	})
+	debugger.OnFrameExit(func(frame StackFrame, v Value) {
+		exited = append(exited, frame.FuncName())
+		retval = v
+	})
+	testScript1WithRuntime(SCRIPT, intToValue(3), t, r)
+
+	if len(entered) != 1 || entered[0] != "add" {
+		t.Errorf("wrong entered frames: %v", entered)
+	}
+	if len(exited) != 1 || exited[0] != "add" {
+		t.Errorf("wrong exited frames: %v", exited)
+	}
+	if retval == nil || !retval.SameAs(intToValue(3)) {
+		t.Errorf("wrong return value: %v", retval)
+	}
+}
+
+func TestDebuggerClosureVariables(t *testing.T) {
+	const SCRIPT = `
+	function makeCounter() {
+		var count = 0;
+		return function () {
+			var step = 1;
+			count += step;
+			debugger;
+			return count;
+		};
+	}
+	var counter = makeCounter();
+	counter();
+	`
+	r := &Runtime{}
+	r.init()
+	debugger := r.AttachDebugger()
+
+	ch := make(chan struct{})
+	go func() {
+		defer close(ch)
+		defer func() {
+			if t.Failed() {
+				r.Interrupt("failed test")
+			}
+		}()
+		defer debugger.Detach()
+		if reason := debugger.Continue(); reason != DebuggerStatementActivation {
+			t.Errorf("wrong activation %s", reason)
+		}
+		closure := debugger.ClosureVariables()
+		if v := closure["count"]; v == nil || !v.SameAs(intToValue(1)) {
+			t.Errorf("wrong closure variables: %v", closure)
+		}
+		if _, exists := closure["step"]; exists {
+			t.Errorf("locals in closure variables: %v", closure)
+		}
+		locals, _ := debugger.GetLocalVariables()
+		if _, exists := locals["count"]; exists {
+			t.Errorf("closure variables in locals: %v", locals)
+		}
+		if _, exists := locals["step"]; !exists {
+			t.Errorf("missing local: %v", locals)
+		}
+	}()
+	testScript1WithRuntime(SCRIPT, intToValue(1), t, r)
+	<-ch // wait for the debugger
+}
+
+func TestDebuggerConditionalBreakpoint(t *testing.T) {
+	const SCRIPT = `
+	var sum = 0;
+	for (var i = 0; i < 5; i++) {
+		sum += i;
+	}
+	sum;
+	`
+	r := &Runtime{}
+	r.init()
+	debugger := r.AttachDebugger()
+	if _, err := debugger.SetConditionalBreakpoint("test.js", 4, "i ==="); err == nil {
+		t.Fatal("expected a syntax error in the condition")
+	}
+	if _, err := debugger.SetConditionalBreakpoint("test.js", 4, "i === 3"); err != nil {
+		t.Fatal(err)
+	}
+
+	ch := make(chan struct{})
+	go func() {
+		defer close(ch)
+		defer func() {
+			if t.Failed() {
+				r.Interrupt("failed test")
+			}
+		}()
+		defer debugger.Detach()
+		if reason := debugger.Continue(); reason != BreakpointActivation {
+			t.Errorf("wrong activation %s", reason)
+			return
+		}
+		if v, err := debugger.Exec("i"); err != nil || !v.SameAs(intToValue(3)) {
+			t.Errorf("wrong value of i: %v %v", v, err)
+		}
+		if err := debugger.ClearBreakpoint("test.js", 4); err != nil {
+			t.Errorf("clearing a conditional breakpoint by location failed: %v", err)
+		}
+		if _, err := debugger.Breakpoints(); err == nil {
+			t.Error("breakpoint wasn't cleared")
+		}
+		if reason := debugger.Continue(); reason != ProgramEndActivation {
+			t.Errorf("wrong activation %s", reason)
+		}
+	}()
+	testScript1WithRuntime(SCRIPT, intToValue(10), t, r)
+	<-ch // wait for the debugger
+}
+
+func TestDebuggerCurrentLineText(t *testing.T) {
+	const SCRIPT = `var x = 1;
+	debugger;
+	x = 2;
+	x;
+	`
+	r := &Runtime{}
+	r.init()
+	debugger := r.AttachDebugger()
+
+	ch := make(chan struct{})
+	go func() {
+		defer close(ch)
+		defer func() {
+			if t.Failed() {
+				r.Interrupt("failed test")
+			}
+		}()
+		defer debugger.Detach()
+		if reason := debugger.Continue(); reason != DebuggerStatementActivation {
+			t.Errorf("wrong activation %s", reason)
+			return
+		}
+		if text := debugger.CurrentLineText(); text != "x = 2;" {
+			t.Errorf("wrong current line text: %q", text)
+		}
+	}()
+	testScript1WithRuntime(SCRIPT, intToValue(2), t, r)
+	<-ch // wait for the debugger
+}
+
+func TestDebuggerActiveBreakpoint(t *testing.T) {
+	const SCRIPT = `var x = 1;
+	x = 2;
+	x = 3;
+	x;
+	`
+	r := &Runtime{}
+	r.init()
+	debugger := r.AttachDebugger()
+	for _, line := range []int{2, 3} {
+		if _, err := debugger.SetBreakpoint("test.js", line); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ch := make(chan struct{})
+	go func() {
+		defer close(ch)
+		defer func() {
+			if t.Failed() {
+				r.Interrupt("failed test")
+			}
+		}()
+		defer debugger.Detach()
+		for _, line := range []int{2, 3} {
+			if reason := debugger.Continue(); reason != BreakpointActivation {
+				t.Errorf("wrong activation %s", reason)
+				return
+			}
+			bp, ok := debugger.ActiveBreakpoint()
+			if !ok || !bp.sameLocation(Breakpoint{Filename: "test.js", Line: line}) {
+				t.Errorf("wrong active breakpoint: %v %v, expected line %d", bp, ok, line)
+			}
+		}
+		if err := debugger.Next(); err != nil {
+			t.Error(err)
+			return
+		}
+		if bp, ok := debugger.ActiveBreakpoint(); ok {
+			t.Errorf("unexpected active breakpoint after a step: %v", bp)
+		}
+	}()
+	testScript1WithRuntime(SCRIPT, intToValue(3), t, r)
+	<-ch // wait for the debugger
+}
+
+func TestDebuggerExecHostFunction(t *testing.T) {
+	const SCRIPT = `
+	var o = {
+		f: function() {
+			"use strict";
+			var x = 1;
+			debugger;
+			return x;
+		}
+	};
+	o.f();
+	`
+	r := &Runtime{}
+	r.init()
+	var called []string
+	r.Set("hostLog", func(msg string) string {
+		called = append(called, msg)
+		return "logged " + msg
+	})
+	r.Set("hostConfig", map[string]interface{}{"name": "test"})
+	debugger := r.AttachDebugger()
+
+	ch := make(chan struct{})
+	go func() {
+		defer close(ch)
+		defer func() {
+			if t.Failed() {
+				r.Interrupt("failed test")
+			}
+		}()
+		defer debugger.Detach()
+		if reason := debugger.Continue(); reason != DebuggerStatementActivation {
+			t.Errorf("wrong activation %s", reason)
+			return
+		}
+		v, err := debugger.Exec("hostLog('x is ' + x + ', name is ' + hostConfig.name)")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if v.String() != "logged x is 1, name is test" {
+			t.Errorf("wrong result: %s", v)
+		}
+		if len(called) != 1 || called[0] != "x is 1, name is test" {
+			t.Errorf("host function wasn't called as expected: %v", called)
+		}
+	}()
+	testScript1WithRuntime(SCRIPT, intToValue(1), t, r)
+	<-ch // wait for the debugger
+}
+
+func TestDebuggerContinueSkippingCurrent(t *testing.T) {
+	const SCRIPT = `
+	var sum = 0;
+	for (var i = 0; i < 4; i++) {
+		sum += i;
+	}
+	sum;
+	`
+	r := &Runtime{}
+	r.init()
+	debugger := r.AttachDebugger()
+	if _, err := debugger.SetBreakpoint("test.js", 4); err != nil {
+		t.Fatal(err)
+	}
+
+	ch := make(chan struct{})
+	go func() {
+		defer close(ch)
+		defer func() {
+			if t.Failed() {
+				r.Interrupt("failed test")
+			}
+		}()
+		defer debugger.Detach()
+		if res := debugger.ContinueSkippingCurrent(); res.Err == nil {
+			t.Error("expected an error when not paused at a breakpoint")
+		}
+		if reason := debugger.Continue(); reason != BreakpointActivation {
+			t.Errorf("wrong activation %s", reason)
+			return
+		}
+		// i === 1 is skipped
+		if res := debugger.ContinueSkippingCurrent(); res.Err != nil {
+			t.Error(res.Err)
+			return
+		}
+		if v, err := debugger.Exec("i"); err != nil || !v.SameAs(intToValue(2)) {
+			t.Errorf("wrong value of i: %v %v", v, err)
+		}
+		if reason := debugger.Continue(); reason != BreakpointActivation {
+			t.Errorf("wrong activation %s", reason)
+			return
+		}
+		if v, err := debugger.Exec("i"); err != nil || !v.SameAs(intToValue(3)) {
+			t.Errorf("wrong value of i: %v %v", v, err)
+		}
+		if bp, _ := debugger.ActiveBreakpoint(); bp.HitCount != 4 {
+			t.Errorf("wrong hit count: %d", bp.HitCount)
+		}
+	}()
+	testScript1WithRuntime(SCRIPT, intToValue(6), t, r)
+	<-ch // wait for the debugger
+}
+
+func TestDebuggerCurrentFunctionAST(t *testing.T) {
+	const SCRIPT = `
+	function add(a, b) {
+		debugger;
+		return a + b;
+	}
+	var o = {
+		m() {
+			debugger;
+			return 1;
+		}
+	};
+	add(1, 2) + o.m();
+	`
+	r := &Runtime{}
+	r.init()
+	debugger := r.AttachDebugger()
+
+	ch := make(chan struct{})
+	go func() {
+		defer close(ch)
+		defer func() {
+			if t.Failed() {
+				r.Interrupt("failed test")
+			}
+		}()
+		defer debugger.Detach()
+		if reason := debugger.Continue(); reason != DebuggerStatementActivation {
+			t.Errorf("wrong activation %s", reason)
+			return
+		}
+		p, err := debugger.CurrentFunctionAST()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if len(p.Body) != 1 {
+			t.Errorf("wrong number of top-level statements: %d", len(p.Body))
+			return
+		}
+		decl, ok := p.Body[0].(*ast.FunctionDeclaration)
+		if !ok || decl.Function.Name.Name != "add" || len(decl.Function.ParameterList.List) != 2 {
+			t.Errorf("wrong top-level node: %#v", p.Body[0])
+		}
+		if p1, _ := debugger.CurrentFunctionAST(); p1 != p {
+			t.Error("AST wasn't cached")
+		}
+
+		if reason := debugger.Continue(); reason != DebuggerStatementActivation {
+			t.Errorf("wrong activation %s", reason)
+			return
+		}
+		p, err = debugger.CurrentFunctionAST()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if len(p.Body) != 1 {
+			t.Errorf("wrong number of top-level statements: %d", len(p.Body))
+		}
+	}()
+	testScript1WithRuntime(SCRIPT, intToValue(4), t, r)
+	<-ch // wait for the debugger
+}
+
+func TestDebuggerPendingBreakpoints(t *testing.T) {
+	const SCRIPT = `var x = 1;
+
+	x = 2;
+	x;
+	`
+	r := New()
+	debugger := r.AttachDebugger()
+	defer debugger.Detach()
+	// set before the program exists: line 2 is empty and line 10 is past the end
+	for _, line := range []int{2, 10} {
+		if _, err := debugger.SetBreakpoint("test.js", line); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ch := make(chan struct{})
+	go func() {
+		defer close(ch)
+		if reason := debugger.Continue(); reason != BreakpointActivation {
+			t.Errorf("wrong activation %s", reason)
+			return
+		}
+		if line := debugger.Line(); line != 3 {
+			t.Errorf("wrong line: %d", line)
+		}
+		unresolved := debugger.UnresolvedBreakpoints()
+		if len(unresolved) != 1 || !unresolved[0].sameLocation(Breakpoint{Filename: "test.js", Line: 10}) {
+			t.Errorf("wrong unresolved breakpoints: %v", unresolved)
+		}
+		if reason := debugger.Continue(); reason != ProgramEndActivation {
+			t.Errorf("wrong activation %s", reason)
+		}
+	}()
+	v, err := r.RunScript("test.js", SCRIPT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !v.SameAs(intToValue(2)) {
+		t.Errorf("wrong result: %v", v)
+	}
+	<-ch // wait for the debugger
+}
+
+func TestDebuggerArguments(t *testing.T) {
+	const SCRIPT = `
+	function f(a, b) {
+		debugger;
+		return a + b + arguments[2];
+	}
+	f(1, 2, 3);
+	`
+	r := &Runtime{}
+	r.init()
+	debugger := r.AttachDebugger()
+
+	ch := make(chan struct{})
+	go func() {
+		defer close(ch)
+		defer func() {
+			if t.Failed() {
+				r.Interrupt("failed test")
+			}
+		}()
+		defer debugger.Detach()
+		if reason := debugger.Continue(); reason != DebuggerStatementActivation {
+			t.Errorf("wrong activation %s", reason)
+			return
+		}
+		args := debugger.Arguments()
+		if len(args) != 3 {
+			t.Errorf("wrong arguments: %v", args)
+			return
+		}
+		for i, arg := range args {
+			if !arg.SameAs(intToValue(int64(i + 1))) {
+				t.Errorf("wrong argument %d: %v", i, arg)
+			}
+		}
+		if err := debugger.SetArgument(3, intToValue(4)); err == nil {
+			t.Error("expected an error setting an argument out of range")
+		}
+		if err := debugger.SetArgument(0, intToValue(10)); err != nil {
+			t.Error(err)
+			return
+		}
+		if v, err := debugger.Exec("a"); err != nil || !v.SameAs(intToValue(10)) {
+			t.Errorf("wrong value of a: %v %v", v, err)
+		}
+	}()
+	testScript1WithRuntime(SCRIPT, intToValue(15), t, r)
+	<-ch // wait for the debugger
+}
+
+func TestDebuggerScopeChain(t *testing.T) {
+	const SCRIPT = `
+	let top = 1;
+	function outer() {
+		var captured = 2;
+		return function inner(a) {
+			var local = 3;
+			{
+				let blockVar = 4;
+				debugger;
+				return a + local + blockVar + captured + top;
+			}
+		};
+	}
+	outer()(5);
+	`
+	r := &Runtime{}
+	r.init()
+	debugger := r.AttachDebugger()
+
+	ch := make(chan struct{})
+	go func() {
+		defer close(ch)
+		defer func() {
+			if t.Failed() {
+				r.Interrupt("failed test")
+			}
+		}()
+		defer debugger.Detach()
+		if reason := debugger.Continue(); reason != DebuggerStatementActivation {
+			t.Errorf("wrong activation %s", reason)
+			return
+		}
+		expected := []struct {
+			kind ScopeKind
+			name string
+		}{
+			{BlockScope, "blockVar"},
+			{LocalScope, "local"},
+			{ClosureScope, "captured"},
+			{ScriptScope, "top"},
+			{GlobalScope, "outer"},
+		}
+		groups := debugger.ScopeChain()
+		if len(groups) != len(expected) {
+			t.Errorf("wrong scope chain: %v", groups)
+			return
+		}
+		for i, e := range expected {
+			if groups[i].Kind != e.kind {
+				t.Errorf("wrong kind of scope %d: %s, expected %s", i, groups[i].Kind, e.kind)
+			}
+			if _, exists := groups[i].Variables[e.name]; !exists {
+				t.Errorf("%s is missing from the %s scope: %v", e.name, groups[i].Kind, groups[i].Variables)
+			}
+		}
+		if _, exists := groups[1].Variables["blockVar"]; exists {
+			t.Error("block variable in the local scope")
+		}
+		if groups[1].Label != "inner" {
+			t.Errorf("wrong label of the local scope: %s", groups[1].Label)
+		}
+	}()
+	testScript1WithRuntime(SCRIPT, intToValue(15), t, r)
+	<-ch // wait for the debugger
+}
+
+func TestDebuggerPropertyBreakpoint(t *testing.T) {
+	const SCRIPT = `
+	var o = {x: 1};
+	debugger;
+	o.x = 2;
+	var y = o.x;
+	y;
+	`
+	r := &Runtime{}
+	r.init()
+	debugger := r.AttachDebugger()
+
+	ch := make(chan struct{})
+	go func() {
+		defer close(ch)
+		defer func() {
+			if t.Failed() {
+				r.Interrupt("failed test")
+			}
+		}()
+		defer debugger.Detach()
+		if reason := debugger.Continue(); reason != DebuggerStatementActivation {
+			t.Errorf("wrong activation %s", reason)
+			return
+		}
+		if err := debugger.SetPropertyBreakpoint("o", "x", true, true); err != nil {
+			t.Error(err)
+			return
+		}
+		for _, line := range []int{4, 5} {
+			if reason := debugger.Continue(); reason != PropertyAccessActivation {
+				t.Errorf("wrong activation %s", reason)
+				return
+			}
+			if l := debugger.Line(); l != line {
+				t.Errorf("wrong line: %d, expected %d", l, line)
+			}
+			// evaluating doesn't pause again
+			if v, err := debugger.Exec("o.x"); err != nil || !v.SameAs(intToValue(2)) {
+				t.Errorf("wrong value of o.x: %v %v", v, err)
+			}
+		}
+	}()
+	testScript1WithRuntime(SCRIPT, intToValue(2), t, r)
+	<-ch // wait for the debugger
+}
+
+func TestDebuggerNoProgram(t *testing.T) {
+	r := New()
+	debugger := r.AttachDebugger()
+	defer debugger.Detach()
+
+	for name, cmd := range map[string]func() error{
+		"Next":   debugger.Next,
+		"StepIn": debugger.StepIn,
+		"StepToReturn": func() error {
+			return debugger.StepToReturn().Err
+		},
+		"Exec": func() error {
+			_, err := debugger.Exec("1")
+			return err
+		},
+		"ExecStrict": func() error {
+			_, err := debugger.ExecStrict("1")
+			return err
+		},
+		"EvalAgainst": func() error {
+			_, err := debugger.EvalAgainst(nil, "1")
+			return err
+		},
+		"Print": func() error {
+			_, err := debugger.Print("x")
+			return err
+		},
+		"List": func() error {
+			_, err := debugger.List()
+			return err
+		},
+		"GetLocalVariables": func() error {
+			_, err := debugger.GetLocalVariables()
+			return err
+		},
+		"CurrentFunctionAST": func() error {
+			_, err := debugger.CurrentFunctionAST()
+			return err
+		},
+		"SetPropertyBreakpoint": func() error {
+			return debugger.SetPropertyBreakpoint("o", "x", true, true)
+		},
+	} {
+		if err := cmd(); !errors.Is(err, ErrNoProgram) {
+			t.Errorf("%s: expected ErrNoProgram, got %v", name, err)
+		}
+	}
+	if line, filename, text := debugger.Line(), debugger.Filename(), debugger.CurrentLineText(); line != 0 || filename != "" || text != "" {
+		t.Errorf("unexpected position without a program: %d %q %q", line, filename, text)
+	}
+	if v := debugger.PendingReturnValue(); v != nil {
+		t.Errorf("unexpected pending return value: %v", v)
+	}
+}
+
+func TestDebuggerCallStackHideInternal(t *testing.T) {
+	const SCRIPT = `
+	function double(x) {
+		debugger;
+		return x * 2;
+	}
+	[1].map(double)[0];
+	`
+	r := &Runtime{}
+	r.init()
+	debugger := r.AttachDebugger()
+
+	ch := make(chan struct{})
+	go func() {
+		defer close(ch)
+		defer func() {
+			if t.Failed() {
+				r.Interrupt("failed test")
+			}
+		}()
+		defer debugger.Detach()
+		if reason := debugger.Continue(); reason != DebuggerStatementActivation {
+			t.Errorf("wrong activation %s", reason)
+			return
+		}
+		names := func(frames []StackFrame) (names []string) {
+			for _, frame := range frames {
+				names = append(names, frame.FuncName())
+			}
+			return
+		}
+		if all := names(debugger.CallStack(CallStackOptions{})); len(all) != 3 || all[1] != "map" {
+			t.Errorf("wrong call stack: %v", all)
+		}
+		if js := names(debugger.CallStack(CallStackOptions{HideInternal: true})); len(js) != 2 || js[0] != "double" {
+			t.Errorf("wrong filtered call stack: %v", js)
+		}
+	}()
+	testScript1WithRuntime(SCRIPT, intToValue(2), t, r)
+	<-ch // wait for the debugger
+}
+
+func TestDebuggerVariables(t *testing.T) {
+	const SCRIPT = `
+	var x = "global";
+	var g = 1;
+	function f(a) {
+		var x = "local";
+		debugger;
+		return x;
+	}
+	f.call({name: "self"}, 2);
+	`
+	r := &Runtime{}
+	r.init()
+	debugger := r.AttachDebugger()
+
+	ch := make(chan struct{})
+	go func() {
+		defer close(ch)
+		defer func() {
+			if t.Failed() {
+				r.Interrupt("failed test")
+			}
+		}()
+		defer debugger.Detach()
+		if reason := debugger.Continue(); reason != DebuggerStatementActivation {
+			t.Errorf("wrong activation %s", reason)
+			return
+		}
+		vars := debugger.Variables()
+		if v := vars["x"]; v == nil || v.String() != "local" {
+			t.Errorf("wrong value of x: %v", v)
+		}
+		if v := vars["g"]; v == nil || !v.SameAs(intToValue(1)) {
+			t.Errorf("wrong value of g: %v", v)
+		}
+		if v := vars["a"]; v == nil || !v.SameAs(intToValue(2)) {
+			t.Errorf("wrong value of a: %v", v)
+		}
+		if v, ok := vars["this"].(*Object); !ok || v.Get("name").String() != "self" {
+			t.Errorf("wrong value of this: %v", vars["this"])
+		}
+		if _, exists := vars["arguments"]; !exists {
+			t.Error("arguments is missing")
+		}
+	}()
+	testScript1WithRuntime(SCRIPT, asciiString("local"), t, r)
+	<-ch // wait for the debugger
+}
+
+func TestDebuggerBreakpointIDs(t *testing.T) {
+	r := &Runtime{}
+	r.init()
+	debugger := r.AttachDebugger()
+
+	id1, _ := debugger.SetBreakpoint("test.js", 2)
+	id2, _ := debugger.SetConditionalBreakpoint("test.js", 5, "true")
+	id3, _ := debugger.SetBreakpoint("other.js", 2)
+	if id1 == id2 || id2 == id3 || id1 == id3 {
+		t.Fatalf("IDs are not unique: %d %d %d", id1, id2, id3)
+	}
+	if id, _ := debugger.SetConditionalBreakpoint("test.js", 2, "x > 1"); id != id1 {
+		t.Errorf("setting a breakpoint at an existing location changed its ID: %d, expected %d", id, id1)
+	}
+
+	// line 2 is empty now, so the breakpoint moves to line 3
+	prg, err := Compile("test.js", "x = 1;\n\ny = 2;\nz = 3;\nw = 4;\n", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	debugger.Rebind(prg)
+	if _, idx, found := debugger.findBreakpointByID(id1); !found || debugger.breakpoints["test.js"][idx].Line != 3 {
+		t.Error("breakpoint lost its ID when it was moved")
+	}
+
+	if err := debugger.SetBreakpointEnabledByID(id2, false); err != nil {
+		t.Error(err)
+	}
+	if err := debugger.ClearBreakpointByID(id1); err != nil {
+		t.Error(err)
+	}
+	if err := debugger.ClearBreakpointByID(id1); err == nil {
+		t.Error("expected an error clearing a breakpoint twice")
+	}
+	breakpoints, _ := debugger.Breakpoints()
+	if lines := breakpoints["test.js"]; len(lines) != 1 || lines[0] != 5 {
+		t.Errorf("wrong breakpoints after clearing by ID: %v", lines)
+	}
+	if bps := debugger.breakpoints["test.js"]; len(bps) != 1 || bps[0].Enabled {
+		t.Errorf("breakpoint wasn't disabled by ID: %v", bps)
+	}
+	if id, _ := debugger.SetBreakpoint("test.js", 3); id == id1 {
+		t.Error("ID of a cleared breakpoint reused")
+	}
+}
+
+func TestDebuggerNextIsCall(t *testing.T) {
+	const SCRIPT = `
+	function f() {
+		return 1;
+	}
+	var x;
+	debugger;
+	x = 2;
+	x = f();
+	x;
+	`
+	r := &Runtime{}
+	r.init()
+	debugger := r.AttachDebugger()
+
+	ch := make(chan struct{})
+	go func() {
+		defer close(ch)
+		defer func() {
+			if t.Failed() {
+				r.Interrupt("failed test")
+			}
+		}()
+		defer debugger.Detach()
+		if reason := debugger.Continue(); reason != DebuggerStatementActivation {
+			t.Errorf("wrong activation %s", reason)
+			return
+		}
+		if debugger.NextIsCall() {
+			t.Errorf("plain assignment on line %d reported as a call", debugger.Line())
+		}
+		if err := debugger.Next(); err != nil {
+			t.Error(err)
+			return
+		}
+		if !debugger.NextIsCall() {
+			t.Errorf("call on line %d not reported", debugger.Line())
+		}
+	}()
+	testScript1WithRuntime(SCRIPT, intToValue(1), t, r)
+	<-ch // wait for the debugger
+}
+
+func TestDebuggerExecWithTimeout(t *testing.T) {
+	const SCRIPT = `
+	var x = 1;
+	var o = {
+		get bad() {
+			while (true) {}
+		}
+	};
+	debugger;
+	x + 1;
+	`
+	r := &Runtime{}
+	r.init()
+	debugger := r.AttachDebugger()
+
+	ch := make(chan struct{})
+	go func() {
+		defer close(ch)
+		defer func() {
+			if t.Failed() {
+				r.Interrupt("failed test")
+			}
+		}()
+		defer debugger.Detach()
+		if reason := debugger.Continue(); reason != DebuggerStatementActivation {
+			t.Errorf("wrong activation %s", reason)
+			return
+		}
+		for _, expr := range []string{"while (true) {}", "o.bad"} {
+			if res := debugger.ExecWithTimeout(expr, 50*time.Millisecond); res.Err != ErrExecTimeout {
+				t.Errorf("%s: expected a timeout, got %v %v", expr, res.Value, res.Err)
+			}
+		}
+		if res := debugger.ExecWithTimeout("x", time.Second); res.Err != nil || !res.Value.SameAs(intToValue(1)) {
+			t.Errorf("wrong result after a timeout: %v %v", res.Value, res.Err)
+		}
+	}()
+	testScript1WithRuntime(SCRIPT, intToValue(2), t, r)
+	<-ch // wait for the debugger
+}
+
+func TestDebuggerFunctionBreakpointAfter(t *testing.T) {
+	const SCRIPT = `
+	function f(i) {
+		return i;
+	}
+	var sum = 0;
+	for (var i = 0; i < 20; i++) {
+		sum += f(i);
+	}
+	sum;
+	`
+	r := &Runtime{}
+	r.init()
+	debugger := r.AttachDebugger()
+	debugger.SetFunctionBreakpointAfter("f", 9)
+
+	ch := make(chan struct{})
+	go func() {
+		defer close(ch)
+		defer func() {
+			if t.Failed() {
+				r.Interrupt("failed test")
+			}
+		}()
+		defer debugger.Detach()
+		if reason := debugger.Continue(); reason != FunctionBreakpointActivation {
+			t.Errorf("wrong activation %s", reason)
+			return
+		}
+		if n := debugger.CallCount("f"); n != 10 {
+			t.Errorf("wrong call count: %d", n)
+		}
+		if args := debugger.Arguments(); len(args) != 1 || !args[0].SameAs(intToValue(9)) {
+			t.Errorf("wrong arguments: %v", args)
+		}
+		if err := debugger.ClearFunctionBreakpoint("f"); err != nil {
+			t.Error(err)
+		}
+		if reason := debugger.Continue(); reason != ProgramEndActivation {
+			t.Errorf("wrong activation %s", reason)
+		}
+		if n := debugger.CallCount("f"); n != 20 {
+			t.Errorf("wrong call count at the end: %d", n)
+		}
+	}()
+	testScript1WithRuntime(SCRIPT, intToValue(190), t, r)
+	<-ch // wait for the debugger
+}
+
+func TestDebuggerContextCancel(t *testing.T) {
+	const SCRIPT = `
+	var x = 1;
+	debugger;
+	x = 2;
+	`
+	r := New()
+	ctx, cancel := gocontext.WithCancel(gocontext.Background())
+	defer cancel()
+	debugger := r.AttachDebuggerWithContext(ctx)
+
+	ch := make(chan struct{})
+	go func() {
+		defer close(ch)
+		if reason := debugger.Continue(); reason != DebuggerStatementActivation {
+			t.Errorf("wrong activation %s", reason)
+		}
+		// the client goes away while paused
+		cancel()
+	}()
+	_, err := r.RunScript("test.js", SCRIPT)
+	<-ch
+	var interrupted *InterruptedError
+	if !errors.As(err, &interrupted) || interrupted.Value() != gocontext.Canceled {
+		t.Fatalf("expected the program to be interrupted, got %v", err)
+	}
+	if r.vm.debugger != nil || r.vm.debugMode {
+		t.Error("debugger wasn't detached")
+	}
+	if reason := debugger.Continue(); reason != ProgramEndActivation {
+		t.Errorf("wrong activation %s", reason)
+	}
+}
+
+func TestDebuggerValueFormatter(t *testing.T) {
+	const SCRIPT = `
+	var s = "a long string";
+	debugger;
+	s;
+	`
+	r := &Runtime{}
+	r.init()
+	debugger := r.AttachDebugger()
+	debugger.SetValueFormatter(func(v Value) string {
+		if str := v.String(); len(str) > 6 {
+			return str[:6] + "..."
+		}
+		return v.String()
+	})
+
+	ch := make(chan struct{})
+	go func() {
+		defer close(ch)
+		defer func() {
+			if t.Failed() {
+				r.Interrupt("failed test")
+			}
+		}()
+		defer debugger.Detach()
+		if reason := debugger.Continue(); reason != DebuggerStatementActivation {
+			t.Errorf("wrong activation %s", reason)
+			return
+		}
+		if out, err := debugger.Print("s"); err != nil || out != "a long..." {
+			t.Errorf("formatter wasn't used: %q %v", out, err)
+		}
+		debugger.SetValueFormatter(nil)
+		if out, err := debugger.Print("s"); err != nil || out != "a long string" {
+			t.Errorf("wrong default rendering: %q %v", out, err)
+		}
+	}()
+	testScript1WithRuntime(SCRIPT, asciiString("a long string"), t, r)
+	<-ch // wait for the debugger
+}
+
+func TestDebuggerBreakOnExit(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		script string
+		throws bool
+	}{
+		{"normal", "var x = 1;\nx = 5;\nx;\n", false},
+		{"exception", "var x = 1;\nx = 5;\nthrow new Error('boom');\n", true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := New()
+			debugger := r.AttachDebugger()
+			defer debugger.Detach()
+			debugger.SetBreakOnExit(true)
+
+			ch := make(chan struct{})
+			go func() {
+				defer close(ch)
+				if reason := debugger.Continue(); reason != ExitActivation {
+					t.Errorf("wrong activation %s", reason)
+					return
+				}
+				if v, err := debugger.Exec("x"); err != nil || !v.SameAs(intToValue(5)) {
+					t.Errorf("wrong final value of x: %v %v", v, err)
+				}
+				if err := debugger.Err(); (err != nil) != tc.throws {
+					t.Errorf("wrong error at exit: %v", err)
+				}
+				if reason := debugger.Continue(); reason != ProgramEndActivation {
+					t.Errorf("wrong activation %s", reason)
+				}
+			}()
+			v, err := r.RunScript("test.js", tc.script)
+			<-ch
+			if tc.throws {
+				if err == nil {
+					t.Error("expected an exception")
+				}
+			} else if err != nil || !v.SameAs(intToValue(5)) {
+				t.Errorf("wrong result: %v %v", v, err)
+			}
+		})
+	}
+}
+
+func TestLineTracker(t *testing.T) {
+	prg := &Program{code: []instruction{loadUndef, loadUndef, jump(-2), halt}}
+	other := &Program{code: []instruction{loadUndef, halt}}
+
+	var tr lineTracker
+	tr.start(prg, 0, 1, 0)
+	if tr.done(prg, 1, 1, 0) {
+		t.Error("stopped on the same line")
+	}
+	if tr.done(other, 0, 5, 1) {
+		t.Error("stopped inside a called function")
+	}
+	if !tr.done(prg, 2, 2, 0) {
+		t.Error("didn't stop on the following line")
+	}
+
+	// the loop-backward case: the next line is before the current one
+	tr.start(prg, 2, 3, 0)
+	if !tr.done(prg, 0, 2, 0) {
+		t.Error("didn't stop going back to a previous line")
+	}
+
+	// a loop on a single line
+	tr.start(prg, 0, 1, 0)
+	if tr.done(prg, 1, 1, 0) || tr.done(prg, 2, 1, 0) {
+		t.Error("stopped going forward on the same line")
+	}
+	if !tr.done(prg, 0, 1, 0) {
+		t.Error("didn't stop on the next iteration")
+	}
+
+	tr.start(other, 0, 5, 1)
+	if !tr.done(prg, 2, 1, 0) {
+		t.Error("didn't stop returning to the caller")
+	}
+
+	tr.start(prg, 0, 1, 0)
+	if !tr.done(prg, 3, 1, 0) {
+		t.Error("didn't stop before the end of the program")
+	}
+}
+
+func TestDebuggerNextInLoop(t *testing.T) {
+	const SCRIPT = `debugger;
+	var x = 0;
+	for (var i = 0; i < 2; i++) {
+		x += i;
+	}
+	x;
+	`
+	r := &Runtime{}
+	r.init()
+	debugger := r.AttachDebugger()
+
+	ch := make(chan struct{})
+	go func() {
+		defer close(ch)
+		defer func() {
+			if t.Failed() {
+				r.Interrupt("failed test")
+			}
+		}()
+		defer debugger.Detach()
+		if reason := debugger.Continue(); reason != DebuggerStatementActivation {
+			t.Errorf("wrong activation %s", reason)
+			return
+		}
+		var lines []int
+		for debugger.Line() != 6 {
+			if err := debugger.Next(); err != nil {
+				t.Errorf("error while executing %s", err)
+				return
+			}
+			if len(lines) > 20 {
+				t.Error("too many steps")
+				return
+			}
+			lines = append(lines, debugger.Line())
+		}
+		// Next used to look for the first line after the current one, so it left the loop after its first iteration.
+		iterations := 0
+		for _, l := range lines {
+			if l == 4 {
+				iterations++
+			}
+		}
+		if iterations != 2 {
+			t.Errorf("expected to go through the loop body twice, lines: %v", lines)
+		}
+		if err := debugger.Next(); err != nil {
+			t.Errorf("error while executing %s", err)
+		}
+		if err := debugger.Next(); err == nil || err.Error() != "halted" {
+			t.Errorf("expected the program to halt, got %v", err)
+		}
+	}()
+	testScript1WithRuntime(SCRIPT, intToValue(1), t, r)
+	<-ch // wait for the debugger
+}
+
+func TestDebuggerRunScript(t *testing.T) {
+	const SCRIPT = `debugger;
+	var x = 1;
+	x = x + 1;
+	x = x * 3;
+	x;
+	`
+	r := &Runtime{}
+	r.init()
+	debugger := r.AttachDebugger()
+
+	ch := make(chan struct{})
+	go func() {
+		defer close(ch)
+		defer func() {
+			if t.Failed() {
+				r.Interrupt("failed test")
+			}
+		}()
+		defer debugger.Detach()
+		if reason := debugger.Continue(); reason != DebuggerStatementActivation {
+			t.Errorf("wrong activation %s", reason)
+			return
+		}
+		results := debugger.RunScript([]string{
+			"break test.js:4",
+			"continue",
+			"print x",
+			"next",
+			"p x",
+			"exec x - 1",
+			"frobnicate",
+			"break test.js",
+		})
+		expected := []Value{intToValue(1), newStringValue(string(BreakpointActivation)), newStringValue("2"),
+			intToValue(5), newStringValue("6"), intToValue(5)}
+		for i, res := range results[:len(expected)] {
+			if res.Err != nil {
+				t.Errorf("command %d: error while executing %s", i, res.Err)
+			} else if !res.Value.SameAs(expected[i]) {
+				t.Errorf("command %d: expected %s, got %s", i, expected[i], res.Value)
+			}
+		}
+		for _, res := range results[len(expected):] {
+			if res.Err == nil {
+				t.Errorf("expected an error, got %s", res.Value)
+			}
+		}
+	}()
+	testScript1WithRuntime(SCRIPT, intToValue(6), t, r)
+	<-ch // wait for the debugger
+}
+
+func TestDebuggerFilenameStable(t *testing.T) {
+	const SCRIPT = `debugger;
+	function f(a) {
+		var b = a + 1;
+		return b;
+	}
+	var x = f(1);
+	x = f(x);
+	x;
+	`
+	r := &Runtime{}
+	r.init()
+	debugger := r.AttachDebugger()
+
+	ch := make(chan struct{})
+	go func() {
+		defer close(ch)
+		defer func() {
+			if t.Failed() {
+				r.Interrupt("failed test")
+			}
+		}()
+		defer debugger.Detach()
+		if reason := debugger.Continue(); reason != DebuggerStatementActivation {
+			t.Errorf("wrong activation %s", reason)
+			return
+		}
+		for i := 0; i < 100; i++ {
+			if name := debugger.Filename(); name != "test.js" {
+				t.Errorf("wrong filename %q at pc %d", name, debugger.PC())
+			}
+			if debugger.Line() < 2 {
+				t.Errorf("wrong line %d at pc %d", debugger.Line(), debugger.PC())
+			}
+			if err := debugger.StepIn(); err != nil {
+				return
+			}
+		}
+		t.Error("the program didn't finish")
+	}()
+	testScript1WithRuntime(SCRIPT, intToValue(3), t, r)
+	<-ch // wait for the debugger
+}
+
+func TestDebugPositionBeforeFirstSourcePosition(t *testing.T) {
+	prg := &Program{
+		src:    file.NewFile("test.js", "a;\nb;\n", 0),
+		code:   []instruction{loadUndef, pop, loadUndef, halt},
+		srcMap: []srcMapItem{{pc: 2, srcPos: 3}},
+	}
+	for pc := range prg.code {
+		if pos := debugPosition(prg, pc); pos.Filename != "test.js" || pos.Line != 2 {
+			t.Errorf("wrong position at pc %d: %s:%d", pc, pos.Filename, pos.Line)
+		}
+	}
+}
+
+func TestDebuggerValueStack(t *testing.T) {
+	const SCRIPT = `var a = 2;
+	debugger;
+	var y = a * (a + 3);
+	y;
+	`
+	r := &Runtime{}
+	r.init()
+	debugger := r.AttachDebugger()
+
+	ch := make(chan struct{})
+	go func() {
+		defer close(ch)
+		defer func() {
+			if t.Failed() {
+				r.Interrupt("failed test")
+			}
+		}()
+		defer debugger.Detach()
+		if reason := debugger.Continue(); reason != DebuggerStatementActivation {
+			t.Errorf("wrong activation %s", reason)
+			return
+		}
+		if sb := debugger.StackBase(); sb != -1 {
+			t.Errorf("wrong stack base in global code: %d", sb)
+		}
+		found := false
+		for debugger.Line() <= 3 {
+			stack := debugger.ValueStack()
+			t.Logf("stack: %v", stack)
+			// a and a + 3 are on the stack right before they're multiplied
+			if n := len(stack); n >= 2 && stack[n-2].SameAs(intToValue(2)) && stack[n-1].SameAs(intToValue(5)) {
+				found = true
+				stack[n-1] = intToValue(100)
+			}
+			if err := debugger.StepIn(); err != nil {
+				t.Errorf("error while executing %s", err)
+				return
+			}
+		}
+		if !found {
+			t.Error("the partial results of the expression weren't on the stack")
+		}
+	}()
+	// changing the returned slice must not affect the program
+	testScript1WithRuntime(SCRIPT, intToValue(10), t, r)
+	<-ch // wait for the debugger
+}
+
+func TestDebuggerStepLimit(t *testing.T) {
+	const SCRIPT = `debugger;
+	function spin() {
+		var i = 0;
+		while (i < 100000) i++;
+		return i;
+	}
+	var x = spin();
+	x;
+	`
+	r := &Runtime{}
+	r.init()
+	debugger := r.AttachDebugger()
+
+	ch := make(chan struct{})
+	go func() {
+		defer close(ch)
+		defer func() {
+			if t.Failed() {
+				r.Interrupt("failed test")
+			}
+		}()
+		defer debugger.Detach()
+		if reason := debugger.Continue(); reason != DebuggerStatementActivation {
+			t.Errorf("wrong activation %s", reason)
+			return
+		}
+		debugger.SetStepLimit(1000)
+		for debugger.Line() != 7 {
+			if err := debugger.Next(); err != nil {
+				t.Errorf("error while executing %s", err)
+				return
+			}
+		}
+		if err := debugger.Next(); err != ErrStepLimit {
+			t.Errorf("expected the step limit to be exceeded, got %v", err)
+		}
+		if debugger.Depth() != 2 {
+			t.Errorf("expected to be paused inside spin, depth: %d", debugger.Depth())
+		}
+		debugger.SetStepLimit(0)
+		if err := debugger.StepToReturn().Err; err != nil {
+			t.Errorf("error while executing %s", err)
+		}
+	}()
+	testScript1WithRuntime(SCRIPT, intToValue(100000), t, r)
+	<-ch // wait for the debugger
+}
+
+func TestDebuggerPrintCollections(t *testing.T) {
+	const SCRIPT = `var m = new Map([["a", 1], ["b", 2]]);
+	var s = new Set([1, 2, 3]);
+	var a = new Int32Array([4, -5, 6]);
+	var nested = new Map([["s", s]]);
+	m.set("self", m);
+	debugger;
+	0;
+	`
+	r := &Runtime{}
+	r.init()
+	debugger := r.AttachDebugger()
+
+	ch := make(chan struct{})
+	go func() {
+		defer close(ch)
+		defer func() {
+			if t.Failed() {
+				r.Interrupt("failed test")
+			}
+		}()
+		defer debugger.Detach()
+		if reason := debugger.Continue(); reason != DebuggerStatementActivation {
+			t.Errorf("wrong activation %s", reason)
+			return
+		}
+		for name, expected := range map[string]string{
+			"s":      "Set(3){1,2,3}",
+			"a":      "Int32Array(3)[4,-5,6]",
+			"nested": "Map(1){s => Set(3){1,2,3}}",
+			"m":      "Map(3){a => 1, b => 2, self => Map(3){a => 1, b => 2, self => Map(3){a => 1, b => 2, self => [object Map]}}}",
+		} {
+			if str, err := debugger.Print(name); err != nil {
+				t.Errorf("error while executing %s", err)
+			} else if str != expected {
+				t.Errorf("expected %s to be printed as %s, got %s", name, expected, str)
+			}
+		}
+	}()
+	testScript1WithRuntime(SCRIPT, intToValue(0), t, r)
+	<-ch // wait for the debugger
+}
+
+func TestDebuggerNextStatementSameLine(t *testing.T) {
+	const SCRIPT = `debugger;
+	var calls = []; function a() { calls.push("a"); } function b() { calls.push("b"); } function c() { calls.push("c"); }
+	a(); b(); c();
+	calls.length;
+	`
+	r := &Runtime{}
+	r.init()
+	debugger := r.AttachDebugger()
+
+	ch := make(chan struct{})
+	go func() {
+		defer close(ch)
+		defer func() {
+			if t.Failed() {
+				r.Interrupt("failed test")
+			}
+		}()
+		defer debugger.Detach()
+		if reason := debugger.Continue(); reason != DebuggerStatementActivation {
+			t.Errorf("wrong activation %s", reason)
+			return
+		}
+		for debugger.Line() != 3 {
+			if err := debugger.Next(); err != nil {
+				t.Errorf("error while executing %s", err)
+				return
+			}
+		}
+		for i := 1; i <= 3; i++ {
+			if err := debugger.NextStatementSameLine(); err != nil {
+				t.Errorf("error while executing %s", err)
+				return
+			}
+			calls, _ := debugger.Exec("calls.join()")
+			t.Logf("step %d: line %d, calls: %s", i, debugger.Line(), calls)
+			expectedLine := 3
+			if i == 3 {
+				expectedLine = 4
+			}
+			if debugger.Line() != expectedLine {
+				t.Errorf("step %d: wrong line %d", i, debugger.Line())
+			}
+			if expected := strings.Join([]string{"a", "b", "c"}[:i], ","); calls.String() != expected {
+				t.Errorf("step %d: expected calls %s, got %s", i, expected, calls)
+			}
+		}
+	}()
+	testScript1WithRuntime(SCRIPT, intToValue(3), t, r)
+	<-ch // wait for the debugger
+}
+
+func TestDebuggerAsyncCallStack(t *testing.T) {
+	const SCRIPT = `
+	function outer() {
+		return Promise.resolve(1).then(function callback(v) {
+			probe();
+		});
+	}
+	outer();
+	`
+	r := &Runtime{}
+	r.init()
+	debugger := r.AttachDebugger()
+	debugger.SetAsyncStackTraces(true)
+
+	var stack [][]StackFrame
+	r.Set("probe", func() {
+		stack = debugger.AsyncCallStack()
+	})
+	if _, err := r.RunScript("test.js", SCRIPT); err != nil {
+		t.Fatal(err)
+	}
+	funcNames := func(frames []StackFrame) []string {
+		var names []string
+		for _, frame := range frames {
+			if frame.prg != nil {
+				names = append(names, frame.FuncName())
+			}
+		}
+		return names
+	}
+	if len(stack) != 2 {
+		t.Fatalf("expected the stack of the job and the one which scheduled it, got %d segments", len(stack))
+	}
+	if names := funcNames(stack[0]); len(names) != 1 || names[0] != "callback" {
+		t.Errorf("wrong current stack: %v", names)
+	}
+	if names := funcNames(stack[1]); len(names) != 2 || names[0] != "outer" {
+		t.Errorf("wrong async stack: %v", names)
+	}
+	if len(debugger.AsyncCallStack()) != 1 {
+		t.Error("the async stack was kept after the job")
+	}
+}
+
+func TestDebuggerExecJSON(t *testing.T) {
+	const SCRIPT = `
+	var o = {a: 1, list: [1, "two", {three: 3}], f: function add(x) { return x; }};
+	o.self = o;
+	o.list.push(o.list);
+	o.shared = {n: null};
+	o.again = o.shared;
+	debugger;
+	0;
+	`
+	r := &Runtime{}
+	r.init()
+	debugger := r.AttachDebugger()
+
+	ch := make(chan struct{})
+	go func() {
+		defer close(ch)
+		defer func() {
+			if t.Failed() {
+				r.Interrupt("failed test")
+			}
+		}()
+		defer debugger.Detach()
+		if reason := debugger.Continue(); reason != DebuggerStatementActivation {
+			t.Errorf("wrong activation %s", reason)
+			return
+		}
+		str, err := debugger.ExecJSON("o")
+		if err != nil {
+			t.Errorf("error while executing %s", err)
+			return
+		}
+		var decoded map[string]interface{}
+		if err := json.Unmarshal([]byte(str), &decoded); err != nil {
+			t.Errorf("invalid JSON %s: %s", str, err)
+			return
+		}
+		expected := map[string]interface{}{
+			"a":      1.0,
+			"list":   []interface{}{1.0, "two", map[string]interface{}{"three": 3.0}, "[Circular]"},
+			"f":      "[Function add]",
+			"self":   "[Circular]",
+			"shared": map[string]interface{}{"n": nil},
+			"again":  map[string]interface{}{"n": nil},
+		}
+		if !reflect.DeepEqual(decoded, expected) {
+			t.Errorf("wrong JSON: %s", str)
+		}
+		if !strings.Contains(str, "\n  \"a\": 1") {
+			t.Errorf("not indented: %s", str)
+		}
+		if str, err := debugger.ExecJSON("undefined"); err != nil || str != "" {
+			t.Errorf("expected nothing for undefined, got %q, %v", str, err)
+		}
+	}()
+	testScript1WithRuntime(SCRIPT, intToValue(0), t, r)
+	<-ch // wait for the debugger
+}
+
+func TestDebuggerConcurrentBreakpoints(t *testing.T) {
+	const SCRIPT = `
+	var sum = 0;
+	for (var i = 0; i < 5000; i++) {
+		sum += i;
+	}
+	function unused() {
+		return sum;
+	}
+	sum;
+	`
+	r := &Runtime{}
+	r.init()
+	debugger := r.AttachDebugger()
+
+	stop := make(chan struct{})
+	mutated := make(chan struct{})
+	go func() {
+		defer close(mutated)
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			// the condition never holds so the program never pauses, but it's checked on each iteration
+			if _, err := debugger.SetConditionalBreakpoint("test.js", 4, "false"); err != nil {
+				t.Error(err)
+				return
+			}
+			id, _ := debugger.SetBreakpoint("test.js", 7)
+			_, _ = debugger.Breakpoints()
+			if err := debugger.ClearBreakpointByID(id); err != nil {
+				t.Error(err)
+				return
+			}
+			if i%2 == 0 {
+				_ = debugger.ClearBreakpoint("test.js", 4)
+			}
+		}
+	}()
+
+	ch := make(chan struct{})
+	go func() {
+		defer close(ch)
+		if reason := debugger.Continue(); reason != ProgramEndActivation {
+			t.Errorf("wrong activation %s", reason)
+		}
+	}()
+	v, err := r.RunScript("test.js", SCRIPT)
+	close(stop)
+	<-mutated
+	<-ch // wait for the debugger
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !v.SameAs(intToValue(12497500)) {
+		t.Errorf("wrong result: %v", v)
+	}
+}
+
+func TestDebuggerOnVariableChange(t *testing.T) {
+	const SCRIPT = `
+	function f() {
+		var total = "local";
+		return total;
+	}
+	var total = 0;
+	for (var i = 1; i <= 3; i++) {
+		total += i;
+	}
+	f();
+	total;
+	`
+	r := &Runtime{}
+	r.init()
+	debugger := r.AttachDebugger()
+
+	var changes []string
+	debugger.OnVariableChange("total", func(old, new Value) {
+		changes = append(changes, fmt.Sprintf("%v->%v", old, new))
+	})
+	debugger.OnVariableChange("i", func(old, new Value) {})
+	debugger.OnVariableChange("i", nil)
+	if len(debugger.variableWatches) != 1 {
+		t.Errorf("the callback wasn't removed")
+	}
+	ch := make(chan struct{})
+	go func() {
+		defer close(ch)
+		if reason := debugger.Continue(); reason != ProgramEndActivation {
+			t.Errorf("wrong activation %s", reason)
+		}
+	}()
+	v, err := r.RunScript("test.js", SCRIPT)
+	<-ch // wait for the debugger
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !v.SameAs(intToValue(6)) {
+		t.Errorf("wrong result: %v", v)
+	}
+	// in f the global is shadowed by its local, which is undefined until it's assigned
+	expected := []string{"undefined->0", "0->1", "1->3", "3->6", "6->undefined", "undefined->local", "local->6"}
+	if strings.Join(changes, " ") != strings.Join(expected, " ") {
+		t.Errorf("wrong changes: %v", changes)
+	}
+}
+
+func TestDebuggerPrintBoundFunction(t *testing.T) {
+	const SCRIPT = `
+	function add(a, b, c) { return a + b + c; }
+	var add1 = add.bind(undefined, 1);
+	var add12 = add1.bind(null, "2", [3]);
+	var bare = add.bind();
+	debugger;
+	0;
+	`
+	r := &Runtime{}
+	r.init()
+	debugger := r.AttachDebugger()
+
+	ch := make(chan struct{})
+	go func() {
+		defer close(ch)
+		defer func() {
+			if t.Failed() {
+				r.Interrupt("failed test")
+			}
+		}()
+		defer debugger.Detach()
+		if reason := debugger.Continue(); reason != DebuggerStatementActivation {
+			t.Errorf("wrong activation %s", reason)
+			return
+		}
+		for name, expected := range map[string]string{
+			"add1":  "[Bound Function: add] {this: undefined, args: [1]}",
+			"add12": "[Bound Function: bound add] {this: null, args: [2, 3]}",
+			"bare":  "[Bound Function: add] {this: undefined, args: []}",
+		} {
+			if str, err := debugger.Print(name); err != nil {
+				t.Errorf("error while executing %s", err)
+			} else if str != expected {
+				t.Errorf("expected %s to be printed as %s, got %s", name, expected, str)
+			}
+		}
+	}()
+	testScript1WithRuntime(SCRIPT, intToValue(0), t, r)
+	<-ch // wait for the debugger
+}
+
+func TestDebuggerLastResult(t *testing.T) {
+	const SCRIPT = `
+	var list = [1, 2, 3];
+	function f(_) {
+		debugger;
+		return _;
+	}
+	debugger;
+	f("shadowed");
+	`
+	r := &Runtime{}
+	r.init()
+	debugger := r.AttachDebugger()
+
+	ch := make(chan struct{})
+	go func() {
+		defer close(ch)
+		defer func() {
+			if t.Failed() {
+				r.Interrupt("failed test")
+			}
+		}()
+		defer debugger.Detach()
+		if reason := debugger.Continue(); reason != DebuggerStatementActivation {
+			t.Errorf("wrong activation %s", reason)
+			return
+		}
+		if v, err := debugger.Exec("list.length * 2"); err != nil || !v.SameAs(intToValue(6)) {
+			t.Errorf("unexpected result %v, %v", v, err)
+		}
+		if v, err := debugger.Exec("_ + 1"); err != nil || !v.SameAs(intToValue(7)) {
+			t.Errorf("the last result wasn't used: %v, %v", v, err)
+		}
+		if str, err := debugger.Print("_"); err != nil || str != "7" {
+			t.Errorf("wrong last result printed: %s, %v", str, err)
+		}
+		if _, err := debugger.Print("list"); err != nil {
+			t.Errorf("error while executing %s", err)
+		}
+		if v, err := debugger.Exec("_.length"); err != nil || !v.SameAs(intToValue(3)) {
+			t.Errorf("the printed value wasn't used: %v, %v", v, err)
+		}
+		if r.globalObject.self.hasOwnPropertyStr("_") {
+			t.Errorf("_ was left in the global object")
+		}
+		if reason := debugger.Continue(); reason != DebuggerStatementActivation {
+			t.Errorf("wrong activation %s", reason)
+			return
+		}
+		if v, err := debugger.Exec("_"); err != nil || v.String() != "shadowed" {
+			t.Errorf("the variable named _ wasn't used: %v, %v", v, err)
+		}
+	}()
+	testScript1WithRuntime(SCRIPT, newStringValue("shadowed"), t, r)
+	<-ch // wait for the debugger
+}
+
+func TestDebuggerBindingsNotGlobal(t *testing.T) {
+	const SCRIPT = `var seen = [];
+	function peek() {
+		seen.push(typeof _, typeof $hits);
+		return true;
+	}
+	function f() {
+		var local = 1;
+		return local;
+	}
+	f();
+	f();
+	debugger;
+	`
+	r := &Runtime{}
+	r.init()
+	debugger := r.AttachDebugger()
+	if _, err := debugger.SetConditionalBreakpoint("test.js", 8, "peek() && $hits > 1"); err != nil {
+		t.Fatal(err)
+	}
+
+	ch := make(chan struct{})
+	go func() {
+		defer close(ch)
+		defer func() {
+			if t.Failed() {
+				r.Interrupt("failed test")
+			}
+		}()
+		defer debugger.Detach()
+		if reason := debugger.Continue(); reason != BreakpointActivation {
+			t.Errorf("wrong activation %s", reason)
+			return
+		}
+		if _, err := debugger.Exec("local"); err != nil {
+			t.Error(err)
+		}
+		if v, err := debugger.Exec("_ + (peek() && 1)"); err != nil || !v.SameAs(intToValue(2)) {
+			t.Errorf("wrong result %v, %v", v, err)
+		}
+		if v, err := debugger.Exec("var declared = 3; declared"); err != nil || !v.SameAs(intToValue(3)) {
+			t.Errorf("wrong result %v, %v", v, err)
+		}
+		if reason := debugger.Continue(); reason != DebuggerStatementActivation {
+			t.Errorf("wrong activation %s", reason)
+			return
+		}
+		// neither the functions called by the condition nor by the expression see the bindings
+		if v, err := debugger.Exec("seen.join()"); err != nil || v.String() != "undefined,undefined,undefined,undefined,undefined,undefined" {
+			t.Errorf("wrong bindings seen: %v, %v", v, err)
+		}
+		// the global _ the expression defines stays, and is the one _ refers to from then on
+		if _, err := debugger.Exec("globalThis._ = 5"); err != nil {
+			t.Error(err)
+		}
+		if _, err := debugger.Exec("1"); err != nil {
+			t.Error(err)
+		}
+		if v, err := debugger.Exec("_"); err != nil || !v.SameAs(intToValue(5)) {
+			t.Errorf("the global _ was removed: %v, %v", v, err)
+		}
+	}()
+	testScript1WithRuntime(SCRIPT, intToValue(1), t, r)
+	<-ch // wait for the debugger
+}
+
+func TestDebuggerLazyBreakpoints(t *testing.T) {
+	const MODULE = `var exports = {};
+
+	exports.answer = 42;
+	exports;
+	`
+	const SCRIPT = `
+	var mod = require("mod.js");
+	mod.answer;
+	`
+	r := &Runtime{}
+	r.init()
+	debugger := r.AttachDebugger()
+	r.Set("require", func(name string) Value {
+		in, err := parser.ParseFile(nil, name, MODULE, 0)
+		if err != nil {
+			panic(err)
+		}
+		prg, err := CompileASTDebug(in, false)
+		if err != nil {
+			panic(err)
+		}
+		v, err := r.RunProgram(prg)
+		if err != nil {
+			panic(err)
+		}
+		return v
+	})
+	// set before the module is compiled, on a line without code
+	id, err := debugger.SetBreakpoint("mod.js", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ch := make(chan struct{})
+	go func() {
+		defer close(ch)
+		if reason := debugger.Continue(); reason != BreakpointActivation {
+			t.Errorf("wrong activation %s", reason)
+			return
+		}
+		if bp, ok := debugger.ActiveBreakpoint(); !ok || bp.ID != id || bp.Line != 2 || !bp.Verified {
+			t.Errorf("wrong breakpoint %+v", bp)
+		}
+		if debugger.Filename() != "mod.js" || debugger.Line() != 3 {
+			t.Errorf("wrong position %s:%d", debugger.Filename(), debugger.Line())
+		}
+		for {
+			select {
+			case ev := <-debugger.Events():
+				if ev.Kind != BreakpointResolvedEvent {
+					continue
+				}
+				if ev.Breakpoint != id || ev.Filename != "mod.js" || ev.Line != 3 {
+					t.Errorf("wrong event %+v", ev)
+				}
+			default:
+				t.Error("the breakpoint wasn't reported as resolved")
+			}
+			break
+		}
+		// now that the file is loaded new breakpoints are resolved right away
+		if _, err := debugger.SetBreakpoint("mod.js", 4); err != nil {
+			t.Error(err)
+		}
+		if ev := <-debugger.Events(); ev.Kind != BreakpointResolvedEvent || ev.Line != 4 {
+			t.Errorf("wrong event %+v", ev)
+		}
+		if reason := debugger.Continue(); reason != BreakpointActivation {
+			t.Errorf("wrong activation %s", reason)
+		}
+		if reason := debugger.Continue(); reason != ProgramEndActivation {
+			t.Errorf("wrong activation %s", reason)
+		}
+	}()
+	v, err := r.RunScript("test.js", SCRIPT)
+	<-ch // wait for the debugger
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !v.SameAs(intToValue(42)) {
+		t.Errorf("wrong result: %v", v)
+	}
+}
+
+func TestDebuggerStringers(t *testing.T) {
+	bp := Breakpoint{Filename: "foo.js", Line: 42, Condition: "x>0", HitCount: 3}
+	if s := bp.String(); s != "foo.js:42 [cond: x>0] (disabled, hits=3)" {
+		t.Errorf("wrong rendering of a conditional disabled breakpoint: %s", s)
+	}
+	bp = Breakpoint{Filename: "foo.js", Line: 1, Enabled: true}
+	if s := fmt.Sprint(bp); s != "foo.js:1 (enabled, hits=0)" {
+		t.Errorf("wrong rendering of a breakpoint: %s", s)
+	}
+	for _, tc := range []struct {
+		res      Result
+		expected string
+	}{
+		{Result{Value: intToValue(3)}, "3"},
+		{Result{Value: newStringValue("three")}, "three"},
+		{Result{Err: errors.New("boom")}, "error: boom"},
+		{Result{}, "<no value>"},
+	} {
+		if s := tc.res.String(); s != tc.expected {
+			t.Errorf("expected %s, got %s", tc.expected, s)
+		}
+	}
+}
+
+func TestDebuggerSourceFiles(t *testing.T) {
+	r := &Runtime{}
+	r.init()
+	debugger := r.AttachDebugger()
+
+	ch := make(chan struct{})
+	go func() {
+		defer close(ch)
+		defer debugger.Detach()
+		if reason := debugger.Continue(); reason != DebuggerStatementActivation {
+			t.Errorf("wrong activation %s", reason)
+			return
+		}
+		files := debugger.SourceFiles()
+		if expected := []string{"lib.js", "main.js", "util.js"}; !reflect.DeepEqual(files, expected) {
+			t.Errorf("expected %v, got %v", expected, files)
+		}
+	}()
+	for _, src := range []struct{ name, code string }{
+		{"util.js", "function twice(x) { return x * 2; }"},
+		{"lib.js", "function lib(x) { debugger; return twice(x); }"},
+		{"util.js", "var loadedTwice = true;"},
+		{"main.js", "lib(1);"},
+	} {
+		if _, err := r.RunScript(src.name, src.code); err != nil {
+			t.Fatal(err)
+		}
+	}
+	<-ch // wait for the debugger
+}
+
+func TestDebuggerExecBlockScope(t *testing.T) {
+	const SCRIPT = `
+	const top = "top";
+	let counter = 0;
+	function f(a) {
+		const outer = a + 1;
+		for (let i = 0; i < 1; i++) {
+			const inner = outer * 10;
+			{
+				let deepest = inner + i;
+				debugger;
+			}
+		}
+		return outer;
+	}
+	if (true) {
+		const block = "block";
+		debugger;
+	}
+	f(1);
+	`
+	r := &Runtime{}
+	r.init()
+	debugger := r.AttachDebugger()
+
+	ch := make(chan struct{})
+	go func() {
+		defer close(ch)
+		defer func() {
+			if t.Failed() {
+				r.Interrupt("failed test")
+			}
+		}()
+		defer debugger.Detach()
+		check := func(expr string, expected Value) {
+			if v, err := debugger.Exec(expr); err != nil {
+				t.Errorf("%s: error while executing %s", expr, err)
+			} else if !v.SameAs(expected) {
+				t.Errorf("%s: expected %s, got %s", expr, expected, v)
+			}
+		}
+		if reason := debugger.Continue(); reason != DebuggerStatementActivation {
+			t.Errorf("wrong activation %s", reason)
+			return
+		}
+		check("block", newStringValue("block"))
+		check("top + counter", newStringValue("top0"))
+		check("typeof deepest", newStringValue("undefined"))
+		if reason := debugger.Continue(); reason != DebuggerStatementActivation {
+			t.Errorf("wrong activation %s", reason)
+			return
+		}
+		check("deepest", intToValue(20))
+		check("inner", intToValue(20))
+		check("i", intToValue(0))
+		check("outer + a", intToValue(3))
+		check("top", newStringValue("top"))
+		check("typeof block", newStringValue("undefined"))
+		check("counter = 5", intToValue(5))
+		check("(() => deepest + outer)()", intToValue(22))
+		if str, err := debugger.Print("inner"); err != nil || str != "20" {
+			t.Errorf("wrong value printed: %s, %v", str, err)
+		}
+	}()
+	testScript1WithRuntime(SCRIPT, intToValue(2), t, r)
+	<-ch // wait for the debugger
+}
+
+func TestDebuggerDiffScopes(t *testing.T) {
+	const SCRIPT = `
+	var a = 1, b = {}, c = NaN, d = "same";
+	debugger;
+	a = 2;
+	b.x = 1;
+	c = NaN;
+	d = "sa" + "me";
+	function g(b) {
+		let local = a;
+		debugger;
+	}
+	g(3);
+	`
+	r := &Runtime{}
+	r.init()
+	debugger := r.AttachDebugger()
+
+	ch := make(chan struct{})
+	go func() {
+		defer close(ch)
+		defer func() {
+			if t.Failed() {
+				r.Interrupt("failed test")
+			}
+		}()
+		defer debugger.Detach()
+		if reason := debugger.Continue(); reason != DebuggerStatementActivation {
+			t.Errorf("wrong activation %s", reason)
+			return
+		}
+		before := debugger.CaptureScope()
+		if reason := debugger.Continue(); reason != DebuggerStatementActivation {
+			t.Errorf("wrong activation %s", reason)
+			return
+		}
+		after := debugger.CaptureScope()
+		var diffs []string
+		for _, diff := range debugger.DiffScopes(before, after) {
+			diffs = append(diffs, fmt.Sprintf("%s %s %v %v", diff.Kind, diff.Name, diff.Old, diff.New))
+		}
+		// b is shadowed by the parameter, the object it held was only mutated
+		expected := []string{
+			"changed a 1 2",
+			"added arguments <nil> [object Arguments]",
+			"changed b [object Object] 3",
+			"added local <nil> 2",
+		}
+		if strings.Join(diffs, "\n") != strings.Join(expected, "\n") {
+			t.Errorf("wrong diff:\n%s", strings.Join(diffs, "\n"))
+		}
+		if diffs := debugger.DiffScopes(after, before); len(diffs) != 4 || diffs[3].Kind != VarRemoved || diffs[3].Old == nil {
+			t.Errorf("wrong reverse diff: %v", diffs)
+		}
+	}()
+	testScript1WithRuntime(SCRIPT, _undefined, t, r)
+	<-ch // wait for the debugger
+}
+
+func TestDebuggerInstructionMap(t *testing.T) {
+	const SCRIPT = `debugger;
+	var x = 1;
+	x = x + 2;
+	x;
+	`
+	r := &Runtime{}
+	r.init()
+	debugger := r.AttachDebugger()
+
+	ch := make(chan struct{})
+	go func() {
+		defer close(ch)
+		defer func() {
+			if t.Failed() {
+				r.Interrupt("failed test")
+			}
+		}()
+		defer debugger.Detach()
+		if reason := debugger.Continue(); reason != DebuggerStatementActivation {
+			t.Errorf("wrong activation %s", reason)
+			return
+		}
+		instructions := debugger.InstructionMap()
+		if len(instructions) != len(r.vm.prg.code) {
+			t.Errorf("expected %d instructions, got %d", len(r.vm.prg.code), len(instructions))
+			return
+		}
+		for pc, ins := range instructions {
+			if ins.PC != pc || ins.Filename != "test.js" {
+				t.Errorf("wrong instruction %+v at pc %d", ins, pc)
+			}
+			if pc > 0 && ins.Line < instructions[pc-1].Line {
+				t.Errorf("line went backwards at pc %d: %+v", pc, ins)
+			}
+			if ins.Column < 1 {
+				t.Errorf("wrong column at pc %d: %+v", pc, ins)
+			}
+		}
+		if ins := instructions[debugger.PC()]; ins.Line != debugger.Line() {
+			t.Errorf("the current instruction is on line %d, not %d", ins.Line, debugger.Line())
+		}
+		if first, last := instructions[0], instructions[len(instructions)-1]; first.Opcode != "bindGlobal" || last.Opcode != "_halt" {
+			t.Errorf("wrong opcodes %s, %s", first.Opcode, last.Opcode)
+		}
+	}()
+	testScript1WithRuntime(SCRIPT, intToValue(3), t, r)
+	<-ch // wait for the debugger
+}
+
+func TestDebuggerExceptionBreakpointForTypes(t *testing.T) {
+	const SCRIPT = `debugger;
+	function f(kind) {
+		try {
+			if (kind === "range") {
+				throw new RangeError("out of range");
+			}
+			return null.x;
+		} catch (e) {
+			return e.name;
+		}
+	}
+	f("range") + f("type") + [].reduce(function() {});
+	`
+	r := &Runtime{}
+	r.init()
+	debugger := r.AttachDebugger()
+
+	ch := make(chan struct{})
+	go func() {
+		defer close(ch)
+		defer func() {
+			if t.Failed() {
+				r.Interrupt("failed test")
+			}
+		}()
+		defer debugger.Detach()
+		if reason := debugger.Continue(); reason != DebuggerStatementActivation {
+			t.Errorf("wrong activation %s", reason)
+			return
+		}
+		debugger.SetExceptionBreakpointForTypes([]string{"TypeError"})
+		if reason := debugger.Continue(); reason != ExceptionActivation {
+			t.Errorf("wrong activation %s", reason)
+			return
+		}
+		if line := debugger.Line(); line != 7 {
+			t.Errorf("expected to pause where the TypeError is thrown, line: %d", line)
+		}
+		if ex := debugger.PendingException(); ex == nil || !strings.HasPrefix(ex.Value().String(), "TypeError") {
+			t.Errorf("wrong exception %v", ex)
+		}
+		if v, err := debugger.Exec("kind"); err != nil || v.String() != "type" {
+			t.Errorf("wrong frame %v, %v", v, err)
+		}
+		// thrown by a native function, it pauses in the calling code
+		if reason := debugger.Continue(); reason != ExceptionActivation {
+			t.Errorf("wrong activation %s", reason)
+			return
+		}
+		if line := debugger.Line(); line != 12 {
+			t.Errorf("expected to pause on the call to reduce, line: %d", line)
+		}
+		debugger.SetExceptionBreakpointForTypes(nil)
+		if reason := debugger.Continue(); reason != ProgramEndActivation {
+			t.Errorf("wrong activation %s", reason)
+		}
+	}()
+	defer func() {
+		<-ch // wait for the debugger
+	}()
+	_, err := r.RunScript("test.js", SCRIPT)
+	if ex, ok := err.(*Exception); !ok || !strings.Contains(ex.Error(), "No initial value") {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestDebuggerRestartFrame(t *testing.T) {
+	const SCRIPT = `debugger;
+	let runs = 0, hRuns = 0;
+	function g() {
+		debugger;
+	}
+	function f(a) {
+		runs++;
+		let local = a * 2;
+		debugger;
+		return local + runs;
+	}
+	function h(b) {
+		hRuns++;
+		for (const v of [b]) {
+			g();
+		}
+		return b + hRuns;
+	}
+	function k() {
+		try {
+			debugger;
+		} catch (e) {
+		}
+		return 0;
+	}
+	f(5) + h(1) + k();
+	`
+	r := &Runtime{}
+	r.init()
+	debugger := r.AttachDebugger()
+
+	ch := make(chan struct{})
+	go func() {
+		defer close(ch)
+		defer func() {
+			if t.Failed() {
+				r.Interrupt("failed test")
+			}
+		}()
+		defer debugger.Detach()
+		check := func(expr string, expected Value) {
+			if v, err := debugger.Exec(expr); err != nil {
+				t.Errorf("%s: error while executing %s", expr, err)
+			} else if !v.SameAs(expected) {
+				t.Errorf("%s: expected %s, got %s", expr, expected, v)
+			}
+		}
+		cont := func() bool {
+			if reason := debugger.Continue(); reason != DebuggerStatementActivation {
+				t.Errorf("wrong activation %s", reason)
+				return false
+			}
+			return true
+		}
+		if !cont() {
+			return
+		}
+		if err := debugger.RestartFrame(0); err == nil {
+			t.Error("expected an error restarting global code")
+		}
+		if !cont() {
+			return
+		}
+		check("local = 100", intToValue(100))
+		if err := debugger.RestartFrame(0); err != nil {
+			t.Errorf("error while restarting f: %s", err)
+			return
+		}
+		if !cont() {
+			return
+		}
+		check("local", intToValue(10))
+		check("runs", intToValue(2))
+		if !cont() {
+			return
+		}
+		if err := debugger.RestartFrame(3); err == nil {
+			t.Error("expected an error for an out of range frame")
+		}
+		if err := debugger.RestartFrame(1); err != nil {
+			t.Errorf("error while restarting h: %s", err)
+			return
+		}
+		if !cont() {
+			return
+		}
+		check("hRuns", intToValue(2))
+		if !cont() {
+			return
+		}
+		if err := debugger.RestartFrame(0); err == nil {
+			t.Error("expected an error restarting a frame from a try block")
+		}
+	}()
+	testScript1WithRuntime(SCRIPT, intToValue(15), t, r)
+	<-ch // wait for the debugger
+}
+
+func TestDebuggerInTryBlock(t *testing.T) {
+	const SCRIPT = `debugger;
+	function f() {
+		debugger;
+		throw 1;
+	}
+	try {
+		f();
+	} catch (e) {
+		debugger;
+	}
+	try {
+		debugger;
+	} finally {
+	}
+	0;
+	`
+	r := &Runtime{}
+	r.init()
+	debugger := r.AttachDebugger()
+
+	ch := make(chan struct{})
+	go func() {
+		defer close(ch)
+		defer func() {
+			if t.Failed() {
+				r.Interrupt("failed test")
+			}
+		}()
+		defer debugger.Detach()
+		for i, expected := range []bool{false, true, false, false} {
+			if reason := debugger.Continue(); reason != DebuggerStatementActivation {
+				t.Errorf("wrong activation %s", reason)
+				return
+			}
+			if in := debugger.InTryBlock(); in != expected {
+				t.Errorf("%d: expected InTryBlock() to be %t at line %d", i, expected, debugger.Line())
+			}
+		}
+	}()
+	testScript1WithRuntime(SCRIPT, intToValue(0), t, r)
+	<-ch // wait for the debugger
+}
+
+func TestDebuggerStepOutWithValue(t *testing.T) {
+	const SCRIPT = `
+	function f(a) {
+		debugger;
+		const b = a * 2;
+		return b + 1;
+	}
+	const x = f(20);
+	x;
+	`
+	r := &Runtime{}
+	r.init()
+	debugger := r.AttachDebugger()
+
+	ch := make(chan struct{})
+	go func() {
+		defer close(ch)
+		defer func() {
+			if t.Failed() {
+				r.Interrupt("failed test")
+			}
+		}()
+		defer debugger.Detach()
+		if reason := debugger.Continue(); reason != DebuggerStatementActivation {
+			t.Errorf("wrong activation %s", reason)
+			return
+		}
+		res, v := debugger.StepOutWithValue()
+		if res.Err != nil {
+			t.Errorf("error while stepping out: %s", res.Err)
+			return
+		}
+		if v == nil || !v.SameAs(intToValue(41)) {
+			t.Errorf("expected 41 to be returned, got %v", v)
+		}
+		if line := debugger.Line(); line != 7 {
+			t.Errorf("expected to be back at line 7, got %d", line)
+		}
+		if res, _ := debugger.StepOutWithValue(); res.Err == nil {
+			t.Error("expected an error stepping out of global code")
+		}
+	}()
+	testScript1WithRuntime(SCRIPT, intToValue(41), t, r)
+	<-ch // wait for the debugger
+}
+
+func TestDebuggerPrintDate(t *testing.T) {
+	const SCRIPT = `var d = new Date(Date.UTC(2024, 0, 2, 3, 4, 5));
+	var invalid = new Date("not a date");
+	var m = new Map([["d", d]]);
+	debugger;
+	0;
+	`
+	r := &Runtime{}
+	r.init()
+	debugger := r.AttachDebugger()
+
+	ch := make(chan struct{})
+	go func() {
+		defer close(ch)
+		defer func() {
+			if t.Failed() {
+				r.Interrupt("failed test")
+			}
+		}()
+		defer debugger.Detach()
+		if reason := debugger.Continue(); reason != DebuggerStatementActivation {
+			t.Errorf("wrong activation %s", reason)
+			return
+		}
+		for name, expected := range map[string]string{
+			"d":       "Date(2024-01-02T03:04:05.000Z)",
+			"invalid": "Invalid Date",
+			"m":       "Map(1){d => Date(2024-01-02T03:04:05.000Z)}",
+		} {
+			if str, err := debugger.Print(name); err != nil {
+				t.Errorf("error while executing %s", err)
+			} else if str != expected {
+				t.Errorf("expected %s to be printed as %s, got %s", name, expected, str)
+			}
+		}
+	}()
+	testScript1WithRuntime(SCRIPT, intToValue(0), t, r)
+	<-ch // wait for the debugger
+}
+
+func TestDebuggerNextOverAccessors(t *testing.T) {
+	const SCRIPT = `debugger;
+	var gets = 0;
+	var o = {
+		get x() {
+			gets++;
+			return 42;
+		}
+	};
+	var v = o.x;
+	v = o.x + 1;
+	v;
+	`
+	r := &Runtime{}
+	r.init()
+	debugger := r.AttachDebugger()
+
+	ch := make(chan struct{})
+	go func() {
+		defer close(ch)
+		defer func() {
+			if t.Failed() {
+				r.Interrupt("failed test")
+			}
+		}()
+		defer debugger.Detach()
+		if reason := debugger.Continue(); reason != DebuggerStatementActivation {
+			t.Errorf("wrong activation %s", reason)
+			return
+		}
+		next := func(expected int) {
+			if err := debugger.Next(); err != nil {
+				t.Errorf("error while stepping: %s", err)
+			} else if line := debugger.Line(); line != expected {
+				t.Errorf("expected line %d, got %d", expected, line)
+			}
+		}
+		next(3)
+		next(9)
+		next(10)
+		if v, err := debugger.Exec("gets"); err != nil || !v.SameAs(intToValue(1)) {
+			t.Errorf("expected the getter to have been called once, got %v (%v)", v, err)
+		}
+		debugger.SetStepIntoAccessors(true)
+		next(5)
+		if depth := len(debugger.CallStack(CallStackOptions{HideInternal: true})); depth != 2 {
+			t.Errorf("expected to be in the getter, got %d frames", depth)
+		}
+	}()
+	testScript1WithRuntime(SCRIPT, intToValue(43), t, r)
+	<-ch // wait for the debugger
+}
+
+func TestDebuggerInstrumentation(t *testing.T) {
+	const SCRIPT = `var o = {x: 1};
+	debugger;
+	function f() {
+		return o.x;
+	}
+	f();
+	`
+	r := &Runtime{}
+	r.init()
+	debugger := r.AttachDebugger()
+
+	ch := make(chan struct{})
+	go func() {
+		defer close(ch)
+		defer func() {
+			if t.Failed() {
+				r.Interrupt("failed test")
+			}
+		}()
+		defer debugger.Detach()
+		if reason := debugger.Continue(); reason != DebuggerStatementActivation {
+			t.Errorf("wrong activation %s", reason)
+			return
+		}
+		if instruments := debugger.Instrumentation(); len(instruments) != 0 {
+			t.Errorf("expected no instrumentation, got %v", instruments)
+		}
+		id, err := debugger.SetConditionalBreakpoint("test.js", 4, "o.x > 0")
+		if err != nil {
+			t.Errorf("error while setting the breakpoint: %s", err)
+			return
+		}
+		debugger.SetFunctionBreakpoint("f")
+		if err := debugger.SetPropertyBreakpoint("o", "x", false, true); err != nil {
+			t.Errorf("error while setting the property breakpoint: %s", err)
+			return
+		}
+		debugger.OnVariableChange("o", func(old, new Value) {})
+		debugger.SetExceptionBreakpointForTypes([]string{"TypeError"})
+
+		expected := []Instrument{
+			{Kind: BreakpointInstrument},
+			{Kind: FunctionBreakpointInstrument, Function: "f"},
+			{Kind: PropertyBreakpointInstrument, Object: "o", Property: "x", OnSet: true},
+			{Kind: VariableWatchInstrument, Variable: "o"},
+			{Kind: ExceptionBreakpointInstrument, ExceptionTypes: []string{"TypeError"}},
+		}
+		instruments := debugger.Instrumentation()
+		if len(instruments) != len(expected) {
+			t.Errorf("expected %d instruments, got %v", len(expected), instruments)
+			return
+		}
+		if bp := instruments[0].Breakpoint; bp.ID != id || bp.Line != 4 || bp.Condition != "o.x > 0" {
+			t.Errorf("wrong breakpoint %s", bp)
+		}
+		instruments[0].Breakpoint = Breakpoint{}
+		if !reflect.DeepEqual(instruments, expected) {
+			t.Errorf("expected %v, got %v", expected, instruments)
+		}
+		debugger.SetExceptionBreakpoint(false)
+		debugger.SetFunctionBreakpoint("f")
+		if err := debugger.ClearFunctionBreakpoint("f"); err != nil {
+			t.Errorf("error while clearing the function breakpoint: %s", err)
+		}
+		if instruments := debugger.Instrumentation(); len(instruments) != 3 {
+			t.Errorf("expected 3 instruments, got %v", instruments)
+		}
+	}()
+	testScript1WithRuntime(SCRIPT, intToValue(1), t, r)
+	<-ch // wait for the debugger
+}
+
+func TestDebuggerExecAwait(t *testing.T) {
+	const SCRIPT = `var awaitable = 1;
+	var p = Promise.resolve(20);
+	debugger;
+	0;
+	`
+	r := &Runtime{}
+	r.init()
+	debugger := r.AttachDebugger()
+
+	ch := make(chan struct{})
+	go func() {
+		defer close(ch)
+		defer func() {
+			if t.Failed() {
+				r.Interrupt("failed test")
+			}
+		}()
+		defer debugger.Detach()
+		if reason := debugger.Continue(); reason != DebuggerStatementActivation {
+			t.Errorf("wrong activation %s", reason)
+			return
+		}
+		for expr, expected := range map[string]Value{
+			"await Promise.resolve(5)":    intToValue(5),
+			"await p.then(x => x * 2)":    intToValue(40),
+			"await(p)":                    intToValue(20),
+			"await 3":                     intToValue(3),
+			"await ({then(f) { f(7); }})": intToValue(7),
+			"awaitable":                   intToValue(1),
+		} {
+			if v, err := debugger.Exec(expr); err != nil {
+				t.Errorf("%s: error while executing %s", expr, err)
+			} else if !v.SameAs(expected) {
+				t.Errorf("%s: expected %s, got %s", expr, expected, v)
+			}
+		}
+		if _, err := debugger.Exec(`await Promise.reject(new Error("boom"))`); err == nil || !strings.Contains(err.Error(), "boom") {
+			t.Errorf("expected the rejection as an error, got %v", err)
+		}
+		if _, err := debugger.Exec("await new Promise(() => {})"); err == nil {
+			t.Error("expected an error awaiting a promise which never settles")
+		}
+	}()
+	testScript1WithRuntime(SCRIPT, intToValue(0), t, r)
+	<-ch // wait for the debugger
+}
+
+func TestDebuggerPrintThrowingGetter(t *testing.T) {
+	const SCRIPT = `var o = {
+		a: 1,
+		get b() {
+			throw new Error("boom");
+		},
+		c: {d: "x"}
+	};
+	var bad = {toString() { throw bad; }};
+	var nested = new Map([["o", o]]);
+	debugger;
+	0;
+	`
+	r := &Runtime{}
+	r.init()
+	debugger := r.AttachDebugger()
+
+	ch := make(chan struct{})
+	go func() {
+		defer close(ch)
+		defer func() {
+			if t.Failed() {
+				r.Interrupt("failed test")
+			}
+		}()
+		defer debugger.Detach()
+		if reason := debugger.Continue(); reason != DebuggerStatementActivation {
+			t.Errorf("wrong activation %s", reason)
+			return
+		}
+		for name, expected := range map[string]string{
+			"o":      "{a: 1, b: <error: boom>, c: {d: x}}",
+			"nested": "Map(1){o => {a: 1, b: <error: boom>, c: {d: x}}}",
+			"bad":    "{toString: toString() { throw bad; }}",
+		} {
+			if str, err := debugger.Print(name); err != nil {
+				t.Errorf("error while executing %s", err)
+			} else if str != expected {
+				t.Errorf("expected %s to be printed as %s, got %s", name, expected, str)
+			}
+		}
+		if str := inspect(debugger.vm.r.globalObject.self.getStr("bad", nil), maxInspectDepth+1); str != "<error: [object Object]>" {
+			t.Errorf("wrong rendering of an object with a throwing toString: %s", str)
+		}
+	}()
+	testScript1WithRuntime(SCRIPT, intToValue(0), t, r)
+	<-ch // wait for the debugger
+}
+
+func TestDebuggerLoopConditionAndBody(t *testing.T) {
+	const SCRIPT = `debugger;
+	var s = 0;
+	for (var i = 0; i < 3; i++) {
+		s += i;
+	}
+	s;
+	`
+	r := &Runtime{}
+	r.init()
+	debugger := r.AttachDebugger()
+
+	ch := make(chan struct{})
+	go func() {
+		defer close(ch)
+		defer func() {
+			if t.Failed() {
+				r.Interrupt("failed test")
+			}
+		}()
+		defer debugger.Detach()
+		if reason := debugger.Continue(); reason != DebuggerStatementActivation {
+			t.Errorf("wrong activation %s", reason)
+			return
+		}
+		for _, line := range []int{3, 4} {
+			if _, err := debugger.SetBreakpoint("test.js", line); err != nil {
+				t.Errorf("error while setting the breakpoint: %s", err)
+				return
+			}
+		}
+		// the breakpoint on the header pauses at the condition, after the update of the previous iteration
+		var pauses []string
+		for debugger.Continue() == BreakpointActivation {
+			i, err := debugger.Exec("i")
+			if err != nil {
+				t.Errorf("error while executing %s", err)
+				return
+			}
+			pauses = append(pauses, fmt.Sprintf("%d:%s", debugger.Line(), i))
+		}
+		expected := "3:0 4:0 3:1 4:1 3:2 4:2 3:3"
+		if str := strings.Join(pauses, " "); str != expected {
+			t.Errorf("expected pauses %s, got %s", expected, str)
+		}
+	}()
+	testScript1WithRuntime(SCRIPT, intToValue(3), t, r)
+	<-ch // wait for the debugger
+}
+
+func TestDebuggerResumeSwallowingException(t *testing.T) {
+	const SCRIPT = `debugger;
+	var reached = false;
+	function f() {
+		throw new Error("boom");
+		reached = true;
+		return 42;
+	}
+	var res;
+	try {
+		res = f();
+	} catch (e) {
+		res = "caught";
+	}
+	debugger;
+	[res, reached].join();
+	`
+	r := &Runtime{}
+	r.init()
+	debugger := r.AttachDebugger()
+
+	ch := make(chan struct{})
+	go func() {
+		defer close(ch)
+		defer func() {
+			if t.Failed() {
+				r.Interrupt("failed test")
+			}
+		}()
+		defer debugger.Detach()
+		if reason := debugger.Continue(); reason != DebuggerStatementActivation {
+			t.Errorf("wrong activation %s", reason)
+			return
+		}
+		if err := debugger.ResumeSwallowingException(); err == nil {
+			t.Error("expected an error when not paused on an exception")
+		}
+		debugger.SetExceptionBreakpoint(true)
+		if reason := debugger.Continue(); reason != ExceptionActivation {
+			t.Errorf("wrong activation %s", reason)
+			return
+		}
+		if line := debugger.Line(); line != 4 {
+			t.Errorf("expected to pause at the throw at line 4, got %d", line)
+		}
+		if err := debugger.ResumeSwallowingException(); err != nil {
+			t.Errorf("error while resuming: %s", err)
+		}
+	}()
+	testScript1WithRuntime(SCRIPT, newStringValue("42,true"), t, r)
+	<-ch // wait for the debugger
+}
+
+func TestDebuggerJustMyCode(t *testing.T) {
+	const LIB = `var exports = {};
+	exports.twice = function(f, x) {
+		var y = f(x);
+		return f(y);
+	};
+	exports;
+	`
+	const SCRIPT = `var lib = require("node_modules/lib.js");
+	debugger;
+	var res = lib.twice(function(x) {
+		return x + 1;
+	}, 1);
+	res;
+	`
+	r := &Runtime{}
+	r.init()
+	debugger := r.AttachDebugger()
+	r.Set("require", func(name string) Value {
+		in, err := parser.ParseFile(nil, name, LIB, 0)
+		if err != nil {
+			panic(err)
+		}
+		prg, err := CompileASTDebug(in, false)
+		if err != nil {
+			panic(err)
+		}
+		v, err := r.RunProgram(prg)
+		if err != nil {
+			panic(err)
+		}
+		return v
+	})
+
+	ch := make(chan struct{})
+	go func() {
+		defer close(ch)
+		defer func() {
+			if t.Failed() {
+				r.Interrupt("failed test")
+			}
+		}()
+		defer debugger.Detach()
+		if reason := debugger.Continue(); reason != DebuggerStatementActivation {
+			t.Errorf("wrong activation %s", reason)
+			return
+		}
+		debugger.SetJustMyCode(true)
+		debugger.AddMyCodePath("test.js")
+		callbackPauses := 0
+		for i := 0; i < 1000; i++ {
+			if err := debugger.StepIn(); err != nil {
+				break
+			}
+			if filename := debugger.Filename(); filename != "test.js" {
+				t.Errorf("paused in %s:%d", filename, debugger.Line())
+				return
+			}
+			if debugger.Line() == 4 && debugger.PC() == 0 {
+				callbackPauses++
+			}
+		}
+		if callbackPauses != 2 {
+			t.Errorf("expected to step into the callback twice, got %d", callbackPauses)
+		}
+	}()
+	r.RunScript("test.js", SCRIPT)
+	<-ch // wait for the debugger
+	if v := r.Get("res"); v == nil || !v.SameAs(intToValue(3)) {
+		t.Errorf("wrong result %v", v)
+	}
+}
+
+func TestDebuggerNextMultiLineChain(t *testing.T) {
+	const SCRIPT = `debugger;
+	var res = [1, 2, 3]
+		.map(x => x * 2)
+		.filter(x => x > 2)
+		.reduce((a, b) => a + b, 0);
+	res;
+	`
+	r := &Runtime{}
+	r.init()
+	debugger := r.AttachDebugger()
+
+	ch := make(chan struct{})
+	go func() {
+		defer close(ch)
+		defer func() {
+			if t.Failed() {
+				r.Interrupt("failed test")
+			}
+		}()
+		defer debugger.Detach()
+		if reason := debugger.Continue(); reason != DebuggerStatementActivation {
+			t.Errorf("wrong activation %s", reason)
+			return
+		}
+		// the methods are looked up on their own lines too, not on the line the chain starts on
+		var lookups []int
+		for _, info := range debugger.InstructionMap() {
+			if info.Opcode == "getPropCallee" {
+				lookups = append(lookups, info.Line)
+			}
+		}
+		if fmt.Sprint(lookups) != "[3 4 5]" {
+			t.Errorf("wrong lines of the method lookups %v", lookups)
+		}
+		var lines []int
+		for debugger.Line() != 6 {
+			if err := debugger.Next(); err != nil {
+				t.Errorf("error while stepping: %s", err)
+				return
+			}
+			lines = append(lines, debugger.Line())
+		}
+		if fmt.Sprint(lines) != "[3 4 5 2 6]" {
+			t.Errorf("wrong lines visited %v", lines)
+		}
+	}()
+	testScript1WithRuntime(SCRIPT, intToValue(10), t, r)
+	<-ch // wait for the debugger
+}
+
+func TestDebuggerHeapSnapshot(t *testing.T) {
+	const SCRIPT = `class Point {
+		constructor(x, y) {
+			this.x = x;
+			this.y = y;
+		}
+	}
+	var p = new Point(1, 2);
+	var list = [p, {a: 1}];
+	var m = new Map([["k", {deep: true}]]);
+	var long = {text: "x".repeat(200)};
+	function f() {
+		var local = {inFrame: 1};
+		var cyc = {};
+		cyc.self = cyc;
+		debugger;
+	}
+	f();
+	0;
+	`
+	r := &Runtime{}
+	r.init()
+	debugger := r.AttachDebugger()
+
+	ch := make(chan struct{})
+	go func() {
+		defer close(ch)
+		defer func() {
+			if t.Failed() {
+				r.Interrupt("failed test")
+			}
+		}()
+		defer debugger.Detach()
+		if reason := debugger.Continue(); reason != DebuggerStatementActivation {
+			t.Errorf("wrong activation %s", reason)
+			return
+		}
+		byPath := make(map[string]ObjectSummary)
+		for _, summary := range debugger.HeapSnapshot() {
+			if _, exists := byPath[summary.Path]; exists {
+				t.Errorf("%s reported twice", summary.Path)
+			}
+			byPath[summary.Path] = summary
+		}
+		for path, expected := range map[string]ObjectSummary{
+			"globalThis":             {Type: "Object"},
+			"globalThis.p":           {Type: "Point", Preview: "{x: 1, y: 2}"},
+			"globalThis.list":        {Type: "Array", Preview: "[{x: 1, y: 2},{a: 1}]"},
+			"globalThis.list.1":      {Type: "Object", Preview: "{a: 1}"},
+			"globalThis.m":           {Type: "Map", Preview: "Map(1){k => {deep: true}}"},
+			"globalThis.m.<value 0>": {Type: "Object", Preview: "{deep: true}"},
+			"<scope>.local":          {Type: "Object", Preview: "{inFrame: 1}"},
+			"<scope>.cyc":            {Type: "Object"},
+		} {
+			summary, exists := byPath[path]
+			if !exists {
+				t.Errorf("%s is missing", path)
+				continue
+			}
+			if summary.Type != expected.Type || expected.Preview != "" && summary.Preview != expected.Preview {
+				t.Errorf("%s: expected %+v, got %+v", path, expected, summary)
+			}
+			if summary.Size <= 0 {
+				t.Errorf("%s: wrong size %d", path, summary.Size)
+			}
+		}
+		if _, exists := byPath["<scope>.cyc.self"]; exists {
+			t.Error("the cycle was followed")
+		}
+		if summary := byPath["globalThis.long"]; len(summary.Preview) != maxPreviewLength+3 || !strings.HasSuffix(summary.Preview, "...") {
+			t.Errorf("the preview wasn't truncated: %s", summary.Preview)
+		}
+	}()
+	testScript1WithRuntime(SCRIPT, intToValue(0), t, r)
+	<-ch // wait for the debugger
+}
+
+func TestDebuggerHeapSnapshotRunsNoCode(t *testing.T) {
+	const SCRIPT = `var n = 0;
+	var o = {get g() { n++; return 1; }, v: 1};
+	var p = new Proxy({}, {ownKeys() { n++; return []; }, get() { n++; }});
+	var arr = [{toString() { n++; return ""; }}];
+	function f() {}
+	f.toString = function() { n++; return ""; };
+	var re = /x/;
+	re[Symbol.toPrimitive] = function() { n++; return ""; };
+	debugger;
+	n;
+	`
+	r := &Runtime{}
+	r.init()
+	debugger := r.AttachDebugger()
+
+	ch := make(chan struct{})
+	go func() {
+		defer close(ch)
+		defer func() {
+			if t.Failed() {
+				r.Interrupt("failed test")
+			}
+		}()
+		defer debugger.Detach()
+		if reason := debugger.Continue(); reason != DebuggerStatementActivation {
+			t.Errorf("wrong activation %s", reason)
+			return
+		}
+		byPath := make(map[string]string)
+		for _, summary := range debugger.HeapSnapshot() {
+			byPath[summary.Path] = summary.Preview
+		}
+		for path, expected := range map[string]string{
+			"globalThis.o":   "{g: [Getter/Setter], v: 1}",
+			"globalThis.p":   "[Proxy]",
+			"globalThis.arr": "[{toString: [Function: toString]}]",
+			"globalThis.f":   "[Function: f]",
+			"globalThis.re":  "[RegExp]",
+		} {
+			if preview := byPath[path]; preview != expected {
+				t.Errorf("%s: wrong preview %q, expected %q", path, preview, expected)
+			}
+		}
+	}()
+	testScript1WithRuntime(SCRIPT, intToValue(0), t, r) // none of the code counting in n has run
+	<-ch                                                // wait for the debugger
+}
+
+func TestDebuggerHitCountCondition(t *testing.T) {
+	const SCRIPT = `
+	var sum = 0;
+	for (var i = 0; i < 6; i++) {
+		sum += i;
+	}
+	sum;
+	`
+	r := &Runtime{}
+	r.init()
+	debugger := r.AttachDebugger()
+	if _, err := debugger.SetConditionalBreakpoint("test.js", 4, "$hits > 3"); err != nil {
+		t.Fatal(err)
+	}
+
+	ch := make(chan struct{})
+	go func() {
+		defer close(ch)
+		defer func() {
+			if t.Failed() {
+				r.Interrupt("failed test")
+			}
+		}()
+		defer debugger.Detach()
+		for _, want := range []int64{3, 4, 5} {
+			if reason := debugger.Continue(); reason != BreakpointActivation {
+				t.Errorf("wrong activation %s", reason)
+				return
+			}
+			if v, err := debugger.Exec("i"); err != nil || !v.SameAs(intToValue(want)) {
+				t.Errorf("wrong value of i: %v %v, expected %d", v, err, want)
+			}
+			if v, err := debugger.Exec("typeof $hits"); err != nil || v.String() != "undefined" {
+				t.Errorf("$hits is visible outside of the condition: %v %v", v, err)
+			}
+		}
+		if reason := debugger.Continue(); reason != ProgramEndActivation {
+			t.Errorf("wrong activation %s", reason)
+		}
+	}()
+	testScript1WithRuntime(SCRIPT, intToValue(15), t, r)
+	<-ch // wait for the debugger
+}
+
+func TestDebuggerEvalAt(t *testing.T) {
+	const SCRIPT = `var x = 1;
+	function f(a) {
+		var local = a * 2;
+		return g(local);
+	}
+	function g(local) {
+		debugger;
+		return local;
+	}
+	f(21);
+	`
+	r := &Runtime{}
+	r.init()
+	debugger := r.AttachDebugger()
+
+	ch := make(chan struct{})
+	go func() {
+		defer close(ch)
+		defer func() {
+			if t.Failed() {
+				r.Interrupt("failed test")
+			}
+		}()
+		defer debugger.Detach()
+		if reason := debugger.Continue(); reason != DebuggerStatementActivation {
+			t.Errorf("wrong activation %s", reason)
+			return
+		}
+		if res := debugger.EvalAt("test.js", 3, 7, "local; a"); res.Err != nil || !res.Value.SameAs(intToValue(21)) {
+			t.Errorf("wrong value of a in f: %v", res)
+		}
+		if res := debugger.EvalAt("test.js", 4, 12, "local"); res.Err != nil || !res.Value.SameAs(intToValue(42)) {
+			t.Errorf("wrong value of local in f: %v", res)
+		}
+		if res := debugger.EvalAt("test.js", 1, 5, "typeof local"); res.Err != nil || res.Value.String() != "undefined" {
+			t.Errorf("local is visible in the global code: %v", res)
+		}
+		if res := debugger.EvalAt("test.js", 8, 10, "local = 43"); res.Err != nil {
+			t.Error(res.Err)
+		}
+		if res := debugger.EvalAt("other.js", 1, 1, "x"); res.Err == nil {
+			t.Errorf("expected an error for a file which isn't running, got %v", res)
+		}
+		// an editor's absolute path matches the name the script was compiled with
+		if res := debugger.EvalAt("/home/user/project/test.js", 4, 12, "local"); res.Err == nil {
+			t.Errorf("expected an error for a path which doesn't match exactly, got %v", res)
+		}
+		debugger.SetPathMatching(SuffixPathMatch)
+		if res := debugger.EvalAt("/home/user/project/test.js", 4, 12, "local"); res.Err != nil || !res.Value.SameAs(intToValue(42)) {
+			t.Errorf("wrong value of local in f with suffix matching: %v", res)
+		}
+		if v, err := debugger.Exec("local"); err != nil || !v.SameAs(intToValue(43)) {
+			t.Errorf("the current frame changed: %v %v", v, err)
+		}
+		if reason := debugger.Continue(); reason != ProgramEndActivation {
+			t.Errorf("wrong activation %s", reason)
+		}
+	}()
+	testScript1WithRuntime(SCRIPT, intToValue(43), t, r)
+	<-ch // wait for the debugger
+}
+
+func TestDebuggerPCForLine(t *testing.T) {
+	const SCRIPT = `debugger;
+	var x = 1;
+	for (var i = 0; i < 2; i++) {
+		x += i;
+	}
+	function f() {
+		return x;
+	}
+	f();
+	`
+	r := &Runtime{}
+	r.init()
+	debugger := r.AttachDebugger()
+
+	ch := make(chan struct{})
+	go func() {
+		defer close(ch)
+		defer func() {
+			if t.Failed() {
+				r.Interrupt("failed test")
+			}
+		}()
+		defer debugger.Detach()
+		if reason := debugger.Continue(); reason != DebuggerStatementActivation {
+			t.Errorf("wrong activation %s", reason)
+			return
+		}
+		pc := debugger.PC()
+		for _, line := range []int{2, 3, 4, 9} {
+			target, ok := debugger.PCForLine("test.js", line)
+			if !ok {
+				t.Errorf("no pc for line %d", line)
+				continue
+			}
+			debugger.vm.pc = target
+			if got := debugger.Line(); got != line {
+				t.Errorf("pc %d for line %d is on line %d", target, line, got)
+			}
+		}
+		debugger.vm.pc = pc
+		if _, ok := debugger.PCForLine("test.js", 7); ok {
+			t.Error("found a pc for a line of a function")
+		}
+		if _, ok := debugger.PCForLine("other.js", 2); ok {
+			t.Error("found a pc for a line of another file")
+		}
+		if reason := debugger.Continue(); reason != ProgramEndActivation {
+			t.Errorf("wrong activation %s", reason)
+		}
+	}()
+	testScript1WithRuntime(SCRIPT, intToValue(2), t, r)
+	<-ch // wait for the debugger
+}
+
+func TestDebuggerWatchGlobal(t *testing.T) {
+	const SCRIPT = `debugger;
+	var x = 1;
+	function inner() {
+		globalThis.x = 5;
+		x = 5;
+		return x;
+	}
+	function outer() {
+		return inner();
+	}
+	outer();
+	x = 6;
+	`
+	r := &Runtime{}
+	r.init()
+	debugger := r.AttachDebugger()
+
+	ch := make(chan struct{})
+	go func() {
+		defer close(ch)
+		defer func() {
+			if t.Failed() {
+				r.Interrupt("failed test")
+			}
+		}()
+		defer debugger.Detach()
+		if reason := debugger.Continue(); reason != DebuggerStatementActivation {
+			t.Errorf("wrong activation %s", reason)
+			return
+		}
+		debugger.WatchGlobal("x")
+		debugger.WatchGlobal("x")
+		if n := len(debugger.Instrumentation()); n != 1 {
+			t.Errorf("wrong number of instruments: %d", n)
+		}
+		for _, want := range []struct {
+			line     int
+			old, new int64
+		}{{2, 0, 1}, {4, 1, 5}} {
+			if reason := debugger.Continue(); reason != GlobalAssignmentActivation {
+				t.Errorf("wrong activation %s", reason)
+				return
+			}
+			a, ok := debugger.Assignment()
+			if !ok {
+				t.Error("no assignment")
+				return
+			}
+			old := Value(_undefined)
+			if want.old != 0 {
+				old = intToValue(want.old)
+			}
+			if a.Name != "x" || a.Filename != "test.js" || a.Line != want.line || !a.Old.SameAs(old) || !a.New.SameAs(intToValue(want.new)) {
+				t.Errorf("wrong assignment %+v", a)
+			}
+		}
+		if depth := debugger.Depth(); depth != 3 {
+			t.Errorf("wrong depth %d", depth)
+		}
+		if _, err := debugger.Exec("x = 7"); err != nil {
+			t.Error(err)
+		}
+		if reason := debugger.Continue(); reason != GlobalAssignmentActivation {
+			t.Errorf("wrong activation %s", reason)
+			return
+		}
+		if a, _ := debugger.Assignment(); a.Line != 5 || !a.Old.SameAs(intToValue(7)) {
+			t.Errorf("wrong assignment %+v", a)
+		}
+		if err := debugger.UnwatchGlobal("x"); err != nil {
+			t.Error(err)
+		}
+		if err := debugger.UnwatchGlobal("x"); err == nil {
+			t.Error("expected an error for a global which isn't watched")
+		}
+		if reason := debugger.Continue(); reason != ProgramEndActivation {
+			t.Errorf("wrong activation %s", reason)
+		}
+	}()
+	testScript1WithRuntime(SCRIPT, intToValue(6), t, r)
+	<-ch // wait for the debugger
+}
+
+func TestDebuggerBreakOnStart(t *testing.T) {
+	const SCRIPT = `var x = 1;
+	x++;
+	x;
+	`
+	r := &Runtime{}
+	r.init()
+	debugger := r.AttachDebugger()
+	debugger.SetBreakOnStart(true)
+
+	ch := make(chan struct{})
+	go func() {
+		defer close(ch)
+		defer func() {
+			if t.Failed() {
+				r.Interrupt("failed test")
+			}
+		}()
+		defer debugger.Detach()
+		if reason := debugger.Continue(); reason != ProgramStartActivation {
+			t.Errorf("wrong activation %s", reason)
+			return
+		}
+		if line, pc := debugger.Line(), debugger.PC(); line != 1 || pc != 0 {
+			t.Errorf("wrong position at the start: line %d, pc %d", line, pc)
+		}
+		if v, err := debugger.Exec("typeof x"); err != nil || v.String() != "undefined" {
+			t.Errorf("the first statement has run already: %v %v", v, err)
+		}
+		for _, line := range []int{2, 3} {
+			if err := debugger.Next(); err != nil {
+				t.Error(err)
+				return
+			}
+			if l := debugger.Line(); l != line {
+				t.Errorf("wrong line: %d, expected %d", l, line)
+			}
+		}
+		if reason := debugger.Continue(); reason != ProgramEndActivation {
+			t.Errorf("wrong activation %s", reason)
+		}
+	}()
+	testScript1WithRuntime(SCRIPT, intToValue(2), t, r)
+	<-ch // wait for the debugger
+}
+
+func TestDebuggerBreakOnStartAtBreakpoint(t *testing.T) {
+	const SCRIPT = `var x = 1;
+	x++;
+	x;
+	`
+	r := &Runtime{}
+	r.init()
+	debugger := r.AttachDebugger()
+	debugger.SetBreakOnStart(true)
+	for _, line := range []int{1, 3} {
+		if _, err := debugger.SetBreakpoint("test.js", line); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ch := make(chan struct{})
+	go func() {
+		defer close(ch)
+		defer func() {
+			if t.Failed() {
+				r.Interrupt("failed test")
+			}
+		}()
+		defer debugger.Detach()
+		if reason := debugger.Continue(); reason != ProgramStartActivation {
+			t.Errorf("wrong activation %s", reason)
+			return
+		}
+		// the program has paused on the first line already, its breakpoint doesn't pause it again
+		if reason := debugger.Continue(); reason != BreakpointActivation {
+			t.Errorf("wrong activation %s", reason)
+		} else if line := debugger.Line(); line != 3 {
+			t.Errorf("wrong line: %d, expected 3", line)
+		}
+		if reason := debugger.Continue(); reason != ProgramEndActivation {
+			t.Errorf("wrong activation %s", reason)
+		}
+	}()
+	testScript1WithRuntime(SCRIPT, intToValue(2), t, r)
+	<-ch // wait for the debugger
+}
+
+func TestDebuggerBreakpointOncePerCall(t *testing.T) {
+	const SCRIPT = `var s = 0;
+	function f(n) {
+		for (var i = 0; i < 3; i++) {
+			s += n;
+			if (n > 0 && i === 0) f(n - 1);
+		}
+	}
+	f(2);
+	f(1);
+	s;
+	`
+	r := &Runtime{}
+	r.init()
+	debugger := r.AttachDebugger()
+	if _, err := debugger.SetBreakpoint("test.js", 4); err != nil {
+		t.Fatal(err)
+	}
+	if err := debugger.SetBreakpointOncePerCall("test.js", 4, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := debugger.SetBreakpointOncePerCall("test.js", 5, true); err == nil {
+		t.Fatal("expected an error for a line without a breakpoint")
+	}
+
+	ch := make(chan struct{})
+	go func() {
+		defer close(ch)
+		defer func() {
+			if t.Failed() {
+				r.Interrupt("failed test")
+			}
+		}()
+		defer debugger.Detach()
+		var calls []string
+		for {
+			reason := debugger.Continue()
+			if reason == ProgramEndActivation {
+				break
+			}
+			if reason != BreakpointActivation {
+				t.Errorf("wrong activation %s", reason)
+				return
+			}
+			v, err := debugger.Exec("n + ':' + i")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			calls = append(calls, v.String())
+		}
+		// f(2), f(1), f(0), then f(1), f(0)
+		if got := strings.Join(calls, " "); got != "2:0 1:0 0:0 1:0 0:0" {
+			t.Errorf("wrong pauses: %s", got)
+		}
+		bps := debugger.Instrumentation()
+		if len(bps) != 1 || !bps[0].Breakpoint.OncePerCall || bps[0].Breakpoint.HitCount != 15 {
+			t.Errorf("wrong breakpoint state: %+v", bps)
+		}
+	}()
+	testScript1WithRuntime(SCRIPT, intToValue(12), t, r)
+	<-ch // wait for the debugger
+}
+
+func TestDebuggerStackDelta(t *testing.T) {
+	const SCRIPT = `function g() {
+		var y = 2;
+		return y;
+	}
+	function f() {
+		debugger;
+		var x = g();
+		return x;
+	}
+	f();
+	`
+	r := &Runtime{}
+	r.init()
+	debugger := r.AttachDebugger()
+
+	names := func(frames []StackFrame) string {
+		var s []string
+		for _, frame := range frames {
+			s = append(s, frame.FuncName())
+		}
+		return strings.Join(s, ",")
+	}
+	ch := make(chan struct{})
+	go func() {
+		defer close(ch)
+		defer func() {
+			if t.Failed() {
+				r.Interrupt("failed test")
+			}
+		}()
+		defer debugger.Detach()
+		if reason := debugger.Continue(); reason != DebuggerStatementActivation {
+			t.Errorf("wrong activation %s", reason)
+			return
+		}
+		if pushed, popped := debugger.StackDelta(); names(pushed) != "f,<anonymous>" || len(popped) != 0 {
+			t.Errorf("wrong delta at the first pause: %q %q", names(pushed), names(popped))
+		}
+		if err := debugger.StepIn(); err != nil {
+			t.Error(err)
+			return
+		}
+		if pushed, popped := debugger.StackDelta(); len(pushed) != 0 || len(popped) != 0 {
+			t.Errorf("wrong delta after a step in the frame: %q %q", names(pushed), names(popped))
+		}
+		for debugger.Depth() == 2 {
+			if err := debugger.StepIn(); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+		if pushed, popped := debugger.StackDelta(); names(pushed) != "g" || len(popped) != 0 {
+			t.Errorf("wrong delta after stepping into g: %q %q", names(pushed), names(popped))
+		}
+		if res, _ := debugger.StepOutWithValue(); res.Err != nil {
+			t.Error(res.Err)
+			return
+		}
+		if pushed, popped := debugger.StackDelta(); len(pushed) != 0 || names(popped) != "g" {
+			t.Errorf("wrong delta after returning from g: %q %q", names(pushed), names(popped))
+		}
+		if reason := debugger.Continue(); reason != ProgramEndActivation {
+			t.Errorf("wrong activation %s", reason)
+		}
+	}()
+	testScript1WithRuntime(SCRIPT, intToValue(2), t, r)
+	<-ch // wait for the debugger
+}
+
+func TestDebuggerEvalSilent(t *testing.T) {
+	const SCRIPT = `var x = 1;
+	debugger;
+	x;
+	`
+	r := &Runtime{}
+	r.init()
+	debugger := r.AttachDebugger()
+	var changes []string
+	debugger.OnVariableChange("x", func(old, new Value) {
+		changes = append(changes, fmt.Sprintf("%v->%v", old, new))
+	})
+
+	ch := make(chan struct{})
+	go func() {
+		defer close(ch)
+		defer func() {
+			if t.Failed() {
+				r.Interrupt("failed test")
+			}
+		}()
+		defer debugger.Detach()
+		if reason := debugger.Continue(); reason != DebuggerStatementActivation {
+			t.Errorf("wrong activation %s", reason)
+			return
+		}
+		if _, err := debugger.Exec("40 + 2"); err != nil {
+			t.Error(err)
+		}
+		if res := debugger.EvalSilent("_ + 1"); res.Err != nil || !res.Value.SameAs(intToValue(43)) {
+			t.Errorf("wrong result: %v", res)
+		}
+		if res := debugger.EvalSilent("x = 2"); res.Err != nil {
+			t.Error(res.Err)
+		}
+		if v := debugger.LastResult(); v == nil || !v.SameAs(intToValue(42)) {
+			t.Errorf("wrong last result: %v", v)
+		}
+		if v, err := debugger.Exec("_"); err != nil || !v.SameAs(intToValue(42)) {
+			t.Errorf("wrong value of _: %v %v", v, err)
+		}
+		if res := debugger.EvalSilent(""); res.Err == nil {
+			t.Error("expected an error for an empty expression")
+		}
+		if reason := debugger.Continue(); reason != ProgramEndActivation {
+			t.Errorf("wrong activation %s", reason)
+		}
+	}()
+	testScript1WithRuntime(SCRIPT, intToValue(2), t, r)
+	<-ch // wait for the debugger
+	if got := strings.Join(changes, " "); got != "undefined->1" {
+		t.Errorf("wrong changes: %s", got)
+	}
+}
+
+func TestDebuggerPathMatching(t *testing.T) {
+	const SCRIPT = `var x = 1;
+	x++;
+	x;
+	`
+	for _, tc := range []struct {
+		mode   PathMatchMode
+		bpFile string
+		fires  bool
+	}{
+		{ExactPathMatch, "lib/foo.js", true},
+		{ExactPathMatch, "/src/lib/foo.js", false},
+		{SuffixPathMatch, "/src/lib/foo.js", true},
+		{SuffixPathMatch, "foo.js", true},
+		{SuffixPathMatch, "/src/mylib/foo.js", false},
+		{SuffixPathMatch, "other/foo.js", false},
+		{BasenamePathMatch, `C:\src\foo.js`, true},
+		{BasenamePathMatch, "lib/bar.js", false},
+	} {
+		r := &Runtime{}
+		r.init()
+		debugger := r.AttachDebugger()
+		debugger.SetPathMatching(tc.mode)
+		if _, err := debugger.SetBreakpoint(tc.bpFile, 2); err != nil {
+			t.Fatal(err)
+		}
+
+		ch := make(chan struct{})
+		go func() {
+			defer close(ch)
+			defer func() {
+				if t.Failed() {
+					r.Interrupt("failed test")
+				}
+			}()
+			defer debugger.Detach()
+			reason := debugger.Continue()
+			if !tc.fires {
+				if reason != ProgramEndActivation {
+					t.Errorf("%s %s: wrong activation %s", tc.mode, tc.bpFile, reason)
+				}
+				return
+			}
+			if reason != BreakpointActivation {
+				t.Errorf("%s %s: wrong activation %s", tc.mode, tc.bpFile, reason)
+				return
+			}
+			if filename, line := debugger.Filename(), debugger.Line(); filename != "lib/foo.js" || line != 2 {
+				t.Errorf("%s %s: paused at %s:%d", tc.mode, tc.bpFile, filename, line)
+			}
+			if bp, ok := debugger.ActiveBreakpoint(); !ok || bp.Filename != tc.bpFile || !bp.Verified {
+				t.Errorf("%s %s: wrong active breakpoint %+v", tc.mode, tc.bpFile, bp)
+			}
+			if lines, err := debugger.List(); err != nil {
+				t.Errorf("%s %s: %s", tc.mode, tc.bpFile, err)
+			} else {
+				for _, line := range lines {
+					if line.HasBreakpoint != (line.Number == 2) {
+						t.Errorf("%s %s: wrong breakpoint marker of line %d", tc.mode, tc.bpFile, line.Number)
+					}
+				}
+			}
+			if reason := debugger.Continue(); reason != ProgramEndActivation {
+				t.Errorf("%s %s: wrong activation %s", tc.mode, tc.bpFile, reason)
+			}
+		}()
+		if _, err := r.RunScript("lib/foo.js", SCRIPT); err != nil {
+			t.Fatal(err)
+		}
+		<-ch // wait for the debugger
+	}
+}
+
+func TestDebuggerPendingOperation(t *testing.T) {
+	const SCRIPT = `debugger;
+	block();
+	block();
+	debugger;
+	`
+	r := &Runtime{}
+	r.init()
+	debugger := r.AttachDebugger()
+	release := make(chan struct{})
+	r.Set("block", func() {
+		<-release
+	})
+
+	ch := make(chan struct{})
+	go func() {
+		defer close(ch)
+		defer func() {
+			if t.Failed() {
+				r.Interrupt("failed test")
+				close(release)
+			}
+		}()
+		defer debugger.Detach()
+		if reason := debugger.Continue(); reason != DebuggerStatementActivation {
+			t.Errorf("wrong activation %s", reason)
+			return
+		}
+		if op := debugger.PendingOperation(); op != OpNone {
+			t.Errorf("wrong operation while paused: %s", op)
+		}
+		for _, tc := range []struct {
+			op  OpKind
+			cmd func()
+		}{
+			{OpStep, func() {
+				if err := debugger.Next(); err != nil {
+					t.Error(err)
+				}
+			}},
+			{OpContinue, func() {
+				if reason := debugger.Continue(); reason != DebuggerStatementActivation {
+					t.Errorf("wrong activation %s", reason)
+				}
+			}},
+		} {
+			finished := make(chan struct{})
+			go func() {
+				defer close(finished)
+				tc.cmd()
+			}()
+			deadline := time.Now().Add(5 * time.Second)
+			for debugger.PendingOperation() != tc.op {
+				if time.Now().After(deadline) {
+					t.Errorf("%s isn't reported as pending", tc.op)
+					return
+				}
+				time.Sleep(time.Millisecond)
+			}
+			release <- struct{}{}
+			<-finished
+			if op := debugger.PendingOperation(); op != OpNone {
+				t.Errorf("wrong operation after %s: %s", tc.op, op)
+			}
+		}
+		if reason := debugger.Continue(); reason != ProgramEndActivation {
+			t.Errorf("wrong activation %s", reason)
+		}
+	}()
+	testScript1WithRuntime(SCRIPT, _undefined, t, r)
+	<-ch // wait for the debugger
+}
+
+func TestDebuggerPrintNumbers(t *testing.T) {
+	const SCRIPT = `var int = 42, frac = 1.5, negZero = -0, nan = NaN, inf = Infinity, negInf = -Infinity;
+	var big = 2 ** 64, huge = 1e21, tiny = 1e-7, integralFloat = 3.0;
+	var arr = new Float64Array([-0, 0.5, 2]);
+	var o = {z: -0};
+	debugger;
+	0;
+	`
+	r := &Runtime{}
+	r.init()
+	debugger := r.AttachDebugger()
+
+	ch := make(chan struct{})
+	go func() {
+		defer close(ch)
+		defer func() {
+			if t.Failed() {
+				r.Interrupt("failed test")
+			}
+		}()
+		defer debugger.Detach()
+		if reason := debugger.Continue(); reason != DebuggerStatementActivation {
+			t.Errorf("wrong activation %s", reason)
+			return
+		}
+		for name, expected := range map[string]string{
+			"int":           "42",
+			"frac":          "1.5",
+			"negZero":       "-0",
+			"nan":           "NaN",
+			"inf":           "Infinity",
+			"negInf":        "-Infinity",
+			"big":           "18446744073709552000",
+			"huge":          "1e+21",
+			"tiny":          "1e-7",
+			"integralFloat": "3",
+			"arr":           "Float64Array(3)[-0,0.5,2]",
+			"o":             "{z: -0}",
+		} {
+			if str, err := debugger.Print(name); err != nil {
+				t.Errorf("error while executing %s", err)
+			} else if str != expected {
+				t.Errorf("expected %s to be printed as %s, got %s", name, expected, str)
+			}
+		}
+	}()
+	testScript1WithRuntime(SCRIPT, intToValue(0), t, r)
+	<-ch // wait for the debugger
+}
+
+func TestDebuggerWatchArrayLength(t *testing.T) {
+	const SCRIPT = `var arr = [1];
+	debugger;
+	var other = arr;
+	other.push(2);
+	arr = [];
+	function clear(a) {
+		a.length = 0;
+		return a;
+	}
+	clear(other);
+	arr.push(3);
+	other.length;
+	`
+	r := &Runtime{}
+	r.init()
+	debugger := r.AttachDebugger()
+
+	ch := make(chan struct{})
+	go func() {
+		defer close(ch)
+		defer func() {
+			if t.Failed() {
+				r.Interrupt("failed test")
+			}
+		}()
+		defer debugger.Detach()
+		if reason := debugger.Continue(); reason != DebuggerStatementActivation {
+			t.Errorf("wrong activation %s", reason)
+			return
+		}
+		if err := debugger.WatchArrayLength("({})"); err == nil {
+			t.Error("expected an error for an object which isn't an array")
+		}
+		if err := debugger.WatchArrayLength("arr"); err != nil {
+			t.Error(err)
+			return
+		}
+		for _, want := range []struct {
+			line     int
+			old, new int64
+		}{{5, 1, 2}, {8, 2, 0}} {
+			if reason := debugger.Continue(); reason != ArrayLengthActivation {
+				t.Errorf("wrong activation %s", reason)
+				return
+			}
+			if line := debugger.Line(); line != want.line {
+				t.Errorf("wrong line %d, expected %d", line, want.line)
+			}
+			if c, ok := debugger.LengthChange(); !ok || c.Expr != "arr" || c.Old != want.old || c.New != want.new {
+				t.Errorf("wrong change %+v", c)
+			}
+		}
+		if _, err := debugger.Exec("a.push(1)"); err != nil {
+			t.Error(err)
+		}
+		if reason := debugger.Continue(); reason != ProgramEndActivation {
+			t.Errorf("wrong activation %s", reason)
+		}
+	}()
+	testScript1WithRuntime(SCRIPT, intToValue(1), t, r)
+	<-ch // wait for the debugger
+}
+
+func TestDebuggerRunCollectingPauses(t *testing.T) {
+	const SCRIPT = `var x = 1;
+	function f(y) {
+		x += y;
+		return x;
+	}
+	f(2);
+	debugger;
+	x;
+	`
+	r := &Runtime{}
+	r.init()
+	debugger := r.AttachDebugger()
+	for _, line := range []int{1, 4} {
+		if _, err := debugger.SetBreakpoint("test.js", line); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ch := make(chan struct{})
+	var states []DebugState
+	go func() {
+		defer close(ch)
+		defer debugger.Detach()
+		states = debugger.RunCollectingPauses()
+	}()
+	testScript1WithRuntime(SCRIPT, intToValue(3), t, r)
+	<-ch // wait for the debugger
+
+	if len(states) != 3 {
+		t.Fatalf("wrong number of pauses: %+v", states)
+	}
+	for i, want := range []struct {
+		reason ActivationReason
+		line   int
+		depth  int
+		x      string
+	}{
+		{BreakpointActivation, 1, 1, "<nil>"}, // the globals aren't declared yet
+		{BreakpointActivation, 4, 2, "3"},
+		{DebuggerStatementActivation, 8, 1, "3"},
+	} {
+		state := states[i]
+		if state.Reason != want.reason || state.Filename != "test.js" || state.Line != want.line || len(state.Stack) != want.depth {
+			t.Errorf("wrong state %d: %s %s:%d, %d frames", i, state.Reason, state.Filename, state.Line, len(state.Stack))
+		}
+		if x := fmt.Sprint(state.Scope["x"]); x != want.x {
+			t.Errorf("wrong value of x at pause %d: %v", i, x)
+		}
+	}
+	if y := states[1].Scope["y"]; y == nil || !y.SameAs(intToValue(2)) {
+		t.Errorf("wrong value of y: %v", y)
+	}
+}
+
+func TestDebuggerExecCommandAssigned(t *testing.T) {
+	const SCRIPT = `var x = 1, y = 2, z = 3, o = {a: 1};
+	function f() {
+		var local = 10;
+		debugger;
+		return local;
+	}
+	f();
+	`
+	r := &Runtime{}
+	r.init()
+	debugger := r.AttachDebugger()
+
+	ch := make(chan struct{})
+	go func() {
+		defer close(ch)
+		defer func() {
+			if t.Failed() {
+				r.Interrupt("failed test")
+			}
+		}()
+		defer debugger.Detach()
+		if reason := debugger.Continue(); reason != DebuggerStatementActivation {
+			t.Errorf("wrong activation %s", reason)
+			return
+		}
+		res := debugger.ExecCommand("x = x + 1; y++; local *= 2; [z, {a: o.b}] = [5, {a: 6}]; (function() { var inner = 1; })(); let tmp = 1; x")
+		if res.Err != nil || !res.Value.SameAs(intToValue(2)) {
+			t.Errorf("wrong result %v", res)
+			return
+		}
+		expected := map[string]int64{"x": 2, "y": 3, "local": 20, "z": 5}
+		if len(res.Assigned) != len(expected) {
+			t.Errorf("wrong assigned variables %v", res.Assigned)
+		}
+		for name, v := range expected {
+			if got := res.Assigned[name]; got == nil || !got.SameAs(intToValue(v)) {
+				t.Errorf("wrong value of %s: %v", name, got)
+			}
+		}
+		if res := debugger.ExecCommand("x + 1"); res.Err != nil || res.Assigned != nil {
+			t.Errorf("unexpected assigned variables %v", res)
+		}
+		if results := debugger.RunScript([]string{"e local = 1"}); results[0].Assigned["local"] == nil {
+			t.Errorf("the exec command doesn't report assigned variables: %v", results[0].Assigned)
+		}
+		if reason := debugger.Continue(); reason != ProgramEndActivation {
+			t.Errorf("wrong activation %s", reason)
+		}
+	}()
+	testScript1WithRuntime(SCRIPT, intToValue(1), t, r)
+	<-ch // wait for the debugger
+}
+
+func TestDebuggerPrintPromise(t *testing.T) {
+	const SCRIPT = `var pending = new Promise(function() {});
+	var fulfilled = Promise.resolve({a: 1});
+	var rejected = Promise.reject(new Error("boom"));
+	rejected.catch(function() {});
+	var chained = Promise.resolve(fulfilled);
+	debugger;
+	0;
+	`
+	r := &Runtime{}
+	r.init()
+	debugger := r.AttachDebugger()
+
+	ch := make(chan struct{})
+	go func() {
+		defer close(ch)
+		defer func() {
+			if t.Failed() {
+				r.Interrupt("failed test")
+			}
+		}()
+		defer debugger.Detach()
+		if reason := debugger.Continue(); reason != DebuggerStatementActivation {
+			t.Errorf("wrong activation %s", reason)
+			return
+		}
+		for name, expected := range map[string]string{
+			"pending":   "Promise {<pending>}",
+			"fulfilled": "Promise {<fulfilled>: {a: 1}}",
+			"rejected":  "Promise {<rejected>: Error: boom}",
+			"chained":   "Promise {<fulfilled>: {a: 1}}",
+		} {
+			if str, err := debugger.Print(name); err != nil {
+				t.Errorf("error while executing %s", err)
+			} else if str != expected {
+				t.Errorf("expected %s to be printed as %s, got %s", name, expected, str)
+			}
+		}
+	}()
+	testScript1WithRuntime(SCRIPT, intToValue(0), t, r)
+	<-ch // wait for the debugger
+}
+
+func TestDebuggerDefinitionOf(t *testing.T) {
+	const SCRIPT = `var x = 1;
+	function f(a) {
+		var local = a;
+		{
+			let x = 2;
+		}
+		if (local) {
+			let x = 3;
+			debugger;
+			local += x;
+		}
+		return local;
+	}
+	f(1);
+	`
+	r := &Runtime{}
+	r.init()
+	debugger := r.AttachDebugger()
+
+	ch := make(chan struct{})
+	go func() {
+		defer close(ch)
+		defer func() {
+			if t.Failed() {
+				r.Interrupt("failed test")
+			}
+		}()
+		defer debugger.Detach()
+		if reason := debugger.Continue(); reason != DebuggerStatementActivation {
+			t.Errorf("wrong activation %s", reason)
+			return
+		}
+		for name, expected := range map[string]int{"local": 3, "a": 2, "x": 8, "f": 2} {
+			if filename, line, ok := debugger.DefinitionOf(name); !ok || filename != "test.js" || line != expected {
+				t.Errorf("wrong definition of %s: %s:%d, %t", name, filename, line, ok)
+			}
+		}
+		for _, name := range []string{"Math", "missing"} {
+			if _, _, ok := debugger.DefinitionOf(name); ok {
+				t.Errorf("unexpected definition of %s", name)
+			}
+		}
+		if reason := debugger.Continue(); reason != ProgramEndActivation {
+			t.Errorf("wrong activation %s", reason)
+		}
+	}()
+	testScript1WithRuntime(SCRIPT, intToValue(4), t, r)
+	<-ch // wait for the debugger
+}
+
+func TestDebuggerSelectVM(t *testing.T) {
+	const SCRIPT = `var x = 1;
+	x += 1;
+	x;
+	`
+	const WORKER = `var y = 10;
+	y *= 2;
+	y += 1;
+	y;
+	`
+	r := &Runtime{}
+	r.init()
+	debugger := r.AttachDebugger()
+	worker := New()
+	id, err := debugger.AddVM(worker)
+	if err != nil || id != 1 {
+		t.Fatalf("wrong ID %d, %v", id, err)
+	}
+	if _, err := debugger.AddVM(worker); err == nil {
+		t.Fatal("the same runtime could be added twice")
+	}
+	if err := debugger.SelectVM(2); err == nil {
+		t.Fatal("a VM which wasn't added could be selected")
+	}
+
+	if _, err := debugger.SetBreakpoint("test.js", 2); err != nil {
+		t.Fatal(err)
+	}
+	if err := debugger.SelectVM(1); err != nil || debugger.SelectedVM() != 1 {
+		t.Fatalf("couldn't select the worker: %v", err)
+	}
+	if _, err := debugger.SetBreakpoint("worker.js", 3); err != nil {
+		t.Fatal(err)
+	}
+
+	workerDone := make(chan struct{})
+	go func() {
+		defer close(workerDone)
+		if v, err := worker.RunScript("worker.js", WORKER); err != nil || !v.SameAs(intToValue(21)) {
+			t.Errorf("wrong result of the worker %v, %v", v, err)
+		}
+	}()
+	ch := make(chan struct{})
+	go func() {
+		defer close(ch)
+		defer func() {
+			if t.Failed() {
+				r.Interrupt("failed test")
+				worker.Interrupt("failed test")
+			}
+		}()
+		if reason := debugger.Continue(); reason != BreakpointActivation || debugger.Filename() != "worker.js" || debugger.Line() != 3 {
+			t.Errorf("wrong activation %s at %s:%d", reason, debugger.Filename(), debugger.Line())
+			return
+		}
+		if v, err := debugger.Exec("y"); err != nil || !v.SameAs(intToValue(20)) {
+			t.Errorf("wrong value of y %v, %v", v, err)
+		}
+
+		// the worker stays paused while the main runtime is debugged
+		if err := debugger.SelectVM(0); err != nil {
+			t.Error(err)
+			return
+		}
+		if reason := debugger.Continue(); reason != BreakpointActivation || debugger.Filename() != "test.js" || debugger.Line() != 2 {
+			t.Errorf("wrong activation %s at %s:%d", reason, debugger.Filename(), debugger.Line())
+			return
+		}
+		if v, err := debugger.Exec("x"); err != nil || !v.SameAs(intToValue(1)) {
+			t.Errorf("wrong value of x %v, %v", v, err)
+		}
+		if _, err := debugger.Exec("y"); err == nil {
+			t.Error("the worker's variables are visible in the main runtime")
+		}
+		if reason := debugger.Continue(); reason != ProgramEndActivation {
+			t.Errorf("wrong activation %s", reason)
+		}
+
+		if err := debugger.SelectVM(1); err != nil {
+			t.Error(err)
+			return
+		}
+		if reason := debugger.Continue(); reason != ProgramEndActivation {
+			t.Errorf("wrong activation %s", reason)
+		}
+		debugger.Detach()
+	}()
+	testScript1WithRuntime(SCRIPT, intToValue(2), t, r)
+	<-ch // wait for the debugger
+	<-workerDone
+}
+
+func TestDebuggerLineBase(t *testing.T) {
+	const SCRIPT = `var x = 1;
+	x++;
+	x++;
+	x;
+	`
+	r := &Runtime{}
+	r.init()
+	debugger := r.AttachDebugger()
+	for _, base := range []int{-1, 2} {
+		if err := debugger.SetLineBase(base); err == nil {
+			t.Fatalf("line base %d was accepted", base)
+		}
+	}
+	if _, err := debugger.SetBreakpoint("test.js", 0); err == nil {
+		t.Fatal("a breakpoint was set on line 0 with 1-based lines")
+	}
+	if err := debugger.SetLineBase(0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := debugger.SetConditionalBreakpoint("test.js", -1, "true"); err == nil {
+		t.Fatal("a breakpoint was set on line -1 with 0-based lines")
+	}
+	if _, err := debugger.SetBreakpoint("test.js", 2); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := debugger.SetBreakpoint("test.js", 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := debugger.ClearBreakpoint("test.js", 1); err != nil {
+		t.Fatal(err)
+	}
+	if lines, err := debugger.Breakpoints(); err != nil || !reflect.DeepEqual(lines["test.js"], []int{3}) {
+		t.Fatalf("wrong breakpoints %v, %v", lines, err)
+	}
+
+	ch := make(chan struct{})
+	go func() {
+		defer close(ch)
+		defer func() {
+			if t.Failed() {
+				r.Interrupt("failed test")
+			}
+		}()
+		defer debugger.Detach()
+		if reason := debugger.Continue(); reason != BreakpointActivation || debugger.Line() != 3 {
+			t.Errorf("wrong activation %s on line %d", reason, debugger.Line())
+			return
+		}
+		if reason := debugger.Continue(); reason != ProgramEndActivation {
+			t.Errorf("wrong activation %s", reason)
+		}
+	}()
+	testScript1WithRuntime(SCRIPT, intToValue(3), t, r)
+	<-ch // wait for the debugger
+}
+
+func TestDebuggerLastExpressionValue(t *testing.T) {
+	const SCRIPT = `function foo() {
+		return "foo";
+	}
+	function f() {
+		2 + 3;
+		foo();
+		var x = 1;
+		return x;
+	}
+	f();
+	`
+	r := &Runtime{}
+	r.init()
+	debugger := r.AttachDebugger()
+	if _, err := debugger.SetBreakpoint("test.js", 5); err != nil {
+		t.Fatal(err)
+	}
+
+	ch := make(chan struct{})
+	go func() {
+		defer close(ch)
+		defer func() {
+			if t.Failed() {
+				r.Interrupt("failed test")
+			}
+		}()
+		defer debugger.Detach()
+		if reason := debugger.Continue(); reason != BreakpointActivation {
+			t.Errorf("wrong activation %s", reason)
+			return
+		}
+		if v, ok := debugger.LastExpressionValue(); ok {
+			t.Errorf("unexpected value %v", v)
+		}
+		for _, expected := range []Value{intToValue(5), asciiString("foo")} {
+			if err := debugger.Next(); err != nil {
+				t.Error(err)
+				return
+			}
+			if v, ok := debugger.LastExpressionValue(); !ok || !v.SameAs(expected) {
+				t.Errorf("wrong value %v, %t on line %d, expected %v", v, ok, debugger.Line(), expected)
+			}
+		}
+		// the declaration isn't an expression statement
+		if err := debugger.Next(); err != nil {
+			t.Error(err)
+			return
+		}
+		if v, ok := debugger.LastExpressionValue(); ok {
+			t.Errorf("unexpected value %v", v)
+		}
+		if reason := debugger.Continue(); reason != ProgramEndActivation {
+			t.Errorf("wrong activation %s", reason)
+		}
+	}()
+	testScript1WithRuntime(SCRIPT, intToValue(1), t, r)
+	<-ch // wait for the debugger
+}
+
+func TestDebuggerPrintProxy(t *testing.T) {
+	const SCRIPT = `var plain = new Proxy({a: 1}, {});
+	var recursive = new Proxy({a: 1}, {
+		get: function(target, key) {
+			return recursive[key];
+		}
+	});
+	var throwing = new Proxy({a: 1}, {
+		get: function() {
+			throw new Error("boom");
+		}
+	});
+	var o = {p: recursive};
+	debugger;
+	0;
+	`
+	r := &Runtime{}
+	r.init()
+	debugger := r.AttachDebugger()
+
+	ch := make(chan struct{})
+	go func() {
+		defer close(ch)
+		defer func() {
+			if t.Failed() {
+				r.Interrupt("failed test")
+			}
+		}()
+		defer debugger.Detach()
+		if reason := debugger.Continue(); reason != DebuggerStatementActivation {
+			t.Errorf("wrong activation %s", reason)
+			return
+		}
+		for name, expected := range map[string]string{
+			"plain":     "Proxy {a: 1}",
+			"recursive": "[Proxy]",
+			"throwing":  "Proxy {a: <error: boom>}",
+			"o":         "{p: [Proxy]}",
+		} {
+			if str, err := debugger.Print(name); err != nil {
+				t.Errorf("error while executing %s", err)
+			} else if str != expected {
+				t.Errorf("expected %s to be printed as %s, got %s", name, expected, str)
+			}
+		}
+		// the bounds are lifted afterwards
+		if v, err := debugger.Exec("(function f(n) { return n && f(n - 1) + 1; })(1000)"); err != nil || !v.SameAs(intToValue(1000)) {
+			t.Errorf("wrong result %v, %v", v, err)
+		}
+		if reason := debugger.Continue(); reason != ProgramEndActivation {
+			t.Errorf("wrong activation %s", reason)
+		}
+	}()
+	testScript1WithRuntime(SCRIPT, intToValue(0), t, r)
+	<-ch // wait for the debugger
+}
+
+func TestDebuggerCallInfo(t *testing.T) {
+	const SCRIPT = `function f(a, b = 2, {c} = {}) {
+		debugger;
+		return a + b;
+	}
+	var g = (x, ...rest) => {
+		debugger;
+		return x;
+	};
+	f(1);
+	g(1, 2, 3);
+	debugger;
+	0;
+	`
+	r := &Runtime{}
+	r.init()
+	debugger := r.AttachDebugger()
+
+	ch := make(chan struct{})
+	go func() {
+		defer close(ch)
+		defer func() {
+			if t.Failed() {
+				r.Interrupt("failed test")
+			}
+		}()
+		defer debugger.Detach()
+		for _, expected := range []CallInfo{
+			{Args: 1, Params: 3, Defaulted: []string{"b", "{c}"}},
+			{Args: 3, Params: 1, Rest: true},
+			{},
+		} {
+			if reason := debugger.Continue(); reason != DebuggerStatementActivation {
+				t.Errorf("wrong activation %s", reason)
+				return
+			}
+			if info := debugger.CallInfo(); !reflect.DeepEqual(info, expected) {
+				t.Errorf("wrong call info %+v, expected %+v", info, expected)
+			}
+		}
+		if reason := debugger.Continue(); reason != ProgramEndActivation {
+			t.Errorf("wrong activation %s", reason)
+		}
+	}()
+	testScript1WithRuntime(SCRIPT, intToValue(0), t, r)
+	<-ch // wait for the debugger
+}
+
+func TestDebuggerLogExceptions(t *testing.T) {
+	const SCRIPT = `function f() {
+		try {
+			throw new Error("swallowed");
+		} catch (e) {
+		}
+		try {
+			null.x;
+		} catch (e) {
+		}
+		return 1;
+	}
+	f();
+	`
+	r := New()
+	debugger := r.AttachDebugger()
+	defer debugger.Detach()
+	debugger.LogExceptions(true)
+	if _, err := r.RunScript("test.js", SCRIPT); err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []Event{
+		{Kind: ExceptionEvent, Filename: "test.js", Line: 3, Message: "swallowed"},
+		{Kind: ExceptionEvent, Filename: "test.js", Line: 7, Message: "Cannot read property 'x' of undefined"},
+	} {
+		select {
+		case ev := <-debugger.Events():
+			if ev != expected {
+				t.Errorf("wrong event %+v, expected %+v", ev, expected)
+			}
+		default:
+			t.Fatal("no exception event")
+		}
+	}
+
+	debugger.LogExceptions(false)
+	if _, err := r.RunScript("test.js", SCRIPT); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case ev := <-debugger.Events():
+		t.Errorf("unexpected event %+v", ev)
+	default:
+	}
+}
+
+func TestDebuggerExportBreakpoints(t *testing.T) {
+	const SCRIPT = `var x = 1;
+	x++;
+	x++;
+	x;
+	`
+	exporter := New().AttachDebugger()
+	if _, err := exporter.SetBreakpoint("test.js", 2); err != nil {
+		t.Fatal(err)
+	}
+	if err := exporter.SetBreakpointEnabled("test.js", 2, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := exporter.SetConditionalBreakpoint("test.js", 3, "x == 2"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := exporter.SetConditionalBreakpoint("test.js", 4, "x == 0"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := exporter.SetBreakpoint("other.js", 7); err != nil {
+		t.Fatal(err)
+	}
+	if err := exporter.SetBreakpointOncePerCall("other.js", 7, true); err != nil {
+		t.Fatal(err)
+	}
+	exporter.SetFunctionBreakpointAfter("f", 2)
+	data, err := exporter.ExportBreakpoints()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := &Runtime{}
+	r.init()
+	debugger := r.AttachDebugger()
+	if _, err := debugger.SetBreakpoint("test.js", 1); err != nil {
+		t.Fatal(err)
+	}
+	for _, invalid := range []string{
+		`{"breakpoints": [{"id": 1, "filename": "test.js", "line": 1}, {"id": 1, "filename": "test.js", "line": 2}]}`,
+		`{"breakpoints": [{"id": 1, "filename": "test.js", "line": 1, "condition": "x ==="}]}`,
+		`[]`,
+	} {
+		if err := debugger.ImportBreakpoints([]byte(invalid)); err == nil {
+			t.Errorf("%s was imported", invalid)
+		}
+	}
+	if err := debugger.ImportBreakpoints(data); err != nil {
+		t.Fatal(err)
+	}
+	if reexported, err := debugger.ExportBreakpoints(); err != nil || string(reexported) != string(data) {
+		t.Fatalf("the breakpoints changed in the round trip:\n%s\n%s, %v", data, reexported, err)
+	}
+	if id, err := debugger.SetBreakpoint("other.js", 9); err != nil || id != 5 {
+		t.Errorf("wrong ID of a new breakpoint %d, %v", id, err)
+	}
+
+	ch := make(chan struct{})
+	go func() {
+		defer close(ch)
+		defer func() {
+			if t.Failed() {
+				r.Interrupt("failed test")
+			}
+		}()
+		defer debugger.Detach()
+		if reason := debugger.Continue(); reason != BreakpointActivation || debugger.Line() != 3 {
+			t.Errorf("wrong activation %s on line %d", reason, debugger.Line())
+			return
+		}
+		if bp, _ := debugger.ActiveBreakpoint(); bp.ID != 2 {
+			t.Errorf("wrong breakpoint %+v", bp)
+		}
+		if reason := debugger.Continue(); reason != ProgramEndActivation {
+			t.Errorf("wrong activation %s", reason)
+		}
+	}()
+	testScript1WithRuntime(SCRIPT, intToValue(3), t, r)
+	<-ch // wait for the debugger
+}
+
+func TestDebuggerEvalInAllFrames(t *testing.T) {
+	const SCRIPT = `var x = "global";
+	function inner() {
+		var x = "inner";
+		debugger;
+		return x;
+	}
+	function middle() {
+		var y = 1;
+		return [0].map(function() {
+			var x = "callback";
+			return inner();
+		})[0];
+	}
+	function outer() {
+		var x = "outer";
+		return middle();
+	}
+	outer();
+	`
+	r := &Runtime{}
+	r.init()
+	debugger := r.AttachDebugger()
+
+	ch := make(chan struct{})
+	go func() {
+		defer close(ch)
+		defer func() {
+			if t.Failed() {
+				r.Interrupt("failed test")
+			}
+		}()
+		defer debugger.Detach()
+		if reason := debugger.Continue(); reason != DebuggerStatementActivation {
+			t.Errorf("wrong activation %s", reason)
+			return
+		}
+		results := debugger.EvalInAllFrames("x")
+		expected := []struct {
+			funcName string
+			value    string // empty for an error
+		}{
+			{"inner", "inner"},
+			{"", "callback"},
+			{"map", ""},
+			{"middle", "global"},
+			{"outer", "outer"},
+			{"", "global"},
+		}
+		if len(results) != len(expected) {
+			t.Errorf("wrong number of frames %d: %+v", len(results), results)
+			return
+		}
+		for i, e := range expected {
+			res := results[i]
+			if name := res.Frame.FuncName(); name != e.funcName && !(e.funcName == "" && name == "<anonymous>") {
+				t.Errorf("frame %d: wrong function %s", i, name)
+			}
+			if e.value == "" {
+				if res.Err == nil {
+					t.Errorf("frame %d: no error", i)
+				}
+			} else if res.Err != nil || res.Value.String() != e.value {
+				t.Errorf("frame %d: wrong result %v, %v", i, res.Value, res.Err)
+			}
+		}
+		if results := debugger.EvalInAllFrames("y"); results[3].Err != nil || !results[3].Value.SameAs(intToValue(1)) || results[0].Err == nil {
+			t.Errorf("wrong results %+v", results)
+		}
+		// the current frame is the same
+		if v, err := debugger.Exec("x"); err != nil || v.String() != "inner" {
+			t.Errorf("wrong value %v, %v", v, err)
+		}
+		if reason := debugger.Continue(); reason != ProgramEndActivation {
+			t.Errorf("wrong activation %s", reason)
+		}
+	}()
+	testScript1WithRuntime(SCRIPT, asciiString("inner"), t, r)
+	<-ch // wait for the debugger
+}
+
+func TestDebuggerConditionLimit(t *testing.T) {
+	const SCRIPT = `var x = 1;
+	x++;
+	x++;
+	x++;
+	x;
+	`
+	r := &Runtime{}
+	r.init()
+	debugger := r.AttachDebugger()
+	debugger.SetConditionLimit(10000)
+	if _, err := debugger.SetConditionalBreakpoint("test.js", 2, "(function() { while (true) {} })()"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := debugger.SetConditionalBreakpoint("test.js", 3, "[0].forEach(function() { while (true) {} })"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := debugger.SetConditionalBreakpoint("test.js", 4, "x == 3"); err != nil {
+		t.Fatal(err)
+	}
+
+	ch := make(chan struct{})
+	go func() {
+		defer close(ch)
+		defer func() {
+			if t.Failed() {
+				r.Interrupt("failed test")
+			}
+		}()
+		defer debugger.Detach()
+		if reason := debugger.Continue(); reason != BreakpointActivation || debugger.Line() != 4 {
+			t.Errorf("wrong activation %s on line %d", reason, debugger.Line())
+			return
+		}
+		if err := debugger.LastConditionError(); !errors.Is(err, ErrConditionLimit) || !strings.Contains(err.Error(), "test.js:3") {
+			t.Errorf("wrong condition error %v", err)
+		}
+		// the budget doesn't apply to anything else
+		if v, err := debugger.Exec("var n = 0; for (var i = 0; i < 100000; i++) { n++; } n"); err != nil || !v.SameAs(intToValue(100000)) {
+			t.Errorf("wrong result %v, %v", v, err)
+		}
+		if reason := debugger.Continue(); reason != ProgramEndActivation {
+			t.Errorf("wrong activation %s", reason)
+		}
+	}()
+	testScript1WithRuntime(SCRIPT, intToValue(4), t, r)
+	<-ch // wait for the debugger
+}
+
+func TestDebuggerPrintWeakCollections(t *testing.T) {
+	const SCRIPT = `var key = {};
+	var wm = new WeakMap([[key, 1]]);
+	var ws = new WeakSet([key]);
+	var o = {wm: wm};
+	debugger;
+	0;
+	`
+	r := &Runtime{}
+	r.init()
+	debugger := r.AttachDebugger()
+
+	ch := make(chan struct{})
+	go func() {
+		defer close(ch)
+		defer func() {
+			if t.Failed() {
+				r.Interrupt("failed test")
+			}
+		}()
+		defer debugger.Detach()
+		if reason := debugger.Continue(); reason != DebuggerStatementActivation {
+			t.Errorf("wrong activation %s", reason)
+			return
+		}
+		for name, expected := range map[string]string{
+			"wm": "[WeakMap]",
+			"ws": "[WeakSet]",
+			"o":  "{wm: [WeakMap]}",
+		} {
+			if str, err := debugger.Print(name); err != nil {
+				t.Errorf("error while executing %s", err)
+			} else if str != expected {
+				t.Errorf("expected %s to be printed as %s, got %s", name, expected, str)
+			}
+		}
+	}()
+	testScript1WithRuntime(SCRIPT, intToValue(0), t, r)
+	<-ch // wait for the debugger
+}
+
+func TestDebuggerNextToDebuggerStatement(t *testing.T) {
+	const SCRIPT = `var x = 1;
+	debugger;
+	x++;
+	x;
+	`
+	r := &Runtime{}
+	r.init()
+	debugger := r.AttachDebugger()
+	if _, err := debugger.SetBreakpoint("test.js", 1); err != nil {
+		t.Fatal(err)
+	}
+
+	ch := make(chan struct{})
+	go func() {
+		defer close(ch)
+		defer func() {
+			if t.Failed() {
+				r.Interrupt("failed test")
+			}
+		}()
+		defer debugger.Detach()
+		if reason := debugger.Continue(); reason != BreakpointActivation || debugger.Reason() != BreakpointActivation {
+			t.Errorf("wrong activation %s", reason)
+			return
+		}
+		if err := debugger.Next(); err != nil {
+			t.Error(err)
+			return
+		}
+		if reason := debugger.Reason(); reason != DebuggerStatementActivation {
+			t.Errorf("wrong activation %s on line %d", reason, debugger.Line())
+		}
+		if err := debugger.Next(); err != nil {
+			t.Error(err)
+			return
+		}
+		if reason := debugger.Reason(); reason != StepActivation || debugger.Line() != 4 {
+			t.Errorf("wrong activation %s on line %d", reason, debugger.Line())
+		}
+		if reason := debugger.Continue(); reason != ProgramEndActivation {
+			t.Errorf("wrong activation %s", reason)
+		}
+	}()
+	testScript1WithRuntime(SCRIPT, intToValue(2), t, r)
+	<-ch // wait for the debugger
+}
+
+func TestDebuggerCurrentStatementSpan(t *testing.T) {
+	const SCRIPT = `var a = 1; debugger; var b = 2, c = 3;
+	function f(x) {
+		if (x) { debugger; x.y = a + b; }
+		return x;
+	}
+	f({});
+	0;
+	`
+	r := &Runtime{}
+	r.init()
+	debugger := r.AttachDebugger()
+
+	ch := make(chan struct{})
+	go func() {
+		defer close(ch)
+		defer func() {
+			if t.Failed() {
+				r.Interrupt("failed test")
+			}
+		}()
+		defer debugger.Detach()
+		for _, expected := range []string{"var b = 2, c = 3", "x.y = a + b"} {
+			if reason := debugger.Continue(); reason != DebuggerStatementActivation {
+				t.Errorf("wrong activation %s", reason)
+				return
+			}
+			start, end := debugger.CurrentStatementSpan()
+			if start != strings.Index(SCRIPT, expected) || end != start+len(expected) {
+				t.Errorf("wrong span %d-%d, expected %q", start, end, expected)
+			}
+		}
+		if len(debugger.fileASTs) != 1 {
+			t.Errorf("the source wasn't parsed once for all the pauses: %d ASTs", len(debugger.fileASTs))
+		}
+		if reason := debugger.Continue(); reason != ProgramEndActivation {
+			t.Errorf("wrong activation %s", reason)
+		}
+	}()
+	testScript1WithRuntime(SCRIPT, intToValue(0), t, r)
+	<-ch // wait for the debugger
+}
+
+func TestDebuggerOnFinish(t *testing.T) {
+	type finish struct {
+		result Value
+		err    error
+	}
+	run := func(script string) finish {
+		r := New()
+		debugger := r.AttachDebugger()
+		defer debugger.Detach()
+		finished := make(chan finish, 2)
+		debugger.OnFinish(func(result Value, err error) {
+			finished <- finish{result, err}
+		})
+		if _, err := debugger.SetBreakpoint("test.js", 1); err != nil {
+			t.Fatal(err)
+		}
+
+		ch := make(chan struct{})
+		go func() {
+			defer close(ch)
+			if reason := debugger.Continue(); reason != BreakpointActivation {
+				t.Errorf("wrong activation %s", reason)
+				return
+			}
+			if reason := debugger.Continue(); reason != ProgramEndActivation {
+				t.Errorf("wrong activation %s", reason)
+			}
+		}()
+		_, _ = r.RunScript("test.js", script)
+		<-ch // wait for the debugger
+		var got []finish
+		for len(finished) > 0 {
+			got = append(got, <-finished)
+		}
+		if len(got) != 1 {
+			t.Fatalf("callback called %d times", len(got))
+		}
+		return got[0]
+	}
+
+	f := run(`var x = 1;
+	x + 1;
+	`)
+	if f.err != nil || f.result == nil || !f.result.SameAs(intToValue(2)) {
+		t.Errorf("wrong finish %v, %v", f.result, f.err)
+	}
+
+	f = run(`var x = 1;
+	throw new Error("boom");
+	`)
+	if f.result != nil {
+		t.Errorf("unexpected result %v", f.result)
+	}
+	if ex, ok := f.err.(*Exception); !ok || ex.Value().String() != "Error: boom" {
+		t.Errorf("wrong error %v", f.err)
+	}
+}
+
+func TestDebuggerExecTable(t *testing.T) {
+	const SCRIPT = `
+	var data = [{a: 1, b: 2}, {a: 3}];
+	debugger;
+	0;
+	`
+	r := &Runtime{}
+	r.init()
+	debugger := r.AttachDebugger()
+
+	ch := make(chan struct{})
+	go func() {
+		defer close(ch)
+		defer func() {
+			if t.Failed() {
+				r.Interrupt("failed test")
+			}
+		}()
+		defer debugger.Detach()
+		if reason := debugger.Continue(); reason != DebuggerStatementActivation {
+			t.Errorf("wrong activation %s", reason)
+			return
+		}
+		for _, tc := range []struct {
+			expr     string
+			expected [][]string
+		}{
+			{"data", [][]string{{"(index)", "a", "b"}, {"0", "1", "2"}, {"1", "3", ""}}},
+			{"[{a: 1}, 2]", [][]string{{"(index)", "a", "Values"}, {"0", "1", ""}, {"1", "", "2"}}},
+			{"42", [][]string{{"Values"}, {"42"}}},
+		} {
+			table, err := debugger.ExecTable(tc.expr)
+			if err != nil {
+				t.Errorf("error while executing %s: %s", tc.expr, err)
+				continue
+			}
+			if !reflect.DeepEqual(table, tc.expected) {
+				t.Errorf("wrong table for %s: %q", tc.expr, table)
+			}
+		}
+		if _, err := debugger.ExecTable("[{get a() { throw new Error('boom'); }}]"); err == nil {
+			t.Error("expected an error from the throwing getter")
+		}
+	}()
+	testScript1WithRuntime(SCRIPT, intToValue(0), t, r)
+	<-ch // wait for the debugger
+}
+
+func TestDebuggerEvalCache(t *testing.T) {
+	const SCRIPT = `
+	var n = 0, x = 1;
+	function f(x) {
+		var g = () => {
+			debugger;
+		};
+		g();
+		debugger;
+	}
+	f(10);
+	debugger;
+	0;
+	`
+	r := &Runtime{}
+	r.init()
+	debugger := r.AttachDebugger()
+
+	uncached := func(expr string) (Value, error) {
+		in, err := parseEval(expr)
+		if err != nil {
+			return nil, err
+		}
+		p, err := debugger.compileEval(in, debugger.vm.prg.strict)
+		if err != nil {
+			return nil, err
+		}
+		return debugger.runEval(p)
+	}
+	exprs := []string{"x", "typeof this", "typeof arguments", "(function() { return x * 2; })()", "typeof new.target", "x +"}
+
+	ch := make(chan struct{})
+	go func() {
+		defer close(ch)
+		defer func() {
+			if t.Failed() {
+				r.Interrupt("failed test")
+			}
+		}()
+		defer debugger.Detach()
+		for i := 0; i < 3; i++ {
+			if reason := debugger.Continue(); reason != DebuggerStatementActivation {
+				t.Errorf("wrong activation %s", reason)
+				return
+			}
+			for _, expr := range exprs {
+				expected, expectedErr := uncached(expr)
+				for j := 0; j < 2; j++ { // compiled, then cached
+					v, err := debugger.Exec(expr)
+					if expectedErr != nil {
+						if err == nil || err.Error() != expectedErr.Error() {
+							t.Errorf("pause %d: wrong error for %s: %v, expected %v", i, expr, err, expectedErr)
+						}
+					} else if err != nil || !v.StrictEquals(expected) {
+						t.Errorf("pause %d: wrong value for %s: %v, %v, expected %v", i, expr, v, err, expected)
+					}
+				}
+			}
+			// the cached code still runs each time
+			for j := 0; j < 2; j++ {
+				if v, err := debugger.Exec("++n"); err != nil || v.ToInteger() != int64(2*i+j+1) {
+					t.Errorf("pause %d: wrong value for ++n: %v, %v", i, v, err)
+				}
+			}
+		}
+	}()
+	testScript1WithRuntime(SCRIPT, intToValue(0), t, r)
+	<-ch // wait for the debugger
+}
+
+func TestDebuggerFreeVariables(t *testing.T) {
+	const SCRIPT = `
+	var counter = 0;
+	function makeAdder(step) {
+		let unused = 1;
+		return function add(x) {
+			let local = x;
+			label: for (const i of [1]) {
+				if (i) break label;
+			}
+			const o = {step, total: counter};
+			counter += step + local + o.total + later;
+			debugger;
+			return add.length + arguments.length;
+		};
+	}
+	let later = 2;
+	makeAdder(1)(2);
+	debugger;
+	0;
+	`
+	r := &Runtime{}
+	r.init()
+	debugger := r.AttachDebugger()
+
+	ch := make(chan struct{})
+	go func() {
+		defer close(ch)
+		defer func() {
+			if t.Failed() {
+				r.Interrupt("failed test")
+			}
+		}()
+		defer debugger.Detach()
+		if reason := debugger.Continue(); reason != DebuggerStatementActivation {
+			t.Errorf("wrong activation %s", reason)
+			return
+		}
+		if names, expected := debugger.FreeVariables(), []string{"step", "counter", "later"}; !reflect.DeepEqual(names, expected) {
+			t.Errorf("wrong free variables %q, expected %q", names, expected)
+		}
+		if reason := debugger.Continue(); reason != DebuggerStatementActivation {
+			t.Errorf("wrong activation %s", reason)
+			return
+		}
+		if names := debugger.FreeVariables(); names != nil {
+			t.Errorf("free variables in global code: %q", names)
+		}
+	}()
+	testScript1WithRuntime(SCRIPT, intToValue(0), t, r)
+	<-ch // wait for the debugger
+}
+
+func TestDebuggerStepLine(t *testing.T) {
+	const SCRIPT = `function add(a, b) {
+		var sum = a + b;
+		return sum;
+	}
+	var x = add(1, 2);
+	x = add(x, 3);
+	x;
+	`
+	r := &Runtime{}
+	r.init()
+	debugger := r.AttachDebugger()
+	if _, err := debugger.SetBreakpoint("test.js", 5); err != nil {
+		t.Fatal(err)
+	}
+
+	ch := make(chan struct{})
+	go func() {
+		defer close(ch)
+		defer func() {
+			if t.Failed() {
+				r.Interrupt("failed test")
+			}
+		}()
+		defer debugger.Detach()
+		if reason := debugger.Continue(); reason != BreakpointActivation {
+			t.Errorf("wrong activation %s", reason)
+			return
+		}
+		for _, step := range []struct {
+			name  string
+			f     func() error
+			line  int
+			depth int
+		}{
+			{"StepLine", debugger.StepLine, 2, 1},
+			{"StepLine", debugger.StepLine, 3, 1},
+			{"StepLine", debugger.StepLine, 5, 0},
+			{"StepLine", debugger.StepLine, 6, 0},
+			{"Next", debugger.Next, 7, 0},
+		} {
+			if err := step.f(); err != nil {
+				t.Errorf("%s: %v", step.name, err)
+				return
+			}
+			if line, depth := debugger.Line(), debugger.callStackDepth(); line != step.line || depth != step.depth {
+				t.Errorf("%s stopped on line %d at depth %d, expected line %d at depth %d", step.name, line, depth, step.line, step.depth)
+			}
+		}
+		if reason := debugger.Continue(); reason != ProgramEndActivation {
+			t.Errorf("wrong activation %s", reason)
+		}
+	}()
+	testScript1WithRuntime(SCRIPT, intToValue(6), t, r)
+	<-ch // wait for the debugger
+}
+
+func TestDebuggerMicrotaskQueue(t *testing.T) {
+	const SCRIPT = `
+	var log = [];
+	var p = Promise.resolve(1);
+	var q = p.then(function first(v) { log.push("first " + v); });
+	p.then(v => { log.push("second " + v); });
+	debugger;
+	log.push("after");
+	log.join(", ");
+	`
+	r := &Runtime{}
+	r.init()
+	debugger := r.AttachDebugger()
+
+	ch := make(chan struct{})
+	go func() {
+		defer close(ch)
+		defer func() {
+			if t.Failed() {
+				r.Interrupt("failed test")
+			}
+		}()
+		defer debugger.Detach()
+		if reason := debugger.Continue(); reason != DebuggerStatementActivation {
+			t.Errorf("wrong activation %s", reason)
+			return
+		}
+		jobs := debugger.MicrotaskQueue()
+		if len(jobs) != 2 {
+			t.Errorf("wrong jobs %+v", jobs)
+			return
+		}
+		q, err := debugger.Exec("q")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if jobs[0].Kind != PromiseReactionJob || jobs[0].Function != "first" || jobs[0].Promise != q {
+			t.Errorf("wrong first job %+v", jobs[0])
+		}
+		if jobs[1].Kind != PromiseReactionJob || jobs[1].Function != "" || jobs[1].Promise == nil {
+			t.Errorf("wrong second job %+v", jobs[1])
+		}
+		if err := debugger.DrainMicrotasks(); err != nil {
+			t.Error(err)
+			return
+		}
+		if jobs := debugger.MicrotaskQueue(); len(jobs) != 0 {
+			t.Errorf("jobs left after draining: %+v", jobs)
+		}
+		if log, err := debugger.Exec("log.join(', ')"); err != nil || log.String() != "first 1, second 1" {
+			t.Errorf("wrong log after draining: %v, %v", log, err)
+		}
+	}()
+	// the jobs ran while the program was paused, not after it
+	testScript1WithRuntime(SCRIPT, asciiString("first 1, second 1, after"), t, r)
+	<-ch // wait for the debugger
+}
+
+func TestDebuggerMuteBreakpoints(t *testing.T) {
+	const SCRIPT = `function f() {
+		return 1;
+	}
+	var x = 0;
+	x++;
+	x += f();
+	debugger;
+	x++;
+	x += f();
+	x;
+	`
+	r := &Runtime{}
+	r.init()
+	debugger := r.AttachDebugger()
+	for _, line := range []int{5, 6, 9} {
+		if _, err := debugger.SetBreakpoint("test.js", line); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ch := make(chan struct{})
+	go func() {
+		defer close(ch)
+		defer func() {
+			if t.Failed() {
+				r.Interrupt("failed test")
+			}
+		}()
+		defer debugger.Detach()
+		if reason := debugger.Continue(); reason != BreakpointActivation || debugger.Line() != 5 {
+			t.Errorf("wrong activation %s on line %d", reason, debugger.Line())
+			return
+		}
+		debugger.SetFunctionBreakpoint("f")
+		debugger.MuteBreakpoints(true)
+		if !debugger.BreakpointsMuted() {
+			t.Error("breakpoints aren't muted")
+		}
+		if reason := debugger.Continue(); reason != DebuggerStatementActivation {
+			t.Errorf("wrong activation %s on line %d", reason, debugger.Line())
+			return
+		}
+		debugger.MuteBreakpoints(false)
+		if reason := debugger.Continue(); reason != BreakpointActivation || debugger.Line() != 9 {
+			t.Errorf("wrong activation %s on line %d", reason, debugger.Line())
+			return
+		}
+		if reason := debugger.Continue(); reason != FunctionBreakpointActivation {
+			t.Errorf("wrong activation %s on line %d", reason, debugger.Line())
+			return
+		}
+		if reason := debugger.Continue(); reason != ProgramEndActivation {
+			t.Errorf("wrong activation %s", reason)
+		}
+	}()
+	testScript1WithRuntime(SCRIPT, intToValue(4), t, r)
+	<-ch // wait for the debugger
+}
+
+func TestDebuggerDetachAddedVMs(t *testing.T) {
+	r := New()
+	debugger := r.AttachDebugger()
+	worker := New()
+	if _, err := debugger.AddVM(worker); err != nil {
+		t.Fatal(err)
+	}
+	debugger.Detach()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if v, err := worker.RunString("debugger; 1"); err != nil || !v.SameAs(intToValue(1)) {
+			t.Errorf("wrong result %v, %v", v, err)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		// nothing can resume it, so it's left blocked
+		t.Fatal("the added runtime is still debugged after Detach")
+	}
+	if worker.vm.debugger != nil || worker.vm.debugMode {
+		t.Error("the added runtime is still in debug mode")
+	}
+	// the runtime can be debugged again
+	if worker.AttachDebugger() == nil {
+		t.Error("couldn't attach a debugger to the added runtime")
+	}
+}
+
+func TestDebuggerBreakpointsAcrossPrograms(t *testing.T) {
+	r := New()
+	debugger := r.AttachDebugger()
+	defer debugger.Detach()
+	if _, err := debugger.SetBreakpoint("", 2); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := debugger.SetBreakpoint("", 5); err != nil {
+		t.Fatal(err)
+	}
+
+	// a shorter snippet run under the same name doesn't change them
+	if _, err := r.RunString("1;\n"); err != nil {
+		t.Fatal(err)
+	}
+	if unresolved := debugger.UnresolvedBreakpoints(); len(unresolved) != 2 {
+		t.Errorf("wrong unresolved breakpoints %v", unresolved)
+	}
+	breakpoints, err := debugger.Breakpoints()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := breakpoints[""]; !reflect.DeepEqual(lines, []int{2, 5}) {
+		t.Errorf("wrong breakpoints %v", lines)
+	}
+
+	ch := make(chan struct{})
+	go func() {
+		defer close(ch)
+		defer func() {
+			if t.Failed() {
+				r.Interrupt("failed test")
+			}
+		}()
+		for _, line := range []int{3, 5} {
+			if reason := debugger.Continue(); reason != BreakpointActivation || debugger.Line() != line {
+				t.Errorf("wrong activation %s on line %d, expected line %d", reason, debugger.Line(), line)
+				return
+			}
+		}
+		if reason := debugger.Continue(); reason != ProgramEndActivation {
+			t.Errorf("wrong activation %s", reason)
+		}
+	}()
+	// line 2 is empty, so its breakpoint pauses on line 3
+	v, err := r.RunString("var x = 1;\n\nx++;\nx++;\nx;\n")
+	<-ch // wait for the debugger
+	if err != nil || !v.SameAs(intToValue(3)) {
+		t.Errorf("wrong result %v, %v", v, err)
+	}
+	if unresolved := debugger.UnresolvedBreakpoints(); len(unresolved) != 0 {
+		t.Errorf("wrong unresolved breakpoints %v", unresolved)
+	}
+}
+
+func TestDebuggerUnresolvedBreakpointsReresolved(t *testing.T) {
+	const SCRIPT = `var x = 1;
+	x++;
+	x++;
+	x;
+	`
+	r := New()
+	debugger := r.AttachDebugger()
+	defer debugger.Detach()
+	id, err := debugger.SetBreakpoint("lib.js", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// another program with the same name, too short for the breakpoint
+	short, err := Compile("lib.js", "1;\n", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stale := debugger.Rebind(short); len(stale) != 1 || stale[0].ID != id {
+		t.Fatalf("wrong stale breakpoints %v", stale)
+	}
+	// running it doesn't restore the breakpoint
+	if _, err := r.RunScript("lib.js", "1;\n"); err != nil {
+		t.Fatal(err)
+	}
+	if unresolved := debugger.UnresolvedBreakpoints(); len(unresolved) != 1 || unresolved[0].ID != id {
+		t.Fatalf("wrong unresolved breakpoints %v", unresolved)
+	}
+	for len(debugger.Events()) > 0 {
+		<-debugger.Events()
+	}
+
+	ch := make(chan struct{})
+	go func() {
+		defer close(ch)
+		defer func() {
+			if t.Failed() {
+				r.Interrupt("failed test")
+			}
+		}()
+		if reason := debugger.Continue(); reason != BreakpointActivation || debugger.Line() != 3 {
+			t.Errorf("wrong activation %s on line %d", reason, debugger.Line())
+			return
+		}
+		if bp, ok := debugger.ActiveBreakpoint(); !ok || bp.ID != id || !bp.Verified {
+			t.Errorf("wrong breakpoint %+v", bp)
+		}
+		if ev := <-debugger.Events(); ev.Kind != BreakpointResolvedEvent || ev.Breakpoint != id || ev.Line != 3 {
+			t.Errorf("wrong event %+v", ev)
+		}
+		if unresolved := debugger.UnresolvedBreakpoints(); len(unresolved) != 0 {
+			t.Errorf("wrong unresolved breakpoints %v", unresolved)
+		}
+		if reason := debugger.Continue(); reason != ProgramEndActivation {
+			t.Errorf("wrong activation %s", reason)
+		}
+	}()
+	v, err := r.RunScript("lib.js", SCRIPT)
+	<-ch // wait for the debugger
+	if err != nil || !v.SameAs(intToValue(3)) {
+		t.Errorf("wrong result %v, %v", v, err)
+	}
+}
+
+func TestDebuggerConditionScope(t *testing.T) {
+	const SCRIPT = `function make(v) {
+		return class {
+			#x = v;
+			get() {
+				var x = this.#x;
+				return x;
+			}
+		};
+	}
+	var A = make(1), B = make(2);
+	new A().get() + new B().get();
+	`
+	r := &Runtime{}
+	r.init()
+	debugger := r.AttachDebugger()
+	// each class has its own #x, although their methods share the same code
+	if _, err := debugger.SetConditionalBreakpoint("test.js", 6, "this.#x > 0"); err != nil {
+		t.Fatal(err)
+	}
+
+	ch := make(chan struct{})
+	go func() {
+		defer close(ch)
+		defer func() {
+			if t.Failed() {
+				r.Interrupt("failed test")
+			}
+		}()
+		defer debugger.Detach()
+		for _, expected := range []int64{1, 2} {
+			if reason := debugger.Continue(); reason != BreakpointActivation {
+				t.Errorf("wrong activation %s, condition error %v", reason, debugger.LastConditionError())
+				return
+			}
+			if v, err := debugger.Exec("this.#x"); err != nil || v.ToInteger() != expected {
+				t.Errorf("wrong #x %v, %v", v, err)
+			}
+		}
+		if reason := debugger.Continue(); reason != ProgramEndActivation {
+			t.Errorf("wrong activation %s", reason)
+		}
+		if err := debugger.LastConditionError(); err != nil {
+			t.Error(err)
+		}
+	}()
+	testScript1WithRuntime(SCRIPT, intToValue(3), t, r)
+	<-ch // wait for the debugger
+}
+
+func testScript1WithRuntime(script string, expectedResult Value, t *testing.T, r *Runtime) {
+	prg, err := parser.ParseFile(nil, "test.js", script, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := newCompiler(true) // TODO have it as a parameter?
+	c.compile(prg, false, true, nil)
+
+	vm := r.vm
+	vm.prg = c.p
+	vm.prg.dumpCode(t.Logf)
+	vm.result = _undefined
+	vm.debug()
+	v := vm.result
+	t.Logf("stack size: %d", len(vm.stack))
+	t.Logf("stashAllocs: %d", vm.stashAllocs)
+
+	if v == nil && expectedResult != nil || !v.SameAs(expectedResult) {
+		t.Errorf("Result: %+v, expected: %+v", v, expectedResult)
+	}
+
+	if vm.sp != 0 {
+		t.Errorf("sp: %d", vm.sp)
+	}
+
+	if l := len(vm.iterStack); l > 0 {
+		t.Errorf("iter stack is not empty: %d", l)
+	}
+}
+
+func BenchmarkDebuggerConditionalBreakpoint(b *testing.B) {
+	b.StopTimer()
+	const SCRIPT = `
+	var sum = 0;
+	for (var i = 0; i < 1000000; i++) {
+		sum += i;
+	}
+	`
+	prg, err := Compile("test.js", SCRIPT, false)
+	if err != nil {
+		b.Fatal(err)
+	}
+	r := New()
+	debugger := r.AttachDebugger()
+	defer debugger.Detach()
+	if _, err := debugger.SetConditionalBreakpoint("test.js", 4, "i < 0"); err != nil {
+		b.Fatal(err)
+	}
+	b.StartTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := r.RunProgram(prg); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDebuggerExec(b *testing.B) {
+	b.StopTimer()
+	const SCRIPT = `
+	var o = {a: 1, b: [1, 2, 3]};
+	function f(x) {
+		debugger;
+	}
+	f(2);
+	`
+	r := New()
+	debugger := r.AttachDebugger()
+
+	ch := make(chan struct{})
+	go func() {
+		defer close(ch)
+		defer debugger.Detach()
+		if reason := debugger.Continue(); reason != DebuggerStatementActivation {
+			b.Errorf("wrong activation %s", reason)
+			return
+		}
+		b.ReportAllocs()
+		b.StartTimer()
+		for i := 0; i < b.N; i++ {
+			if _, err := debugger.Exec("o.a + o.b.length * x"); err != nil {
+				b.Error(err)
+				return
+			}
+		}
+		b.StopTimer()
+	}()
+	if _, err := r.RunString(SCRIPT); err != nil {
+		b.Fatal(err)
+	}
+	<-ch // wait for the debugger
 }
@@ -58,7 +58,9 @@ type nativeFuncObject struct {
 
 type boundFuncObject struct {
 	nativeFuncObject
-	wrapped *Object
+	wrapped   *Object
+	boundThis Value   // only used by the debugger
+	boundArgs []Value // only used by the debugger
 }
 
 func (f *nativeFuncObject) export(*objectExportCtx) interface{} {
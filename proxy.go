@@ -158,6 +158,12 @@ func (h *jsProxyHandler) proxyCall(trap proxyTrap, args ...Value) (Value, bool)
 	r := h.handler.runtime
 
 	if m := toMethod(r.getVStr(h.handler, unistring.String(trap.String()))); m != nil {
+		if vm := r.vm; vm.limitProxyTraps {
+			if vm.proxyTraps <= 0 {
+				panic(&uncatchableException{err: errProxyTrapLimit})
+			}
+			vm.proxyTraps--
+		}
 		return m(FunctionCall{
 			This:      h.handler,
 			Arguments: args,
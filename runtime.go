@@ -2,6 +2,7 @@ package goja
 
 import (
 	"bytes"
+	gocontext "context"
 	"errors"
 	"fmt"
 	"go/ast"
@@ -14,8 +15,6 @@ import (
 	"strconv"
 	"time"
 
-	"github.com/dop251/goja/file"
-
 	"golang.org/x/text/collate"
 
 	js_ast "github.com/dop251/goja/ast"
@@ -1282,28 +1281,38 @@ func New() *Runtime {
 // in order to get when it blocks on a debugger statement or breakpoint
 // There can only be 1 debugger attached at a time, attaching more is has undefined behaviour
 func (r *Runtime) AttachDebugger() *Debugger {
-	r.vm.debugMode = true // maybe don't do this?
-	r.vm.debugger = newDebugger(r.vm)
-	return r.vm.debugger
+	dbg := newDebugger(r.vm)
+	attachSession(r.vm, dbg.debugSession)
+	return dbg
+}
+
+// AttachDebuggerWithContext is like AttachDebugger, but the debugging session is bound to ctx: once it's done the
+// running program is interrupted (with ctx.Err() as the value of the InterruptedError), Continue and the paused
+// program stop waiting for each other, and the debugger is detached when the program ends. If no program is running
+// at that point the next one is interrupted as soon as it starts, see Interrupt.
+func (r *Runtime) AttachDebuggerWithContext(ctx gocontext.Context) *Debugger {
+	dbg := r.AttachDebugger()
+	dbg.watch(ctx)
+	return dbg
 }
 
 // Compile creates an internal representation of the JavaScript code that can be later run using the Runtime.RunProgram()
 // method. This representation is not linked to a runtime in any way and can be run in multiple runtimes (possibly
 // at the same time).
 func Compile(name, src string, strict bool) (*Program, error) {
-	return compile(name, src, strict, false, true, false)
+	return compile(name, src, strict, true, nil, false)
 }
 
 // CompileAST creates an internal representation of the JavaScript code that can be later run using the Runtime.RunProgram()
 // method. This representation is not linked to a runtime in any way and can be run in multiple runtimes (possibly
 // at the same time).
 func CompileAST(prg *js_ast.Program, strict bool) (*Program, error) {
-	return compileAST(prg, strict, false, true, false)
+	return compileAST(prg, strict, true, nil, false)
 }
 
 // CompileASTDebug is like CompileAST but enables debug mode when compiling
 func CompileASTDebug(prg *js_ast.Program, strict bool) (*Program, error) {
-	return compileAST(prg, strict, false, true, true)
+	return compileAST(prg, strict, true, nil, true)
 }
 
 // MustCompile is like Compile but panics if the code cannot be compiled.
@@ -1345,11 +1354,11 @@ func compile(name, src string, strict, inGlobal bool, evalVm *vm, debug bool, pa
 		return
 	}
 
-	return compileAST(prg, strict, eval, inGlobal, debug)
+	return compileAST(prg, strict, inGlobal, evalVm, debug)
 }
 
 func compileAST(prg *js_ast.Program, strict, inGlobal bool, evalVm *vm, debug bool) (p *Program, err error) {
-	c := newCompiler()
+	c := newCompiler(debug)
 
 	defer func() {
 		if x := recover(); x != nil {
@@ -1392,7 +1401,7 @@ func (r *Runtime) RunString(str string) (Value, error) {
 
 // RunScript executes the given string in the global context.
 func (r *Runtime) RunScript(name, src string) (Value, error) {
-	p, err := r.compile(name, src, false, false, true)
+	p, err := r.compile(name, src, false, true, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -1422,6 +1431,9 @@ func (r *Runtime) RunProgram(p *Program) (result Value, err error) {
 		vm.stash = &r.global.stash
 		vm.sb = vm.sp - 1
 	}
+	if vm.debugger != nil {
+		vm.debugger.attach(p)
+	}
 	vm.prg = p
 	vm.pc = 0
 	vm.result = _undefined
@@ -2712,6 +2724,9 @@ func (r *Runtime) leave() {
 // called when the top level function returns (i.e. control is passed outside the Runtime) but it was due to an interrupt
 func (r *Runtime) leaveAbrupt() {
 	r.jobQueue = nil
+	if dbg := r.vm.debugger; dbg != nil {
+		dbg.jobs = nil
+	}
 	r.ClearInterrupt()
 }
 
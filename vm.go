@@ -268,6 +268,9 @@ type vm struct {
 
 	debugger  *Debugger
 	debugMode bool // TODO drop this as we can just check debugger is nil or not
+
+	limitProxyTraps bool // set while the debugger inspects a proxy, see inspectProxy
+	proxyTraps      int  // number of traps which may still be called then
 }
 
 type instruction interface {
@@ -520,13 +523,71 @@ func (vm *vm) debug() {
 	vm.halt = false
 	interrupted := false
 	ticks := 0
-	// vm.debugger.activate(ProgramStartActivation)
+
+	if dbg := vm.debugger; dbg != nil {
+		if dbg.runDepth++; dbg.runDepth == 1 {
+			dbg.start()
+		}
+		dbg.runs = append(dbg.runs, debugRun{prg: vm.prg, pc: vm.pc, depth: len(vm.callStack)})
+		defer func() {
+			dbg.runs = dbg.runs[:len(dbg.runs)-1]
+			if dbg.runDepth--; dbg.runDepth > 0 {
+				return
+			}
+			// this is the outermost run, so anything still propagating is uncaught
+			x := recover()
+			var err error
+			if x != nil {
+				if ex, ok := x.(*uncatchableException); ok {
+					err = ex.err
+				} else if ex := vm.exceptionFromPanic(x); ex != nil {
+					err = ex
+				} else {
+					err = fmt.Errorf("%v", x)
+				}
+			}
+			if vm.debugger == dbg {
+				if err != nil && dbg.breakOnExit && !dbg.active {
+					// let the state at the point of the uncaught exception be inspected before it's unwound
+					dbg.setErr(err)
+					dbg.activate(ExitActivation)
+				}
+				dbg.finish(vm.result, err)
+				if dbg.cancelled() {
+					dbg.detachVM()
+				}
+			}
+			if x != nil {
+				panic(x)
+			}
+		}()
+	}
 
 	for !vm.halt {
 		if interrupted = atomic.LoadUint32(&vm.interrupted) != 0; interrupted {
 			break
 		}
 
+		if vm.debugger != nil {
+			vm.debugger.traceFrames()
+		}
+
+		if vm.debugger != nil && vm.debugger.atStart() {
+			vm.debugger.activate(ProgramStartActivation)
+			if vm.debugger != nil {
+				vm.debugger.pausedOnLine()
+			}
+		}
+
+		if vm.debugger != nil && vm.debugger.atExit() {
+			vm.debugger.activate(ExitActivation)
+		}
+
+		// a step ending at a debugger statement pauses for the statement, like when it's reached in any other way
+		if vm.debugger != nil && !vm.debugger.active && vm.debugger.stepDone() && vm.prg.code[vm.pc] != debugger {
+			vm.debugger.activate(StepActivation)
+		}
+
 		if vm.debugger != nil {
 			if !vm.debugger.active && vm.debugger.breakpoint() {
 				if vm.debugger.lastBreakpoint.filename == vm.debugger.Filename() &&
@@ -538,7 +599,7 @@ func (vm *vm) debug() {
 					vm.debugger.lastBreakpoint.filename = vm.debugger.Filename()
 					vm.debugger.lastBreakpoint.line = vm.debugger.Line()
 					vm.debugger.lastBreakpoint.stackDepth = vm.debugger.callStackDepth()
-					if vm.debugger.lastBreakpoint.stackDepth >= prevStackDepth {
+					if vm.debugger.lastBreakpoint.stackDepth >= prevStackDepth && vm.debugger.hit() {
 						vm.debugger.updateCurrentLine()
 						vm.debugger.activate(BreakpointActivation)
 					}
@@ -553,7 +614,11 @@ func (vm *vm) debug() {
 			}
 		}
 
-		vm.prg.code[vm.pc].exec(vm)
+		if vm.debugger != nil && (vm.debugger.breakOnThrow || vm.debugger.logExceptions) {
+			vm.debugger.execInstruction()
+		} else {
+			vm.prg.code[vm.pc].exec(vm)
+		}
 
 		ticks++
 		if ticks > 10000 {
@@ -646,39 +711,7 @@ func (vm *vm) try(f func()) (ex *Exception) {
 				}
 				vm.refStack = vm.refStack[:refLen]
 			}()
-			switch x1 := x.(type) {
-			case *Object:
-				ex = &Exception{
-					val: x1,
-				}
-				if er, ok := x1.self.(*errorObject); ok {
-					ex.stack = er.stack
-				}
-			case Value:
-				ex = &Exception{
-					val: x1,
-				}
-			case *Exception:
-				ex = x1
-			case *uncatchableException:
-				panic(x1)
-			case typeError:
-				ex = &Exception{
-					val: vm.r.NewTypeError(string(x1)),
-				}
-			case referenceError:
-				ex = &Exception{
-					val: vm.r.newError(vm.r.global.ReferenceError, string(x1)),
-				}
-			case rangeError:
-				ex = &Exception{
-					val: vm.r.newError(vm.r.global.RangeError, string(x1)),
-				}
-			case syntaxError:
-				ex = &Exception{
-					val: vm.r.newError(vm.r.global.SyntaxError, string(x1)),
-				}
-			default:
+			if ex = vm.exceptionFromPanic(x); ex == nil {
 				/*
 					if vm.prg != nil {
 						vm.prg.dumpCode(log.Printf)
@@ -688,9 +721,6 @@ func (vm *vm) try(f func()) (ex *Exception) {
 				*/
 				panic(x)
 			}
-			if ex.stack == nil {
-				ex.stack = vm.captureStack(make([]StackFrame, 0, len(vm.callStack)+1), 0)
-			}
 		}
 	}()
 
@@ -698,6 +728,49 @@ func (vm *vm) try(f func()) (ex *Exception) {
 	return
 }
 
+// exceptionFromPanic converts a value recovered from a panic raised by the running code into an *Exception
+// (capturing the stack if needed). It returns nil if the value cannot be caught by JS code, in which case it
+// should be re-panicked.
+func (vm *vm) exceptionFromPanic(x interface{}) (ex *Exception) {
+	switch x1 := x.(type) {
+	case *Object:
+		ex = &Exception{
+			val: x1,
+		}
+		if er, ok := x1.self.(*errorObject); ok {
+			ex.stack = er.stack
+		}
+	case Value:
+		ex = &Exception{
+			val: x1,
+		}
+	case *Exception:
+		ex = x1
+	case typeError:
+		ex = &Exception{
+			val: vm.r.NewTypeError(string(x1)),
+		}
+	case referenceError:
+		ex = &Exception{
+			val: vm.r.newError(vm.r.global.ReferenceError, string(x1)),
+		}
+	case rangeError:
+		ex = &Exception{
+			val: vm.r.newError(vm.r.global.RangeError, string(x1)),
+		}
+	case syntaxError:
+		ex = &Exception{
+			val: vm.r.newError(vm.r.global.SyntaxError, string(x1)),
+		}
+	default:
+		return nil
+	}
+	if ex.stack == nil {
+		ex.stack = vm.captureStack(make([]StackFrame, 0, len(vm.callStack)+1), 0)
+	}
+	return
+}
+
 func (vm *vm) runTry() (ex *Exception) {
 	if vm.debugMode {
 		return vm.try(vm.debug)
@@ -1442,6 +1515,18 @@ func (_debugger) exec(vm *vm) {
 	}
 }
 
+type _saveExprValue struct{}
+
+// saveExprValue is emitted after expression statements in debug mode, see Debugger.LastExpressionValue.
+var saveExprValue _saveExprValue
+
+func (_saveExprValue) exec(vm *vm) {
+	if dbg := vm.debugger; dbg != nil {
+		dbg.exprValue, dbg.hasExprValue = vm.stack[vm.sp-1], true
+	}
+	vm.pc++
+}
+
 type jump int32
 
 func (j jump) exec(vm *vm) {